@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/containerd/containerd/diff"
@@ -19,8 +21,34 @@ import (
 	"github.com/jpower432/runc-attribute-wrapper/aritfact/content/file"
 )
 
+// artifactApplier applies artifacts with file stores it owns for the life
+// of an unpack. A file store is rooted at one working directory and each
+// blob is applied to its own snapshot mount, so the unpack does not share
+// one store: a store is created per applied blob, with the settings and
+// the temporary directory of the applier. Hard links to entries of earlier
+// blobs are resolved through the lower directories of the mount instead.
+// The applier must be closed after use.
 type artifactApplier struct {
 	store content.Fetcher
+	// sourceDateEpoch is the default time of the applied
+	// files. Write times are kept if zero.
+	sourceDateEpoch time.Time
+	// extractLimits bounds the applied directory blobs.
+	extractLimits file.ExtractLimits
+	// dedupe selects how applied files share storage
+	// with the blobs of the content store at contentRoot.
+	dedupe      file.DedupeMode
+	contentRoot string
+
+	mu sync.Mutex
+	// stores are the file stores of the applied content.
+	stores []*file.Store
+	// tempRoot is the directory tempDir is created in.
+	// Default value: the system temporary directory.
+	tempRoot string
+	// tempDir holds the temporary files of the stores.
+	tempDir string
+	closed  bool
 }
 
 var emptyDesc = ocispec.Descriptor{}
@@ -54,7 +82,7 @@ func (a *artifactApplier) Apply(ctx context.Context, desc ocispec.Descriptor, mo
 	}
 	defer rc.Close()
 
-	if err := apply(ctx, mounts, desc, rc); err != nil {
+	if err := a.apply(ctx, mounts, desc, rc); err != nil {
 		return emptyDesc, err
 	}
 
@@ -70,7 +98,7 @@ func (a *artifactApplier) Apply(ctx context.Context, desc ocispec.Descriptor, mo
 	}, nil
 }
 
-func apply(ctx context.Context, mounts []mount.Mount, desc ocispec.Descriptor, r io.Reader) error {
+func (a *artifactApplier) apply(ctx context.Context, mounts []mount.Mount, desc ocispec.Descriptor, r io.Reader) error {
 	switch {
 	case len(mounts) == 1 && mounts[0].Type == "overlay":
 		// OverlayConvertWhiteout (mknod c 0 0) doesn't work in userns.
@@ -79,8 +107,9 @@ func apply(ctx context.Context, mounts []mount.Mount, desc ocispec.Descriptor, r
 			break
 		}
 
-		// I will need to use parents eventually
-		path, _, err := getOverlayPath(mounts[0].Options)
+		// Hard links to entries of earlier blobs
+		// are resolved through the lower directories.
+		path, lowers, err := getOverlayPath(mounts[0].Options)
 		if err != nil {
 			if errdefs.IsInvalidArgument(err) {
 				break
@@ -88,8 +117,7 @@ func apply(ctx context.Context, mounts []mount.Mount, desc ocispec.Descriptor, r
 			return err
 		}
 
-		store := file.New(path)
-		return store.Push(ctx, desc, r)
+		return a.push(ctx, path, lowers, desc, r)
 	case len(mounts) == 1 && mounts[0].Type == "aufs":
 		path, _, err := getAufsPath(mounts[0].Options)
 		if err != nil {
@@ -98,16 +126,99 @@ func apply(ctx context.Context, mounts []mount.Mount, desc ocispec.Descriptor, r
 			}
 			return err
 		}
-		store := file.New(path)
-		return store.Push(ctx, desc, r)
+		// Lower directories are not passed, since
+		// aufs whiteouts are not supported by the store.
+		return a.push(ctx, path, nil, desc, r)
 
 	}
 	return mount.WithTempMount(ctx, mounts, func(root string) error {
-		store := file.New(root)
-		return store.Push(ctx, desc, r)
+		return a.push(ctx, root, nil, desc, r)
 	})
 }
 
+// push pushes the content to a file store at the root path, which is the
+// upper directory of the lower directories if set. Reading the content
+// stops once the context is canceled.
+func (a *artifactApplier) push(ctx context.Context, root string, lowers []string, desc ocispec.Descriptor, r io.Reader) error {
+	store, err := a.newStore(root, lowers)
+	if err != nil {
+		return err
+	}
+	return store.Push(ctx, desc, &contextReader{ctx: ctx, r: r})
+}
+
+// newStore creates a file store at the root path, which is closed
+// with the applier. The temporary files of the stores are created in a
+// directory owned by the applier, in tempRoot.
+func (a *artifactApplier) newStore(root string, lowers []string) (*file.Store, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.closed {
+		return nil, fmt.Errorf("applier is closed: %w", errdefs.ErrUnavailable)
+	}
+	if a.tempDir == "" {
+		dir, err := os.MkdirTemp(a.tempRoot, "rcl-apply-*")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+		}
+		a.tempDir = dir
+	}
+
+	store := file.New(root)
+	store.SourceDateEpoch = a.sourceDateEpoch
+	store.ExtractLimits = a.extractLimits
+	store.Dedupe = a.dedupe
+	store.ContentRoot = a.contentRoot
+	store.TempDir = a.tempDir
+	store.LowerDirs = lowers
+	a.stores = append(a.stores, store)
+	return store, nil
+}
+
+// Close closes the file stores created by the applier and removes their
+// temporary files. The first error encountered is returned.
+func (a *artifactApplier) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.closed {
+		return nil
+	}
+	a.closed = true
+
+	var errs []error
+	for _, store := range a.stores {
+		if err := store.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	a.stores = nil
+	if a.tempDir != "" {
+		if err := os.RemoveAll(a.tempDir); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// contextReader is a reader returning the context error
+// once the context is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
 func getOverlayPath(options []string) (upper string, lower []string, err error) {
 	const upperdirPrefix = "upperdir="
 	const lowerdirPrefix = "lowerdir="
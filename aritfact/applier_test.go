@@ -0,0 +1,187 @@
+package aritfact
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/containerd/containerd/mount"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	orasfile "oras.land/oras-go/v2/content/file"
+
+	"github.com/jpower432/runc-attribute-wrapper/aritfact/content/file"
+)
+
+// blobFetcher fetches the same content for any descriptor.
+type blobFetcher []byte
+
+func (b blobFetcher) Fetch(context.Context, ocispec.Descriptor) (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+// zipBlob returns a zip archive of a file, and the descriptor
+// of the archive unpacked to a directory named app.
+func zipBlob(t *testing.T) ([]byte, ocispec.Descriptor) {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("app/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("file")); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	content := buf.Bytes()
+	return content, ocispec.Descriptor{
+		MediaType: file.MediaTypeZip,
+		Digest:    digest.FromBytes(content),
+		Size:      int64(len(content)),
+		Annotations: map[string]string{
+			ocispec.AnnotationTitle:   "app",
+			orasfile.AnnotationUnpack: "true",
+		},
+	}
+}
+
+// overlayMounts returns the mounts of an overlay snapshot with
+// a new upper directory, applied to without mounting them.
+func overlayMounts(t *testing.T) []mount.Mount {
+	t.Helper()
+	upper, lower := t.TempDir(), t.TempDir()
+	return []mount.Mount{{
+		Type:    "overlay",
+		Source:  "overlay",
+		Options: []string{"upperdir=" + upper, "lowerdir=" + lower, "workdir=" + t.TempDir()},
+	}}
+}
+
+// tempFiles returns the temporary files of the file stores in the directory.
+func tempFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(info.Name(), "oras_file_") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestApplierTempFiles(t *testing.T) {
+	content, desc := zipBlob(t)
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		desc    ocispec.Descriptor
+		wantErr bool
+	}{
+		{name: "success", ctx: context.Background(), desc: desc},
+		{
+			name: "digest mismatch",
+			ctx:  context.Background(),
+			desc: func() ocispec.Descriptor {
+				mismatch := desc
+				mismatch.Digest = digest.FromString("other")
+				return mismatch
+			}(),
+			wantErr: true,
+		},
+		{name: "canceled", ctx: canceled, desc: desc, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempRoot := t.TempDir()
+			a := &artifactApplier{store: blobFetcher(content), tempRoot: tempRoot}
+
+			_, err := a.Apply(tt.ctx, tt.desc, overlayMounts(t))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Apply() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if filepath.Dir(a.tempDir) != tempRoot {
+				t.Errorf("temporary directory %s not in %s", a.tempDir, tempRoot)
+			}
+			// The zip archive is buffered until the stores are closed.
+			if !tt.wantErr && len(tempFiles(t, tempRoot)) == 0 {
+				t.Error("zip archive not buffered to a temporary file")
+			}
+
+			if err := a.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if files := tempFiles(t, tempRoot); len(files) != 0 {
+				t.Errorf("temporary files left behind: %v", files)
+			}
+			entries, err := os.ReadDir(tempRoot)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 0 {
+				t.Errorf("temporary directory left behind: %v", entries)
+			}
+
+			// Closed appliers do not create stores.
+			if _, err := a.Apply(context.Background(), desc, overlayMounts(t)); err == nil {
+				t.Error("applied with a closed applier")
+			}
+			if files := tempFiles(t, tempRoot); len(files) != 0 {
+				t.Errorf("temporary files created after close: %v", files)
+			}
+		})
+	}
+}
+
+func TestApplierStorePerBlob(t *testing.T) {
+	content, desc := zipBlob(t)
+	a := &artifactApplier{store: blobFetcher(content), tempRoot: t.TempDir()}
+	var uppers []string
+	for i := 0; i < 2; i++ {
+		mounts := overlayMounts(t)
+		upper, _, err := getOverlayPath(mounts[0].Options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := a.Apply(context.Background(), desc, mounts); err != nil {
+			t.Fatal(err)
+		}
+		uppers = append(uppers, upper)
+	}
+	// Each blob is applied by its own store to its own mount.
+	if len(a.stores) != len(uppers) {
+		t.Errorf("%d stores for %d applied blobs", len(a.stores), len(uppers))
+	}
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, upper := range uppers {
+		got, err := os.ReadFile(filepath.Join(upper, "app", "file"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != "file" {
+			t.Errorf("%s/app/file = %q, want %q", upper, got, "file")
+		}
+	}
+	if len(a.stores) != 0 {
+		t.Errorf("%d stores left open", len(a.stores))
+	}
+}
@@ -19,6 +19,18 @@ import (
 
 type Artifact struct {
 	Blob ocispec.Descriptor
+	// Diff identifies the applied blob in the chain of snapshots.
+	// Defaults to the blob digest.
+	Diff digest.Digest
+}
+
+// diffID returns the digest identifying the
+// applied blob in the chain of snapshots.
+func (a Artifact) diffID() digest.Digest {
+	if a.Diff != "" {
+		return a.Diff
+	}
+	return a.Blob.Digest
 }
 
 func ApplyArtifacts(ctx context.Context, layers []Artifact, sn snapshots.Snapshotter, a diff.Applier) (digest.Digest, error) {
@@ -28,7 +40,7 @@ func ApplyArtifacts(ctx context.Context, layers []Artifact, sn snapshots.Snapsho
 func ApplyArtifactsWithOpts(ctx context.Context, artifacts []Artifact, sn snapshots.Snapshotter, a diff.Applier, applyOpts []diff.ApplyOpt) (digest.Digest, error) {
 	chain := make([]digest.Digest, len(artifacts))
 	for i, artifact := range artifacts {
-		chain[i] = artifact.Blob.Digest
+		chain[i] = artifact.diffID()
 	}
 	chainID := identity.ChainID(chain)
 
@@ -55,7 +67,7 @@ func ApplyArtifact(ctx context.Context, layer Artifact, chain []digest.Digest, s
 
 func ApplyArtifactWithOpts(ctx context.Context, artifact Artifact, chain []digest.Digest, sn snapshots.Snapshotter, a diff.Applier, opts []snapshots.Opt, applyOpts []diff.ApplyOpt) (bool, error) {
 	var (
-		chainID = identity.ChainID(append(chain, artifact.Blob.Digest)).String()
+		chainID = identity.ChainID(append(chain, artifact.diffID())).String()
 		applied bool
 	)
 
@@ -65,7 +77,7 @@ func ApplyArtifactWithOpts(ctx context.Context, artifact Artifact, chain []diges
 			return false, fmt.Errorf("failed to stat snapshot %s: %w", chainID, err)
 		}
 
-		if err := applyArtifacts(ctx, []Artifact{artifact}, append(chain, artifact.Blob.Digest), sn, a, opts, applyOpts); err != nil {
+		if err := applyArtifacts(ctx, []Artifact{artifact}, append(chain, artifact.diffID()), sn, a, opts, applyOpts); err != nil {
 			if !errdefs.IsAlreadyExists(err) {
 				return false, err
 			}
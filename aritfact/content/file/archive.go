@@ -0,0 +1,317 @@
+package file
+
+import (
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// MediaTypeZip is the media type of zip archives.
+const MediaTypeZip = "application/zip"
+
+// maxZipLinkSize is the maximum size of a symbolic link target in a zip archive.
+const maxZipLinkSize = 4096
+
+// archiveFormat is the format of a directory blob.
+type archiveFormat int
+
+const (
+	formatTarGzip archiveFormat = iota
+	formatTar
+	formatTarZstd
+	formatZip
+)
+
+// archiveFormatFromMediaType returns the archive format for the media type
+// of a directory blob. Unknown media types are assumed to be gzip compressed
+// tarballs.
+func archiveFormatFromMediaType(mediaType string) archiveFormat {
+	switch {
+	case mediaType == MediaTypeZip, strings.HasSuffix(mediaType, "+zip"):
+		return formatZip
+	case strings.HasSuffix(mediaType, "+zstd"):
+		return formatTarZstd
+	case strings.HasSuffix(mediaType, "+gzip"):
+		return formatTarGzip
+	case mediaType == "application/x-tar", strings.HasSuffix(mediaType, ".tar"):
+		return formatTar
+	default:
+		return formatTarGzip
+	}
+}
+
+// newDecompressReader returns a reader decompressing the tarball.
+func newDecompressReader(r io.Reader, format archiveFormat) (io.ReadCloser, error) {
+	switch format {
+	case formatTar:
+		return io.NopCloser(r), nil
+	case formatTarZstd:
+		dec, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return dec.IOReadCloser(), nil
+	case formatTarGzip:
+		return gzip.NewReader(r)
+	default:
+		return nil, fmt.Errorf("archive format %d is not a tarball", format)
+	}
+}
+
+// newCompressWriter returns a writer compressing the tarball.
+func newCompressWriter(w io.Writer, format archiveFormat) (io.WriteCloser, error) {
+	switch format {
+	case formatTar:
+		return nopWriteCloser{w}, nil
+	case formatTarZstd:
+		return zstd.NewWriter(w)
+	case formatTarGzip:
+		return gzip.NewWriter(w), nil
+	default:
+		return nil, fmt.Errorf("archive format %d is not a tarball", format)
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// extractLimiter tracks the extracted content against the extraction limits.
+type extractLimiter struct {
+	limits  ExtractLimits
+	entries int
+	size    int64
+}
+
+// entry accounts for an archive entry with the relative name.
+func (l *extractLimiter) entry(name string) error {
+	l.entries++
+	if l.limits.Entries > 0 && l.entries > l.limits.Entries {
+		return fmt.Errorf("more than %d entries: %w", l.limits.Entries, ErrExtractLimitExceeded)
+	}
+	if depth := pathDepth(name); l.limits.Depth > 0 && depth > l.limits.Depth {
+		return fmt.Errorf("%q is deeper than %d: %w", name, l.limits.Depth, ErrExtractLimitExceeded)
+	}
+	return nil
+}
+
+// add accounts for the size of an extracted file.
+func (l *extractLimiter) add(size int64) error {
+	l.size += size
+	if l.limits.Size > 0 && l.size > l.limits.Size {
+		return fmt.Errorf("more than %d bytes: %w", l.limits.Size, ErrExtractLimitExceeded)
+	}
+	return nil
+}
+
+// extractZipDirectory extracts the zip file to a directory specified by the
+// `dir` parameter. The file name prefix is ensured to be the string specified
+// by the `prefix` parameter and is trimmed. Zip archives do not store the
+// owner of the entries, which are considered owned by root by the ownership
+// policy.
+func extractZipDirectory(dir, prefix, filename string, opts extractOptions, buf []byte) (err error) {
+	zr, err := zip.OpenReader(filename)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		closeErr := zr.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	root, err := openExtractRoot(dir)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		closeErr := root.close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	// Directory times are set once extracted, since
+	// extracting the entries modifies them.
+	var dirs []*zip.File
+	var dirNames []string
+	limiter := extractLimiter{limits: opts.limits}
+	for _, f := range zr.File {
+		name, err := ensureBasePath(dir, prefix, strings.TrimSuffix(f.Name, "/"))
+		if err != nil {
+			return err
+		}
+		if err := limiter.entry(name); err != nil {
+			return err
+		}
+
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			if err := root.mkdirAll(name, mode); err != nil {
+				return err
+			}
+			if err := setOwner(root, name, mode, opts.ownership, 0, 0); err != nil {
+				return err
+			}
+			dirs = append(dirs, f)
+			dirNames = append(dirNames, name)
+			continue
+		case mode&os.ModeSymlink != 0:
+			target, err := readZipLink(f)
+			if err != nil {
+				return err
+			}
+			if target, err = ensureLinkPath(dir, prefix, filepath.Join(dir, name), target); err != nil {
+				return err
+			}
+			if err := root.symlink(target, name); err != nil {
+				return err
+			}
+		case mode.IsRegular():
+			// The size is verified by the zip reader.
+			if err := limiter.add(int64(f.UncompressedSize64)); err != nil {
+				return err
+			}
+			if err := extractZipFile(root, name, f, buf); err != nil {
+				return err
+			}
+		default:
+			continue // Other file types are skipped
+		}
+		if err := setOwner(root, name, mode, opts.ownership, 0, 0); err != nil {
+			return err
+		}
+
+		// Change access time and modification time if possible (error ignored)
+		atime, mtime := clampTimes(f.Modified, f.Modified, opts.epoch)
+		root.lchtimes(name, atime, mtime)
+	}
+
+	for i, f := range dirs {
+		atime, mtime := clampTimes(f.Modified, f.Modified, opts.epoch)
+		root.lchtimes(dirNames[i], atime, mtime)
+	}
+	return nil
+}
+
+// extractZipFile writes the content of the zip file to the named file.
+func extractZipFile(root extractRoot, name string, f *zip.File, buf []byte) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return root.writeFile(name, rc, f.Mode(), buf)
+}
+
+// readZipLink reads the target of a symbolic link stored in a zip file.
+func readZipLink(f *zip.File) (string, error) {
+	if f.UncompressedSize64 > maxZipLinkSize {
+		return "", fmt.Errorf("%s: symbolic link target too long", f.Name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	target, err := io.ReadAll(io.LimitReader(rc, maxZipLinkSize))
+	if err != nil {
+		return "", err
+	}
+	if len(target) == 0 {
+		return "", errors.New("empty symbolic link target")
+	}
+	return string(target), nil
+}
+
+// zipDirectory walks the directory specified by path, and zip those files
+// with a new path prefix.
+func zipDirectory(root, prefix string, w io.Writer, stripTimes bool, buf []byte) (err error) {
+	zw := zip.NewWriter(w)
+	defer func() {
+		closeErr := zw.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) (returnErr error) {
+		if err != nil {
+			return err
+		}
+
+		// Rename path
+		name, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		name = filepath.ToSlash(filepath.Join(prefix, name))
+
+		mode := info.Mode()
+		if !mode.IsDir() && !mode.IsRegular() && mode&os.ModeSymlink == 0 {
+			return nil // Other file types are skipped
+		}
+
+		// Generate header
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		header.Name = name
+		if mode.IsDir() {
+			header.Name += "/"
+		} else {
+			header.Method = zip.Deflate
+		}
+		if stripTimes {
+			header.Modified = time.Time{}
+			header.ModifiedTime = 0 //nolint:staticcheck // set by FileInfoHeader
+			header.ModifiedDate = 0 //nolint:staticcheck // set by FileInfoHeader
+		}
+
+		// Write file
+		fw, err := zw.CreateHeader(header)
+		if err != nil {
+			return fmt.Errorf("zip: %w", err)
+		}
+		switch {
+		case mode&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			_, err = io.WriteString(fw, link)
+			return err
+		case mode.IsRegular():
+			fp, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer func() {
+				closeErr := fp.Close()
+				if returnErr == nil {
+					returnErr = closeErr
+				}
+			}()
+
+			if _, err := io.CopyBuffer(fw, fp, buf); err != nil {
+				return fmt.Errorf("failed to copy to %s: %w", path, err)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,149 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// hasArchiveMagic returns true if the content starts
+// with the magic number of the archive format.
+func hasArchiveMagic(t *testing.T, content []byte, format archiveFormat) bool {
+	t.Helper()
+	switch format {
+	case formatTarGzip:
+		return bytes.HasPrefix(content, []byte{0x1f, 0x8b})
+	case formatTarZstd:
+		return bytes.HasPrefix(content, []byte{0x28, 0xb5, 0x2f, 0xfd})
+	case formatZip:
+		return bytes.HasPrefix(content, []byte("PK\x03\x04"))
+	case formatTar:
+		// The magic number follows the header fields of the first entry.
+		return len(content) > 262 && string(content[257:262]) == "ustar"
+	}
+	t.Fatalf("unknown archive format %d", format)
+	return false
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	want := map[string]string{"bin/tool": "tool", "config": "config", "empty": ""}
+	tests := []struct {
+		name      string
+		mediaType string
+		format    archiveFormat
+	}{
+		{name: "default", format: formatTarGzip},
+		{name: "gzip", mediaType: ocispec.MediaTypeImageLayerGzip, format: formatTarGzip},
+		{name: "tar", mediaType: ocispec.MediaTypeImageLayer, format: formatTar},
+		{name: "x-tar", mediaType: "application/x-tar", format: formatTar},
+		{name: "zstd", mediaType: ocispec.MediaTypeImageLayerZstd, format: formatTarZstd},
+		{name: "zip", mediaType: MediaTypeZip, format: formatZip},
+		{name: "unknown media type", mediaType: "application/vnd.example.dir", format: formatTarGzip},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := t.TempDir()
+			if err := os.Mkdir(filepath.Join(src, "bin"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			for name, content := range want {
+				if err := os.WriteFile(filepath.Join(src, name), []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			s := New(t.TempDir())
+			s.TarPreserveOwnership = true
+			defer s.Close()
+			desc, err := s.Add(context.Background(), "app", tt.mediaType, src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.mediaType != "" && desc.MediaType != tt.mediaType {
+				t.Errorf("media type = %s, want %s", desc.MediaType, tt.mediaType)
+			}
+			rc, err := s.Fetch(context.Background(), desc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			content, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !hasArchiveMagic(t, content, tt.format) {
+				t.Errorf("blob is not in archive format %d", tt.format)
+			}
+
+			dir := t.TempDir()
+			ps := New(dir)
+			defer ps.Close()
+			if err := ps.Push(context.Background(), desc, bytes.NewReader(content)); err != nil {
+				t.Fatal(err)
+			}
+			got := dirFiles(t, filepath.Join(dir, "app"))
+			if len(got) != len(want) {
+				t.Errorf("files = %v, want %v", got, want)
+			}
+			for name, content := range want {
+				if got[name] != content {
+					t.Errorf("%s = %q, want %q", name, got[name], content)
+				}
+			}
+		})
+	}
+}
+
+func TestPushDirMediaTypeMismatch(t *testing.T) {
+	content := tarball(t, dirEntry("app/"), regEntry("app/config", "config"))
+	var zstdContent bytes.Buffer
+	zw, err := zstd.NewWriter(&zstdContent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := zw.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		mediaType string
+		content   []byte
+	}{
+		{name: "tarball as gzip", mediaType: ocispec.MediaTypeImageLayerGzip, content: content},
+		{name: "tarball as zstd", mediaType: ocispec.MediaTypeImageLayerZstd, content: content},
+		{name: "zstd as tar", mediaType: ocispec.MediaTypeImageLayer, content: zstdContent.Bytes()},
+		// Unknown media types are read as gzip.
+		{name: "zstd as unknown media type", mediaType: "application/vnd.example.dir", content: zstdContent.Bytes()},
+		{name: "tarball as zip", mediaType: MediaTypeZip, content: content},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			desc := dirDescriptor("app", tt.content, "")
+			desc.MediaType = tt.mediaType
+			dir := t.TempDir()
+			s := New(dir)
+			defer s.Close()
+			if err := s.Push(context.Background(), desc, bytes.NewReader(tt.content)); err == nil {
+				t.Fatal("Push() succeeded, want an error")
+			}
+			// Nothing is left behind.
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 0 {
+				t.Errorf("entries left behind: %v", entries)
+			}
+		})
+	}
+}
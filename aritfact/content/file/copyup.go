@@ -0,0 +1,206 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// lowerEntry returns the path and file info of the entry named rel in the
+// topmost lower directory containing it. Overlay whiteouts and opaque
+// directories in the lower directories hide the entries below them.
+// Symbolic links are not followed.
+func (s *Store) lowerEntry(rel string) (string, os.FileInfo, error) {
+	components := strings.Split(filepath.ToSlash(rel), "/")
+	for _, lower := range s.LowerDirs {
+		path, info, hidden, err := lookupLower(lower, components)
+		if err == nil {
+			return path, info, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", nil, err
+		}
+		if hidden {
+			break
+		}
+	}
+	return "", nil, os.ErrNotExist
+}
+
+// lookupLower looks up the entry named by the path components in a lower
+// directory. If the entry is not found, it reports whether the entry is
+// hidden in the directories below, because it or one of its parents is
+// whited out or replaced, or a parent is opaque.
+func lookupLower(lower string, components []string) (path string, info os.FileInfo, hidden bool, err error) {
+	var opaque bool
+	path = lower
+	for i, component := range components {
+		path = filepath.Join(path, component)
+		info, err = os.Lstat(path)
+		if err != nil {
+			if errors.Is(err, syscall.ENOTDIR) {
+				err = os.ErrNotExist
+			}
+			return "", nil, opaque, err
+		}
+		if isWhiteout(info) {
+			// The entry was deleted in this layer.
+			return "", nil, true, os.ErrNotExist
+		}
+		if i == len(components)-1 {
+			break
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return "", nil, opaque, fmt.Errorf("%s: lower directory entry through symbolic link not supported", path)
+		}
+		if !info.IsDir() {
+			// The directory was replaced in this layer.
+			return "", nil, true, os.ErrNotExist
+		}
+		if isOpaque(path) {
+			opaque = true
+		}
+	}
+	return path, info, opaque, nil
+}
+
+// isWhiteout returns true if the file is an overlay whiteout,
+// a character device with the 0/0 device number.
+func isWhiteout(info os.FileInfo) bool {
+	if info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	major, minor, ok := deviceNumbers(info)
+	return ok && major == 0 && minor == 0
+}
+
+// copyUp copies the regular file named rel from the lower directories to
+// the target path in the working directory, as overlayfs does before a file
+// of a lower layer is modified or linked. The parent directories missing in
+// the working directory are created with the metadata of the lower ones.
+// The mode, ownership, extended attributes and times are preserved.
+func (s *Store) copyUp(rel, target string) (os.FileInfo, error) {
+	src, info, err := s.lowerEntry(rel)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("copy up of %s: not a regular file", rel)
+	}
+
+	dir, lowerDir := filepath.Dir(target), filepath.Dir(src)
+	if err := copyUpDirs(dir, lowerDir); err != nil {
+		return nil, err
+	}
+
+	if err := copyUpFile(target, src, info); err != nil {
+		os.Remove(target)
+		return nil, fmt.Errorf("copy up of %s: %w", rel, err)
+	}
+	return os.Lstat(target)
+}
+
+// ensureUpperDir creates the directory and its missing parents. Without
+// lower directories, they are created as by ensureDir. Otherwise, the
+// directories found in the lower directories are copied up with their
+// metadata, as overlayfs does, so the directories of the working directory
+// do not hide the mode, ownership and times of the lower ones.
+func (s *Store) ensureUpperDir(dir string) error {
+	if len(s.LowerDirs) == 0 {
+		return ensureDir(dir)
+	}
+	if _, err := os.Lstat(dir); err == nil || !os.IsNotExist(err) {
+		return err
+	}
+	base, err := filepath.Abs(s.workingDir)
+	if err != nil {
+		return err
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(base, abs)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		// Directories outside of the working directory have no lower directory.
+		return ensureDir(dir)
+	}
+	if err := s.ensureUpperDir(filepath.Dir(dir)); err != nil {
+		return err
+	}
+
+	lowerDir, info, err := s.lowerEntry(rel)
+	if err != nil || !info.IsDir() {
+		return os.Mkdir(dir, 0750)
+	}
+	if err := os.Mkdir(dir, info.Mode().Perm()); err != nil {
+		return err
+	}
+	return copyMetadata(dir, lowerDir, info)
+}
+
+// copyUpDirs creates the directory and its missing parents, with the
+// mode, ownership and times of the matching lower directories.
+func copyUpDirs(dir, lowerDir string) error {
+	if _, err := os.Lstat(dir); err == nil || !os.IsNotExist(err) {
+		return err
+	}
+	if err := copyUpDirs(filepath.Dir(dir), filepath.Dir(lowerDir)); err != nil {
+		return err
+	}
+	info, err := os.Lstat(lowerDir)
+	if err != nil {
+		return err
+	}
+	if err := os.Mkdir(dir, info.Mode().Perm()); err != nil {
+		return err
+	}
+	return copyMetadata(dir, lowerDir, info)
+}
+
+// copyUpFile copies the content and metadata of the lower file to the target.
+func copyUpFile(target, src string, info os.FileInfo) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	buf := bufPool.Get().(*[]byte)
+	defer bufPool.Put(buf)
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.CopyBuffer(out, in, *buf); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return copyMetadata(target, src, info)
+}
+
+// copyMetadata copies the mode, ownership, extended attributes and times of
+// the source to the target. The mode and extended attributes are set after
+// the ownership is changed, since changing the ownership clears the setuid
+// and setgid bits and the file capabilities.
+func copyMetadata(target, src string, info os.FileInfo) error {
+	if uid, gid, ok := fileOwner(info); ok {
+		if err := os.Lchown(target, uid, gid); err != nil {
+			return err
+		}
+	}
+	if err := os.Chmod(target, info.Mode()&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky)); err != nil {
+		return err
+	}
+	if err := copyXattrs(target, src); err != nil {
+		return err
+	}
+	return lchtimes(target, accessTime(info), info.ModTime())
+}
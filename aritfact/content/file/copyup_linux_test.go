@@ -0,0 +1,153 @@
+package file
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// whiteout creates an overlay whiteout at the path,
+// and skips the test if device nodes cannot be created.
+func whiteout(t *testing.T, path string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := unix.Mknod(path, unix.S_IFCHR, 0); err != nil {
+		t.Skipf("whiteouts cannot be created: %v", err)
+	}
+}
+
+// writeLower writes a file in a lower directory.
+func writeLower(t *testing.T, lower, name, content string) {
+	t.Helper()
+	path := filepath.Join(lower, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLowerEntry(t *testing.T) {
+	tests := []struct {
+		name string
+		// setup populates the lower directories, from the topmost.
+		setup   func(t *testing.T, top, bottom string)
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "bottom",
+			setup: func(t *testing.T, top, bottom string) {
+				writeLower(t, bottom, "etc/passwd", "bottom")
+			},
+			want: "bottom",
+		},
+		{
+			name: "topmost wins",
+			setup: func(t *testing.T, top, bottom string) {
+				writeLower(t, top, "etc/passwd", "top")
+				writeLower(t, bottom, "etc/passwd", "bottom")
+			},
+			want: "top",
+		},
+		{
+			name: "whiteout",
+			setup: func(t *testing.T, top, bottom string) {
+				whiteout(t, filepath.Join(top, "etc/passwd"))
+				writeLower(t, bottom, "etc/passwd", "bottom")
+			},
+			wantErr: true,
+		},
+		{
+			name: "parent whiteout",
+			setup: func(t *testing.T, top, bottom string) {
+				whiteout(t, filepath.Join(top, "etc"))
+				writeLower(t, bottom, "etc/passwd", "bottom")
+			},
+			wantErr: true,
+		},
+		{
+			name: "parent replaced",
+			setup: func(t *testing.T, top, bottom string) {
+				writeLower(t, top, "etc", "file")
+				writeLower(t, bottom, "etc/passwd", "bottom")
+			},
+			wantErr: true,
+		},
+		{
+			name: "opaque parent",
+			setup: func(t *testing.T, top, bottom string) {
+				if err := os.Mkdir(filepath.Join(top, "etc"), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := unix.Lsetxattr(filepath.Join(top, "etc"), xattrOverlayOpaque, []byte("y"), 0); err != nil {
+					t.Skipf("trusted extended attributes are not supported: %v", err)
+				}
+				writeLower(t, bottom, "etc/passwd", "bottom")
+			},
+			wantErr: true,
+		},
+		{
+			name: "symbolic link parent",
+			setup: func(t *testing.T, top, bottom string) {
+				writeLower(t, bottom, "real/passwd", "bottom")
+				if err := os.Symlink("real", filepath.Join(top, "etc")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: true,
+		},
+		{name: "missing", setup: func(t *testing.T, top, bottom string) {}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			top, bottom := t.TempDir(), t.TempDir()
+			tt.setup(t, top, bottom)
+			s := New(t.TempDir())
+			s.LowerDirs = []string{top, bottom}
+
+			path, _, err := s.lowerEntry("etc/passwd")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("lowerEntry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("lowerEntry() content = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCopyUpXattrs(t *testing.T) {
+	lower, upper := xattrDir(t), xattrDir(t)
+	writeLower(t, lower, "bin/tool", "tool")
+	if err := unix.Lsetxattr(filepath.Join(lower, "bin/tool"), "user.origin", []byte("build"), 0); err != nil {
+		t.Fatal(err)
+	}
+	s := New(upper)
+	s.LowerDirs = []string{lower}
+
+	target := filepath.Join(upper, "bin/tool")
+	if _, err := s.copyUp("bin/tool", target); err != nil {
+		t.Fatal(err)
+	}
+	if got := lgetxattr(t, target, "user.origin"); string(got) != "build" {
+		t.Errorf("user.origin = %q, want %q", got, "build")
+	}
+	// An existing entry is not replaced.
+	if _, err := s.copyUp("bin/tool", target); !errors.Is(err, os.ErrExist) {
+		t.Errorf("copyUp() of an existing entry error = %v, want %v", err, os.ErrExist)
+	}
+}
@@ -0,0 +1,99 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/jpower432/runc-attribute-wrapper/aritfact/content/file/internal/ioutil"
+)
+
+// DedupeMode selects how pushed files share storage
+// with the blobs of a content store.
+type DedupeMode string
+
+const (
+	// DedupeNone copies the content of pushed files.
+	DedupeNone DedupeMode = ""
+	// DedupeReflink clones the content store blob of pushed
+	// files on file systems supporting reflinks.
+	DedupeReflink DedupeMode = "reflink"
+)
+
+// errCloneNotSupported is returned when files cannot be cloned on the platform.
+var errCloneNotSupported = errors.New("reflinks are not supported")
+
+// ParseDedupeMode parses a dedupe mode.
+func ParseDedupeMode(mode string) (DedupeMode, error) {
+	switch m := DedupeMode(mode); m {
+	case DedupeNone, DedupeReflink:
+		return m, nil
+	default:
+		return DedupeNone, fmt.Errorf("unsupported dedupe mode %q: must be %s", mode, DedupeReflink)
+	}
+}
+
+// blobPath returns the path of the content store blob matching the
+// descriptor size. The content of the blob is verified once cloned.
+func (s *Store) blobPath(desc ocispec.Descriptor) (string, bool) {
+	if s.ContentRoot == "" || desc.Digest.Validate() != nil {
+		return "", false
+	}
+	path := filepath.Join(s.ContentRoot, "blobs", desc.Digest.Algorithm().String(), desc.Digest.Encoded())
+	info, err := os.Lstat(path)
+	if err != nil || !info.Mode().IsRegular() || info.Size() != desc.Size {
+		return "", false
+	}
+	return path, true
+}
+
+// cloneBlob clones the content store blob to the target path, and verifies
+// the cloned content against the descriptor. It returns false, leaving an
+// empty target, if the blob cannot be cloned or does not match.
+func (s *Store) cloneBlob(target string, expected ocispec.Descriptor, permissions os.FileMode) (_ bool, err error) {
+	path, ok := s.blobPath(expected)
+	if !ok {
+		return false, nil
+	}
+	src, err := os.Open(path)
+	if err != nil {
+		return false, nil
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(target, os.O_RDWR|os.O_CREATE|os.O_TRUNC, permissions)
+	if err != nil {
+		return false, fmt.Errorf("failed to create file %s: %w", target, err)
+	}
+	defer func() {
+		closeErr := dst.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+	// File systems without reflinks or content stores
+	// on other file systems fall back to copies.
+	if err := cloneFile(dst, src); err != nil {
+		return false, nil
+	}
+	// The blob may have been modified in the content store.
+	if err := verifyFile(dst, expected); err != nil {
+		if err := dst.Truncate(0); err != nil {
+			return false, fmt.Errorf("failed to truncate file %s: %w", target, err)
+		}
+		return false, nil
+	}
+	s.digestToPath.Store(expected.Digest, target)
+	return true, nil
+}
+
+// verifyFile verifies the size and digest of the file content.
+func verifyFile(fp *os.File, expected ocispec.Descriptor) error {
+	buf := bufPool.Get().(*[]byte)
+	defer bufPool.Put(buf)
+	return ioutil.CopyBuffer(io.Discard, io.NewSectionReader(fp, 0, expected.Size+1), *buf, expected)
+}
@@ -0,0 +1,102 @@
+package file
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// reflinkDir mounts a loopback XFS or Btrfs file system supporting
+// reflinks and returns its directory, or skips the test.
+func reflinkDir(t *testing.T) string {
+	t.Helper()
+	if os.Geteuid() != 0 {
+		t.Skip("mounting a loopback file system requires root")
+	}
+	var mkfs []string
+	if path, err := exec.LookPath("mkfs.xfs"); err == nil {
+		mkfs = []string{path, "-q", "-m", "reflink=1"}
+	} else if path, err := exec.LookPath("mkfs.btrfs"); err == nil {
+		mkfs = []string{path, "-q"}
+	} else {
+		t.Skip("mkfs.xfs or mkfs.btrfs is required for reflinks")
+	}
+
+	image := filepath.Join(t.TempDir(), "reflink.img")
+	f, err := os.Create(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The image is sparse, above the minimum size of both file systems.
+	if err := f.Truncate(512 << 20); err != nil {
+		f.Close()
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command(mkfs[0], append(mkfs[1:], image)...).CombinedOutput(); err != nil {
+		t.Fatalf("%s: %v: %s", mkfs[0], err, out)
+	}
+	dir := t.TempDir()
+	if out, err := exec.Command("mount", "-o", "loop", image, dir).CombinedOutput(); err != nil {
+		t.Skipf("loopback mounts are not available: %v: %s", err, out)
+	}
+	t.Cleanup(func() {
+		if out, err := exec.Command("umount", dir).CombinedOutput(); err != nil {
+			t.Errorf("umount %s: %v: %s", dir, err, out)
+		}
+	})
+	return dir
+}
+
+func TestCloneBlobReflink(t *testing.T) {
+	dir := reflinkDir(t)
+	contentRoot, workingDir := filepath.Join(dir, "content"), filepath.Join(dir, "rootfs")
+	if err := os.Mkdir(workingDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	content := []byte("cloned content")
+	desc := blobDescriptor(ocispec.MediaTypeImageLayer, content, "")
+	writeBlob(t, contentRoot, desc, content)
+
+	s := New(workingDir)
+	s.Dedupe = DedupeReflink
+	s.ContentRoot = contentRoot
+	defer s.Close()
+
+	target := filepath.Join(workingDir, "file")
+	cloned, err := s.cloneBlob(target, desc, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cloned {
+		t.Fatal("blob not cloned on a file system supporting reflinks")
+	}
+	checkFile(t, target, string(content))
+
+	// Writing to the clone leaves the blob unchanged.
+	if err := os.WriteFile(target, []byte("modified"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	blob := filepath.Join(contentRoot, "blobs", "sha256", desc.Digest.Encoded())
+	checkFile(t, blob, string(content))
+
+	// A modified blob is cloned, but fails the verification.
+	if err := os.Remove(blob); err != nil {
+		t.Fatal(err)
+	}
+	writeBlob(t, contentRoot, desc, []byte("CLONED CONTENT"))
+	target = filepath.Join(workingDir, "modified")
+	cloned, err = s.cloneBlob(target, desc, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cloned {
+		t.Error("modified blob cloned")
+	}
+	checkFile(t, target, "")
+}
@@ -0,0 +1,24 @@
+//go:build !linux
+
+package file
+
+import (
+	"os"
+)
+
+// cloneFile clones the content of the source file to the destination file.
+func cloneFile(dst, src *os.File) error {
+	return errCloneNotSupported
+}
+
+// fileOwner returns the user and group ids of the file.
+// The owner is unknown on other platforms.
+func fileOwner(info os.FileInfo) (int, int, bool) {
+	return 0, 0, false
+}
+
+// fileInode returns the device and inode numbers of the file and its number
+// of hard links. Hard links are not detected on other platforms.
+func fileInode(info os.FileInfo) (inode, uint64, bool) {
+	return inode{}, 0, false
+}
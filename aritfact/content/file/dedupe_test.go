@@ -0,0 +1,98 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	uorspec "github.com/uor-framework/collection-spec/specs-go/v1alpha1"
+
+	"github.com/jpower432/runc-attribute-wrapper/aritfact/spec"
+)
+
+// writeBlob writes the content as a blob of the content store at the root.
+func writeBlob(t *testing.T, root string, desc ocispec.Descriptor, content []byte) {
+	t.Helper()
+	dir := filepath.Join(root, "blobs", desc.Digest.Algorithm().String())
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, desc.Digest.Encoded()), content, 0444); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseDedupeMode(t *testing.T) {
+	for _, tt := range []struct {
+		mode    string
+		want    DedupeMode
+		wantErr bool
+	}{
+		{mode: "", want: DedupeNone},
+		{mode: "reflink", want: DedupeReflink},
+		// Hard links would share the blob inode with the unpacked file.
+		{mode: "hardlink", wantErr: true},
+	} {
+		got, err := ParseDedupeMode(tt.mode)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseDedupeMode(%q) error = %v, wantErr %v", tt.mode, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("ParseDedupeMode(%q) = %q, want %q", tt.mode, got, tt.want)
+		}
+	}
+}
+
+// pushDeduped pushes the content to a store deduplicating
+// with the blobs at the content root, and returns the file path.
+func pushDeduped(t *testing.T, workingDir, contentRoot string, desc ocispec.Descriptor, content []byte) string {
+	t.Helper()
+	s := New(workingDir)
+	s.Dedupe = DedupeReflink
+	s.ContentRoot = contentRoot
+	defer s.Close()
+	if err := s.Push(context.Background(), desc, bytes.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(workingDir, desc.Annotations[ocispec.AnnotationTitle])
+}
+
+func TestPushDedupeFallback(t *testing.T) {
+	content := []byte("#!/bin/sh\necho hello\n")
+	file := &uorspec.File{Permissions: 0755, UID: -1, GID: -1}
+	desc := entryDescriptor(t, "bin/hello", content, file, spec.File{})
+
+	tests := []struct {
+		name string
+		// blob is the content of the content store blob, if any.
+		blob []byte
+	}{
+		{name: "missing blob"},
+		{name: "blob of another size", blob: []byte("short")},
+		// The blob matches the size, but not the digest.
+		{name: "modified blob", blob: bytes.ToUpper(content)},
+		{name: "matching blob", blob: content},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contentRoot := t.TempDir()
+			if tt.blob != nil {
+				writeBlob(t, contentRoot, desc, tt.blob)
+			}
+			// Reflinks are not supported by most temporary
+			// directories, where the content is copied.
+			path := pushDeduped(t, t.TempDir(), contentRoot, desc, content)
+			checkFile(t, path, string(content))
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != 0755 {
+				t.Errorf("mode = %v, want %v", info.Mode().Perm(), os.FileMode(0755))
+			}
+		})
+	}
+}
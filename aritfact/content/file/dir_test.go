@@ -0,0 +1,150 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2/content/file"
+)
+
+// dirDescriptor returns the descriptor of a tarball unpacked to the
+// directory named name. The digest is the one of the content if not set.
+func dirDescriptor(name string, content []byte, dgst digest.Digest) ocispec.Descriptor {
+	desc := blobDescriptor("application/x-tar", content, name)
+	desc.Annotations[file.AnnotationUnpack] = "true"
+	if dgst != "" {
+		desc.Digest = dgst
+	}
+	return desc
+}
+
+// dirFiles returns the contents of the regular files
+// of the directory by relative path.
+func dirFiles(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	contents := map[string]string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		contents[filepath.ToSlash(rel)] = string(content)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return contents
+}
+
+func TestPushDir(t *testing.T) {
+	content := tarball(t,
+		dirEntry("app/"),
+		dirEntry("app/bin/"),
+		regEntry("app/bin/tool", "tool"),
+		regEntry("app/config", "new"),
+	)
+	tests := []struct {
+		name     string
+		existing map[string]string
+		desc     ocispec.Descriptor
+		limits   ExtractLimits
+		wantErr  bool
+		want     map[string]string
+	}{
+		{
+			name: "new target",
+			desc: dirDescriptor("app", content, ""),
+			want: map[string]string{"bin/tool": "tool", "config": "new"},
+		},
+		{
+			name:     "merged into existing target",
+			existing: map[string]string{"config": "old", "keep": "keep"},
+			desc:     dirDescriptor("app", content, ""),
+			want:     map[string]string{"bin/tool": "tool", "config": "new", "keep": "keep"},
+		},
+		{
+			name:    "digest mismatch",
+			desc:    dirDescriptor("app", content, digest.FromString("other")),
+			wantErr: true,
+		},
+		{
+			name:     "digest mismatch with existing target",
+			existing: map[string]string{"config": "old", "keep": "keep"},
+			desc:     dirDescriptor("app", content, digest.FromString("other")),
+			wantErr:  true,
+			want:     map[string]string{"config": "old", "keep": "keep"},
+		},
+		{
+			name:     "extraction failure with existing target",
+			existing: map[string]string{"config": "old"},
+			desc:     dirDescriptor("app", content, ""),
+			limits:   ExtractLimits{Entries: 2},
+			wantErr:  true,
+			want:     map[string]string{"config": "old"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			target := filepath.Join(dir, "app")
+			if tt.existing != nil {
+				if err := os.Mkdir(target, 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for name, content := range tt.existing {
+				if err := os.WriteFile(filepath.Join(target, name), []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			s := New(dir)
+			s.ExtractLimits = tt.limits
+			defer s.Close()
+
+			err := s.Push(context.Background(), tt.desc, bytes.NewReader(content))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Push() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			// The staging directory is always removed.
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want == nil {
+				if len(entries) != 0 {
+					t.Fatalf("entries left behind: %v", entries)
+				}
+				return
+			}
+			if len(entries) != 1 || entries[0].Name() != "app" {
+				t.Fatalf("entries next to the target: %v", entries)
+			}
+			got := dirFiles(t, target)
+			if len(got) != len(tt.want) {
+				t.Errorf("files = %v, want %v", got, tt.want)
+			}
+			for name, content := range tt.want {
+				if got[name] != content {
+					t.Errorf("%s = %q, want %q", name, got[name], content)
+				}
+			}
+		})
+	}
+}
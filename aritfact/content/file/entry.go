@@ -0,0 +1,296 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	uorspec "github.com/uor-framework/collection-spec/specs-go/v1alpha1"
+	"oras.land/oras-go/v2/errdef"
+
+	"github.com/jpower432/runc-attribute-wrapper/aritfact/spec"
+)
+
+const (
+	// defaultEntryPermissions are the permissions of
+	// declared entries without file attributes.
+	defaultEntryPermissions = os.FileMode(0640)
+	// defaultDirPermissions are the permissions of
+	// declared directories without file attributes.
+	defaultDirPermissions = os.FileMode(0755)
+)
+
+var errMknodNotSupported = errors.New("device nodes and FIFOs are not supported on this platform")
+
+// inode identifies a file system entry by its device and inode numbers.
+type inode struct {
+	dev, ino uint64
+}
+
+// pushEntry creates the entry declared by the file schema at the target path.
+// The blob content is verified and kept in the fallback storage, so the
+// entry can be fetched like any other named content.
+//
+// Hard links share the inode of the linked entry, so the
+// permissions and ownership of the blob are not applied. When the store
+// writes to the upper directory of a layered mount, as when each blob of a
+// collection is unpacked to its own snapshot, the linked entry may be in a
+// lower directory, and is only found if the store has its LowerDirs.
+func (s *Store) pushEntry(ctx context.Context, target string, expected ocispec.Descriptor, file uorspec.File, entry spec.File, attrs extendedAttributes, content io.Reader) error {
+	if err := s.pushEntryContent(ctx, expected, content); err != nil {
+		return err
+	}
+	// The linked entry is resolved first, so the parent directories
+	// copied up from the lower directories keep their metadata.
+	var linked string
+	if entry.Type == spec.FileTypeHardlink {
+		var err error
+		if linked, err = s.resolveHardlink(entry.Linkname); err != nil {
+			return err
+		}
+	}
+	if err := s.ensureUpperDir(filepath.Dir(target)); err != nil {
+		return fmt.Errorf("failed to ensure directories of the target path: %w", err)
+	}
+
+	permissions := defaultEntryPermissions
+	if entry.Type == spec.FileTypeDirectory {
+		permissions = defaultDirPermissions
+	}
+	if file.Permissions != 0 {
+		permissions = fileMode(file.Permissions)
+	}
+
+	switch entry.Type {
+	case spec.FileTypeDirectory:
+		if err := os.MkdirAll(target, permissions); err != nil {
+			return err
+		}
+		// The directory may already exist and the mode
+		// is otherwise subject to the umask.
+		if err := os.Chmod(target, permissions); err != nil {
+			return err
+		}
+	case spec.FileTypeSymlink:
+		if err := s.checkSymlink(target, entry.Linkname); err != nil {
+			return err
+		}
+		if err := removeEntry(target); err != nil {
+			return err
+		}
+		if err := os.Symlink(entry.Linkname, target); err != nil {
+			return err
+		}
+	case spec.FileTypeHardlink:
+		if err := removeEntry(target); err != nil {
+			return err
+		}
+		if err := os.Link(linked, target); err != nil {
+			return err
+		}
+		return attrs.apply(target)
+	case spec.FileTypeCharDevice, spec.FileTypeBlockDevice, spec.FileTypeFIFO:
+		if err := removeEntry(target); err != nil {
+			return err
+		}
+		if err := mknod(target, entry.Type, permissions, entry.Major, entry.Minor); err != nil {
+			return fmt.Errorf("failed to create %s %s: %w", entry.Type, target, err)
+		}
+		if err := os.Chmod(target, permissions); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported entry type %q", entry.Type)
+	}
+
+	if file.UID != -1 && file.GID != -1 {
+		if err := os.Lchown(target, file.UID, file.GID); err != nil {
+			return err
+		}
+	}
+
+	return attrs.apply(target)
+}
+
+// pushEntryContent verifies the content of a declared entry and
+// stores it in the fallback storage.
+func (s *Store) pushEntryContent(ctx context.Context, expected ocispec.Descriptor, content io.Reader) error {
+	desc := ocispec.Descriptor{
+		MediaType: expected.MediaType,
+		Digest:    expected.Digest,
+		Size:      expected.Size,
+	}
+	if err := s.fallbackStorage.Push(ctx, desc, content); err != nil && !errors.Is(err, errdef.ErrAlreadyExists) {
+		return fmt.Errorf("failed to store %s: %w", expected.Digest, err)
+	}
+	return nil
+}
+
+// checkSymlink ensures a relative symbolic link target is in the working
+// directory. Absolute targets are resolved against the root of the
+// container file system and are not followed by the store.
+func (s *Store) checkSymlink(link, target string) error {
+	if target == "" {
+		return errors.New("symbolic link requires a linkname")
+	}
+	if s.AllowPathTraversalOnWrite || filepath.IsAbs(target) {
+		return nil
+	}
+	base, err := filepath.Abs(s.workingDir)
+	if err != nil {
+		return err
+	}
+	link, err = filepath.Abs(link)
+	if err != nil {
+		return err
+	}
+	_, err = ensureLinkPath(base, base, link, target)
+	return err
+}
+
+// resolveHardlink returns the path of the existing entry named by the
+// hard link. The entry must be in the working directory, or in the lower
+// directories of the store, in which case it is copied up first.
+func (s *Store) resolveHardlink(name string) (string, error) {
+	if name == "" {
+		return "", errors.New("hard link requires a linkname")
+	}
+	path, err := filepath.Abs(s.absPath(name))
+	if err != nil {
+		return "", err
+	}
+	if !s.AllowPathTraversalOnWrite {
+		base, err := filepath.Abs(s.workingDir)
+		if err != nil {
+			return "", err
+		}
+		if _, err := ensureBasePath(base, base, path); err != nil {
+			return "", err
+		}
+	}
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) && len(s.LowerDirs) > 0 {
+		info, err = s.copyUpHardlink(name, path)
+	}
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("hard link to %s: target not found in the working directory or its lower directories: %w", name, err)
+		}
+		return "", fmt.Errorf("hard link to %s: %w", name, err)
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("hard link to directory %s not allowed", name)
+	}
+	return path, nil
+}
+
+// copyUpHardlink copies up the hard link target at the path in the
+// working directory from the lower directories of the store.
+func (s *Store) copyUpHardlink(name, path string) (os.FileInfo, error) {
+	base, err := filepath.Abs(s.workingDir)
+	if err != nil {
+		return nil, err
+	}
+	rel, err := filepath.Rel(base, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("%s is outside of the working directory: %w", name, os.ErrNotExist)
+	}
+	return s.copyUp(rel, path)
+}
+
+// entryAttributes generates the core-file and rcl-file attributes of the
+// file system entry at the path from its mode and owner. Timestamps, extended
+// attributes and file capabilities are not generated.
+func entryAttributes(info os.FileInfo, path string) (uorspec.File, spec.File, error) {
+	file := uorspec.File{
+		Permissions: unixMode(info.Mode()),
+		UID:         -1,
+		GID:         -1,
+	}
+	if uid, gid, ok := fileOwner(info); ok {
+		file.UID, file.GID = uid, gid
+	}
+
+	var entry spec.File
+	mode := info.Mode()
+	switch {
+	case mode.IsRegular():
+	case mode.IsDir():
+		entry.Type = spec.FileTypeDirectory
+	case mode&os.ModeSymlink != 0:
+		link, err := os.Readlink(path)
+		if err != nil {
+			return file, entry, err
+		}
+		entry.Type = spec.FileTypeSymlink
+		entry.Linkname = link
+	case mode&os.ModeDevice != 0:
+		entry.Type = spec.FileTypeBlockDevice
+		if mode&os.ModeCharDevice != 0 {
+			entry.Type = spec.FileTypeCharDevice
+		}
+		major, minor, ok := deviceNumbers(info)
+		if !ok {
+			return file, entry, errMknodNotSupported
+		}
+		entry.Major, entry.Minor = major, minor
+	case mode&os.ModeNamedPipe != 0:
+		entry.Type = spec.FileTypeFIFO
+	default:
+		return file, entry, fmt.Errorf("unsupported file type %s", mode.Type())
+	}
+	return file, entry, nil
+}
+
+// fileMode converts unix permission bits, including the
+// setuid, setgid and sticky bits, to a file mode.
+func fileMode(permissions uint32) os.FileMode {
+	mode := os.FileMode(permissions).Perm()
+	if permissions&04000 != 0 {
+		mode |= os.ModeSetuid
+	}
+	if permissions&02000 != 0 {
+		mode |= os.ModeSetgid
+	}
+	if permissions&01000 != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode
+}
+
+// unixMode converts a file mode to unix permission
+// bits, including the setuid, setgid and sticky bits.
+func unixMode(mode os.FileMode) uint32 {
+	permissions := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		permissions |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		permissions |= 02000
+	}
+	if mode&os.ModeSticky != 0 {
+		permissions |= 01000
+	}
+	return permissions
+}
+
+// removeEntry removes an existing entry at the path, so it
+// can be replaced. Directories are not replaced.
+func removeEntry(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s: directory exists", path)
+	}
+	return os.Remove(path)
+}
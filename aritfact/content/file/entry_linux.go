@@ -0,0 +1,43 @@
+package file
+
+import (
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/jpower432/runc-attribute-wrapper/aritfact/spec"
+)
+
+// mknod creates a device node or FIFO at the path.
+func mknod(path, entryType string, permissions os.FileMode, major, minor int64) error {
+	return unix.Mknod(path, mknodMode(entryType, permissions), mkdev(major, minor))
+}
+
+// mknodMode returns the mknod mode for the entry type.
+func mknodMode(entryType string, permissions os.FileMode) uint32 {
+	mode := unixMode(permissions)
+	switch entryType {
+	case spec.FileTypeCharDevice:
+		mode |= unix.S_IFCHR
+	case spec.FileTypeBlockDevice:
+		mode |= unix.S_IFBLK
+	case spec.FileTypeFIFO:
+		mode |= unix.S_IFIFO
+	}
+	return mode
+}
+
+// mkdev returns the device number for the major and minor numbers.
+func mkdev(major, minor int64) int {
+	return int(unix.Mkdev(uint32(major), uint32(minor)))
+}
+
+// deviceNumbers returns the major and minor numbers of a device node.
+func deviceNumbers(info os.FileInfo) (int64, int64, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return int64(unix.Major(uint64(stat.Rdev))), int64(unix.Minor(uint64(stat.Rdev))), true
+}
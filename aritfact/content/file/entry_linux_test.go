@@ -0,0 +1,177 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	uorspec "github.com/uor-framework/collection-spec/specs-go/v1alpha1"
+
+	"github.com/jpower432/runc-attribute-wrapper/aritfact/spec"
+)
+
+// exportedBlob is a blob added from a file system entry and its content.
+type exportedBlob struct {
+	desc    ocispec.Descriptor
+	content []byte
+}
+
+// exportEntries adds every entry of the directory in lexical order,
+// as the collection export does, and returns the blobs.
+func exportEntries(t *testing.T, dir string) []exportedBlob {
+	t.Helper()
+	s := New(dir)
+	defer s.Close()
+	var blobs []exportedBlob
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == dir {
+			return err
+		}
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		desc, err := s.AddEntry(context.Background(), filepath.ToSlash(name), path)
+		if err != nil {
+			return err
+		}
+		rc, err := s.Fetch(context.Background(), desc)
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		content, err := io.ReadAll(rc)
+		if err != nil {
+			return err
+		}
+		blobs = append(blobs, exportedBlob{desc: desc, content: content})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return blobs
+}
+
+// topmost returns the path of the entry in the topmost layer containing it,
+// as the entry appears in the overlay mount of the layers.
+func topmost(t *testing.T, layers []string, name string) string {
+	t.Helper()
+	for i := len(layers) - 1; i >= 0; i-- {
+		path := filepath.Join(layers[i], name)
+		if _, err := os.Lstat(path); err == nil {
+			return path
+		}
+	}
+	t.Fatalf("%s not found in the layers", name)
+	return ""
+}
+
+func TestAddEntryRoundTrip(t *testing.T) {
+	file := func(permissions uint32) *uorspec.File {
+		return &uorspec.File{Permissions: permissions, UID: os.Getuid(), GID: os.Getgid()}
+	}
+	directory := spec.File{Type: spec.FileTypeDirectory}
+	collection := []struct {
+		name    string
+		content string
+		file    *uorspec.File
+		entry   spec.File
+	}{
+		{name: "app", file: file(0705), entry: directory},
+		{name: "app/bin", file: file(0711), entry: directory},
+		{name: "app/bin/tool", content: "tool", file: file(0755)},
+		{name: "app/lib", file: file(0700), entry: directory},
+		{name: "app/lib/tool", entry: spec.File{Type: spec.FileTypeHardlink, Linkname: "app/bin/tool"}},
+		{name: "app/link", file: file(0777), entry: spec.File{Type: spec.FileTypeSymlink, Linkname: "bin/tool"}},
+		{name: "app/fifo", file: file(0600), entry: spec.File{Type: spec.FileTypeFIFO}},
+		{name: "etc", file: file(0751), entry: directory},
+		{name: "etc/config", content: "config", file: file(0640)},
+	}
+
+	// Unpack the collection.
+	unpacked := t.TempDir()
+	s := New(unpacked)
+	for _, e := range collection {
+		content := []byte(e.content)
+		if err := s.Push(context.Background(), entryDescriptor(t, e.name, content, e.file, e.entry), bytes.NewReader(content)); err != nil {
+			t.Fatalf("push %s: %v", e.name, err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Export it, and unpack each exported blob to its own layer.
+	var layers []string
+	for _, blob := range exportEntries(t, unpacked) {
+		layer := t.TempDir()
+		s := New(layer)
+		for i := len(layers) - 1; i >= 0; i-- {
+			s.LowerDirs = append(s.LowerDirs, layers[i])
+		}
+		if err := s.Push(context.Background(), blob.desc, bytes.NewReader(blob.content)); err != nil {
+			t.Fatalf("push %s: %v", blob.desc.Annotations[ocispec.AnnotationTitle], err)
+		}
+		if err := s.Close(); err != nil {
+			t.Fatal(err)
+		}
+		layers = append(layers, layer)
+	}
+
+	// The overlay of the layers matches the unpacked collection.
+	for _, e := range collection {
+		want, err := os.Lstat(filepath.Join(unpacked, e.name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := topmost(t, layers, e.name)
+		got, err := os.Lstat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Mode() != want.Mode() {
+			t.Errorf("%s mode = %v, want %v", e.name, got.Mode(), want.Mode())
+		}
+		switch {
+		case want.Mode().IsRegular():
+			wantContent, err := os.ReadFile(filepath.Join(unpacked, e.name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			content, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(content, wantContent) {
+				t.Errorf("%s content = %q, want %q", e.name, content, wantContent)
+			}
+		case want.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if link != e.entry.Linkname {
+				t.Errorf("%s link = %s, want %s", e.name, link, e.entry.Linkname)
+			}
+		}
+	}
+
+	// The hard link is preserved.
+	target, err := os.Lstat(topmost(t, layers, "app/bin/tool"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	link, err := os.Lstat(topmost(t, layers, "app/lib/tool"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(target, link) {
+		t.Error("app/lib/tool is not a hard link to app/bin/tool")
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package file
+
+import (
+	"os"
+)
+
+// mknod creates a device node or FIFO at the path.
+func mknod(path, entryType string, permissions os.FileMode, major, minor int64) error {
+	return errMknodNotSupported
+}
+
+// deviceNumbers returns the major and minor numbers of a device node.
+func deviceNumbers(info os.FileInfo) (int64, int64, bool) {
+	return 0, 0, false
+}
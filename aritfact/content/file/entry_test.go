@@ -0,0 +1,90 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	uorspec "github.com/uor-framework/collection-spec/specs-go/v1alpha1"
+
+	"github.com/jpower432/runc-attribute-wrapper/aritfact/spec"
+)
+
+// pushLayer pushes the content to a new store in its own directory, as
+// a blob unpacked to its own snapshot, and returns the directory.
+func pushLayer(t *testing.T, lowers []string, name string, content []byte, file *uorspec.File, entry spec.File) (string, error) {
+	t.Helper()
+	dir := t.TempDir()
+	s := New(dir)
+	s.LowerDirs = lowers
+	defer s.Close()
+	desc := entryDescriptor(t, name, content, file, entry)
+	return dir, s.Push(context.Background(), desc, bytes.NewReader(content))
+}
+
+func TestPushHardlinkAcrossLayers(t *testing.T) {
+	content := []byte("root:x:0:0::/root:/bin/sh\n")
+	file := &uorspec.File{Permissions: 0604, UID: -1, GID: -1}
+	lower, err := pushLayer(t, nil, "etc/passwd", content, file, spec.File{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(lower, "etc"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	link := spec.File{Type: spec.FileTypeHardlink, Linkname: "etc/passwd"}
+
+	// Without the lower directories, the target is not found.
+	if _, err := pushLayer(t, nil, "etc/passwd-", nil, nil, link); err == nil || !strings.Contains(err.Error(), "lower directories") {
+		t.Fatalf("hard link to an earlier layer error = %v", err)
+	}
+
+	// An empty layer between the target and the link.
+	empty := t.TempDir()
+	upper, err := pushLayer(t, []string{empty, lower}, "etc/passwd-", nil, nil, link)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The target is copied up and linked in the upper directory.
+	target, linked := filepath.Join(upper, "etc", "passwd"), filepath.Join(upper, "etc", "passwd-")
+	got, err := os.ReadFile(linked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("linked content = %q, want %q", got, content)
+	}
+	targetInfo, err := os.Stat(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	linkedInfo, err := os.Stat(linked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(targetInfo, linkedInfo) {
+		t.Error("link does not share the inode of the copied up target")
+	}
+	if targetInfo.Mode().Perm() != 0604 {
+		t.Errorf("copied up mode = %v, want %v", targetInfo.Mode().Perm(), os.FileMode(0604))
+	}
+	dirInfo, err := os.Stat(filepath.Join(upper, "etc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dirInfo.Mode().Perm() != 0700 {
+		t.Errorf("copied up directory mode = %v, want %v", dirInfo.Mode().Perm(), os.FileMode(0700))
+	}
+	// The lower directory is not modified.
+	lowerInfo, err := os.Stat(filepath.Join(lower, "etc", "passwd"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if os.SameFile(lowerInfo, targetInfo) {
+		t.Error("link shares the inode of the lower directory entry")
+	}
+}
@@ -0,0 +1,131 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrExtractLimitExceeded is returned when a directory
+// blob exceeds the extraction limits of the store.
+var ErrExtractLimitExceeded = errors.New("extraction limit exceeded")
+
+// ExtractLimits bounds the content extracted from a directory blob.
+// A zero value disables the corresponding limit.
+type ExtractLimits struct {
+	// Size is the maximum total size in bytes of the extracted files.
+	Size int64
+	// Entries is the maximum number of entries in the tarball.
+	Entries int
+	// Depth is the maximum number of path components of an entry.
+	Depth int
+}
+
+// DefaultExtractLimits are the extraction limits of new stores.
+var DefaultExtractLimits = ExtractLimits{
+	Size:    1 << 34, // 16 GiB
+	Entries: 1 << 20,
+	Depth:   256,
+}
+
+// extractOptions configures the extraction of a directory blob.
+type extractOptions struct {
+	// epoch clamps the times of extracted entries, if set.
+	epoch time.Time
+	// limits bounds the extracted content.
+	limits ExtractLimits
+	// ownership determines the owner of extracted entries.
+	ownership ownershipPolicy
+}
+
+// extractRoot creates the entries of an extracted directory. Names are
+// relative to the root and have been checked lexically. Implementations must
+// not follow symbolic links in any component of the name.
+type extractRoot interface {
+	writeFile(name string, r io.Reader, perm os.FileMode, buf []byte) error
+	mkdirAll(name string, perm os.FileMode) error
+	symlink(target, name string) error
+	link(oldname, name string) error
+	mknod(name, entryType string, perm os.FileMode, major, minor int64) error
+	setxattr(name, attr string, value []byte) error
+	lchown(name string, uid, gid int) error
+	chmod(name string, perm os.FileMode) error
+	lchtimes(name string, atime, mtime time.Time) error
+	close() error
+}
+
+// setOwner changes the owner of an extracted entry according to the
+// ownership policy. The setuid and setgid bits of regular files, which
+// are cleared by the change, are restored.
+func setOwner(root extractRoot, name string, mode os.FileMode, policy ownershipPolicy, uid, gid int) error {
+	if !policy.enabled() {
+		return nil
+	}
+	uid, gid, err := policy.owner(uid, gid)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if err := root.lchown(name, uid, gid); err != nil {
+		return err
+	}
+	if mode.IsRegular() && mode&(os.ModeSetuid|os.ModeSetgid) != 0 {
+		return root.chmod(name, mode)
+	}
+	return nil
+}
+
+// pathRoot is an extractRoot using paths for platforms without
+// openat2. Parent directories are checked for symbolic links by
+// ensureBasePath before the entries are created.
+type pathRoot struct {
+	dir string
+}
+
+var _ extractRoot = &pathRoot{}
+
+func (r *pathRoot) path(name string) string {
+	return filepath.Join(r.dir, name)
+}
+
+func (r *pathRoot) writeFile(name string, content io.Reader, perm os.FileMode, buf []byte) error {
+	return writeFile(r.path(name), content, perm, buf)
+}
+
+func (r *pathRoot) mkdirAll(name string, perm os.FileMode) error {
+	return os.MkdirAll(r.path(name), perm)
+}
+
+func (r *pathRoot) symlink(target, name string) error {
+	return os.Symlink(target, r.path(name))
+}
+
+func (r *pathRoot) link(oldname, name string) error {
+	return os.Link(r.path(oldname), r.path(name))
+}
+
+func (r *pathRoot) mknod(name, entryType string, perm os.FileMode, major, minor int64) error {
+	return mknod(r.path(name), entryType, perm, major, minor)
+}
+
+func (r *pathRoot) setxattr(name, attr string, value []byte) error {
+	return lsetxattr(r.path(name), attr, value)
+}
+
+func (r *pathRoot) lchown(name string, uid, gid int) error {
+	return os.Lchown(r.path(name), uid, gid)
+}
+
+func (r *pathRoot) chmod(name string, perm os.FileMode) error {
+	return os.Chmod(r.path(name), perm)
+}
+
+func (r *pathRoot) lchtimes(name string, atime, mtime time.Time) error {
+	return lchtimes(r.path(name), atime, mtime)
+}
+
+func (r *pathRoot) close() error {
+	return nil
+}
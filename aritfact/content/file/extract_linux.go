@@ -0,0 +1,220 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// oNoFollow prevents following a symbolic link when opening a file.
+const oNoFollow = unix.O_NOFOLLOW
+
+// resolveBeneath confines path resolution to the root
+// directory and rejects symbolic links in any component.
+const resolveBeneath = unix.RESOLVE_BENEATH | unix.RESOLVE_NO_SYMLINKS | unix.RESOLVE_NO_MAGICLINKS
+
+// fdRoot is an extractRoot resolving names with openat2
+// relative to a file descriptor of the root directory.
+type fdRoot struct {
+	fd  int
+	dir string
+}
+
+var _ extractRoot = &fdRoot{}
+
+// openExtractRoot opens the directory for extraction. Paths are used
+// if openat2 is not available (Linux < 5.6 or blocked by seccomp).
+func openExtractRoot(dir string) (extractRoot, error) {
+	fd, err := unix.Openat2(unix.AT_FDCWD, dir, &unix.OpenHow{
+		Flags: unix.O_PATH | unix.O_DIRECTORY | unix.O_CLOEXEC,
+	})
+	if err != nil {
+		if errors.Is(err, unix.ENOSYS) || errors.Is(err, unix.EPERM) {
+			return &pathRoot{dir: dir}, nil
+		}
+		return nil, &os.PathError{Op: "openat2", Path: dir, Err: err}
+	}
+	return &fdRoot{fd: fd, dir: dir}, nil
+}
+
+// open opens the name beneath the directory file descriptor.
+func (r *fdRoot) open(dirfd int, name string, flags int, mode uint32) (int, error) {
+	how := &unix.OpenHow{
+		Flags:   uint64(flags | unix.O_CLOEXEC),
+		Mode:    uint64(mode),
+		Resolve: resolveBeneath,
+	}
+	for {
+		fd, err := unix.Openat2(dirfd, name, how)
+		// EAGAIN is returned if the resolution raced with a rename.
+		if errors.Is(err, unix.EINTR) || errors.Is(err, unix.EAGAIN) {
+			continue
+		}
+		if err != nil {
+			return -1, &os.PathError{Op: "openat2", Path: filepath.Join(r.dir, name), Err: err}
+		}
+		return fd, nil
+	}
+}
+
+// parent opens the parent directory of the name,
+// returning its file descriptor and the base name.
+func (r *fdRoot) parent(name string) (int, string, error) {
+	fd, err := r.open(r.fd, filepath.Dir(name), unix.O_PATH|unix.O_DIRECTORY, 0)
+	if err != nil {
+		return -1, "", err
+	}
+	return fd, filepath.Base(name), nil
+}
+
+func (r *fdRoot) writeFile(name string, content io.Reader, perm os.FileMode, buf []byte) (err error) {
+	// An existing entry is replaced, not written through: it may be
+	// a FIFO blocking the open, a device node or a hard link.
+	dirfd, base, err := r.parent(name)
+	if err != nil {
+		return err
+	}
+	err = unix.Unlinkat(dirfd, base, 0)
+	unix.Close(dirfd)
+	if err != nil && !errors.Is(err, unix.ENOENT) {
+		return &os.PathError{Op: "unlinkat", Path: filepath.Join(r.dir, name), Err: err}
+	}
+	fd, err := r.open(r.fd, name, unix.O_WRONLY|unix.O_CREAT|unix.O_EXCL|unix.O_NOFOLLOW, unixMode(perm))
+	if err != nil {
+		return err
+	}
+	file := os.NewFile(uintptr(fd), filepath.Join(r.dir, name))
+	defer func() {
+		closeErr := file.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	_, err = io.CopyBuffer(file, content, buf)
+	return err
+}
+
+func (r *fdRoot) mkdirAll(name string, perm os.FileMode) error {
+	dirfd, err := unix.Dup(r.fd)
+	if err != nil {
+		return err
+	}
+	for _, elem := range strings.Split(filepath.ToSlash(filepath.Clean(name)), "/") {
+		if elem == "." {
+			continue
+		}
+		if err := unix.Mkdirat(dirfd, elem, unixMode(perm)); err != nil && !errors.Is(err, unix.EEXIST) {
+			unix.Close(dirfd)
+			return &os.PathError{Op: "mkdirat", Path: filepath.Join(r.dir, name), Err: err}
+		}
+		next, err := r.open(dirfd, elem, unix.O_PATH|unix.O_DIRECTORY|unix.O_NOFOLLOW, 0)
+		unix.Close(dirfd)
+		if err != nil {
+			return err
+		}
+		dirfd = next
+	}
+	return unix.Close(dirfd)
+}
+
+func (r *fdRoot) symlink(target, name string) error {
+	dirfd, base, err := r.parent(name)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(dirfd)
+	if err := unix.Symlinkat(target, dirfd, base); err != nil {
+		return &os.LinkError{Op: "symlinkat", Old: target, New: filepath.Join(r.dir, name), Err: err}
+	}
+	return nil
+}
+
+func (r *fdRoot) link(oldname, name string) error {
+	olddirfd, oldbase, err := r.parent(oldname)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(olddirfd)
+	dirfd, base, err := r.parent(name)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(dirfd)
+	if err := unix.Linkat(olddirfd, oldbase, dirfd, base, 0); err != nil {
+		return &os.LinkError{Op: "linkat", Old: filepath.Join(r.dir, oldname), New: filepath.Join(r.dir, name), Err: err}
+	}
+	return nil
+}
+
+func (r *fdRoot) mknod(name, entryType string, perm os.FileMode, major, minor int64) error {
+	dirfd, base, err := r.parent(name)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(dirfd)
+	if err := unix.Mknodat(dirfd, base, mknodMode(entryType, perm), mkdev(major, minor)); err != nil {
+		return &os.PathError{Op: "mknodat", Path: filepath.Join(r.dir, name), Err: err}
+	}
+	return nil
+}
+
+func (r *fdRoot) setxattr(name, attr string, value []byte) error {
+	fd, err := r.open(r.fd, name, unix.O_PATH|unix.O_NOFOLLOW, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+	// Extended attributes cannot be set with an O_PATH file
+	// descriptor, but can through its procfs magic link.
+	if err := unix.Setxattr(fmt.Sprintf("/proc/self/fd/%d", fd), attr, value, 0); err != nil {
+		return &os.PathError{Op: "setxattr", Path: filepath.Join(r.dir, name), Err: err}
+	}
+	return nil
+}
+
+func (r *fdRoot) lchown(name string, uid, gid int) error {
+	dirfd, base, err := r.parent(name)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(dirfd)
+	if err := unix.Fchownat(dirfd, base, uid, gid, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+		return &os.PathError{Op: "fchownat", Path: filepath.Join(r.dir, name), Err: err}
+	}
+	return nil
+}
+
+func (r *fdRoot) chmod(name string, perm os.FileMode) error {
+	fd, err := r.open(r.fd, name, unix.O_PATH|unix.O_NOFOLLOW, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+	// The mode cannot be changed with an O_PATH file
+	// descriptor, but can through its procfs magic link.
+	if err := unix.Chmod(fmt.Sprintf("/proc/self/fd/%d", fd), unixMode(perm)); err != nil {
+		return &os.PathError{Op: "chmod", Path: filepath.Join(r.dir, name), Err: err}
+	}
+	return nil
+}
+
+func (r *fdRoot) lchtimes(name string, atime, mtime time.Time) error {
+	dirfd, base, err := r.parent(name)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(dirfd)
+	ts := []unix.Timespec{timespec(atime), timespec(mtime)}
+	return unix.UtimesNanoAt(dirfd, base, ts, unix.AT_SYMLINK_NOFOLLOW)
+}
+
+func (r *fdRoot) close() error {
+	return unix.Close(r.fd)
+}
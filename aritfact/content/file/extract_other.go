@@ -0,0 +1,12 @@
+//go:build !linux
+
+package file
+
+// oNoFollow is not supported on all platforms, paths
+// are checked for symbolic links before opening.
+const oNoFollow = 0
+
+// openExtractRoot opens the directory for extraction.
+func openExtractRoot(dir string) (extractRoot, error) {
+	return &pathRoot{dir: dir}, nil
+}
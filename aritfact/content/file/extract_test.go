@@ -0,0 +1,493 @@
+package file
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// extractPrefix is the name of the extracted directory blobs in the tests.
+const extractPrefix = "app"
+
+// testLimits are small extraction limits for the tests.
+var testLimits = ExtractLimits{Size: 64, Entries: 8, Depth: 4}
+
+// tarEntry is an entry of a generated tarball.
+type tarEntry struct {
+	header  tar.Header
+	content string
+}
+
+func regEntry(name, content string) tarEntry {
+	return tarEntry{header: tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0644, Size: int64(len(content))}, content: content}
+}
+
+func dirEntry(name string) tarEntry {
+	return tarEntry{header: tar.Header{Typeflag: tar.TypeDir, Name: name, Mode: 0755}}
+}
+
+func linkEntry(typeflag byte, name, linkname string) tarEntry {
+	return tarEntry{header: tar.Header{Typeflag: typeflag, Name: name, Linkname: linkname, Mode: 0777}}
+}
+
+// tarball returns a tarball of the entries.
+func tarball(t testing.TB, entries ...tarEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, entry := range entries {
+		header := entry.header
+		if err := tw.WriteHeader(&header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(entry.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// zipEntry is an entry of a generated zip archive.
+type zipEntry struct {
+	name    string
+	mode    os.FileMode
+	content string
+}
+
+// zipArchive writes a zip archive of the entries and returns its path.
+func zipArchive(t testing.TB, entries ...zipEntry) string {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry.name, Method: zip.Store}
+		header.SetMode(entry.mode)
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(entry.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return writeArchive(t, buf.Bytes())
+}
+
+// writeArchive writes the archive to a temporary file and returns its path.
+func writeArchive(t testing.TB, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "archive.zip")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// extractDirs returns the extraction directory and a sibling directory
+// holding a sentinel file, which must not be modified or linked by the
+// extraction.
+func extractDirs(t testing.TB) (dir, outside string) {
+	t.Helper()
+	parent := t.TempDir()
+	dir, outside = filepath.Join(parent, "root"), filepath.Join(parent, "outside")
+	for _, d := range []string{dir, outside} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return dir, outside
+}
+
+// checkOutside fails the test if the extraction escaped from the
+// directory to the outside directory, or hard linked its sentinel file.
+func checkOutside(t testing.TB, dir, outside string) {
+	t.Helper()
+	entries, err := os.ReadDir(outside)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "secret" {
+		t.Fatalf("extraction wrote outside of the directory: %v", entries)
+	}
+	secret, err := os.Stat(filepath.Join(outside, "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err = os.ReadDir(filepath.Dir(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("extraction wrote next to the directory: %v", entries)
+	}
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if os.SameFile(info, secret) {
+			t.Fatalf("extraction hard linked %s to a file outside of the directory", path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// checkFile fails the test unless the file at the path has the content.
+func checkFile(t *testing.T, path, content string) {
+	t.Helper()
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != content {
+		t.Errorf("%s = %q, want %q", path, got, content)
+	}
+}
+
+func TestExtractTarDirectory(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries func(outside string) []tarEntry
+		// wantErr is the expected error, or errAny for any error.
+		wantErr error
+		check   func(t *testing.T, dir string)
+	}{
+		{
+			name: "entries",
+			entries: func(string) []tarEntry {
+				return []tarEntry{
+					dirEntry("app/"),
+					dirEntry("app/bin/"),
+					regEntry("app/bin/tool", "tool"),
+					linkEntry(tar.TypeSymlink, "app/lib", "bin"),
+					linkEntry(tar.TypeLink, "app/tool", "app/bin/tool"),
+				}
+			},
+			check: func(t *testing.T, dir string) {
+				checkFile(t, filepath.Join(dir, "bin", "tool"), "tool")
+				if target, err := os.Readlink(filepath.Join(dir, "lib")); err != nil || target != "bin" {
+					t.Errorf("symbolic link target = %q, %v", target, err)
+				}
+				a, err := os.Stat(filepath.Join(dir, "bin", "tool"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				b, err := os.Stat(filepath.Join(dir, "tool"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !os.SameFile(a, b) {
+					t.Error("hard link does not share the inode")
+				}
+			},
+		},
+		{
+			name: "zip slip",
+			entries: func(string) []tarEntry {
+				return []tarEntry{regEntry("app/../../evil", "evil")}
+			},
+			wantErr: errAny,
+		},
+		{
+			name: "absolute name",
+			entries: func(outside string) []tarEntry {
+				return []tarEntry{regEntry(filepath.Join(outside, "evil"), "evil")}
+			},
+			wantErr: errAny,
+		},
+		{
+			name: "symbolic link escape",
+			entries: func(string) []tarEntry {
+				return []tarEntry{linkEntry(tar.TypeSymlink, "app/link", "../../outside")}
+			},
+			wantErr: errAny,
+		},
+		{
+			name: "write through absolute symbolic link",
+			entries: func(outside string) []tarEntry {
+				// Absolute targets are resolved in the container
+				// root, but are never followed by the extraction.
+				return []tarEntry{
+					linkEntry(tar.TypeSymlink, "app/link", outside),
+					regEntry("app/link/evil", "evil"),
+				}
+			},
+			wantErr: errAny,
+		},
+		{
+			name: "write through relative symbolic link",
+			entries: func(string) []tarEntry {
+				return []tarEntry{
+					dirEntry("app/sub/"),
+					linkEntry(tar.TypeSymlink, "app/link", "sub"),
+					regEntry("app/link/file", "file"),
+				}
+			},
+			wantErr: errAny,
+		},
+		{
+			name: "hard link escape",
+			entries: func(string) []tarEntry {
+				return []tarEntry{linkEntry(tar.TypeLink, "app/secret", "../outside/secret")}
+			},
+			wantErr: errAny,
+		},
+		{
+			name: "absolute hard link",
+			entries: func(outside string) []tarEntry {
+				return []tarEntry{linkEntry(tar.TypeLink, "app/secret", filepath.Join(outside, "secret"))}
+			},
+			wantErr: errAny,
+		},
+		{
+			name: "file replacing a fifo",
+			entries: func(string) []tarEntry {
+				// Opening the FIFO for writing would block.
+				return []tarEntry{
+					{header: tar.Header{Typeflag: tar.TypeFifo, Name: "app/file", Mode: 0644}},
+					regEntry("app/file", "file"),
+				}
+			},
+			check: func(t *testing.T, dir string) {
+				checkFile(t, filepath.Join(dir, "file"), "file")
+			},
+		},
+		{
+			name: "file replacing a hard link",
+			entries: func(string) []tarEntry {
+				return []tarEntry{
+					regEntry("app/a", "a"),
+					linkEntry(tar.TypeLink, "app/b", "app/a"),
+					regEntry("app/b", "b"),
+				}
+			},
+			check: func(t *testing.T, dir string) {
+				checkFile(t, filepath.Join(dir, "a"), "a")
+				checkFile(t, filepath.Join(dir, "b"), "b")
+			},
+		},
+		{
+			name: "size bomb",
+			entries: func(string) []tarEntry {
+				return []tarEntry{regEntry("app/big", string(make([]byte, testLimits.Size+1)))}
+			},
+			wantErr: ErrExtractLimitExceeded,
+		},
+		{
+			name: "size across files",
+			entries: func(string) []tarEntry {
+				half := string(make([]byte, testLimits.Size/2+1))
+				return []tarEntry{regEntry("app/a", half), regEntry("app/b", half)}
+			},
+			wantErr: ErrExtractLimitExceeded,
+		},
+		{
+			name: "entry count bomb",
+			entries: func(string) []tarEntry {
+				var entries []tarEntry
+				for i := 0; i <= testLimits.Entries; i++ {
+					entries = append(entries, regEntry(filepath.Join("app", string(rune('a'+i))), ""))
+				}
+				return entries
+			},
+			wantErr: ErrExtractLimitExceeded,
+		},
+		{
+			name: "depth",
+			entries: func(string) []tarEntry {
+				return []tarEntry{regEntry("app/a/b/c/d/e", "deep")}
+			},
+			wantErr: ErrExtractLimitExceeded,
+		},
+		{
+			name: "within limits",
+			entries: func(string) []tarEntry {
+				return []tarEntry{
+					dirEntry("app/a/"),
+					dirEntry("app/a/b/"),
+					dirEntry("app/a/b/c/"),
+					regEntry("app/a/b/c/d", string(make([]byte, testLimits.Size))),
+				}
+			},
+			check: func(t *testing.T, dir string) {
+				checkFile(t, filepath.Join(dir, "a", "b", "c", "d"), string(make([]byte, testLimits.Size)))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, outside := extractDirs(t)
+			data := tarball(t, tt.entries(outside)...)
+			opts := extractOptions{limits: testLimits}
+			err := extractTarDirectory(dir, extractPrefix, bytes.NewReader(data), opts, make([]byte, 32*1024))
+			checkExtractErr(t, err, tt.wantErr)
+			checkOutside(t, dir, outside)
+			if tt.check != nil && err == nil {
+				tt.check(t, dir)
+			}
+		})
+	}
+}
+
+func TestExtractZipDirectory(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries func(outside string) []zipEntry
+		wantErr error
+		check   func(t *testing.T, dir string)
+	}{
+		{
+			name: "entries",
+			entries: func(string) []zipEntry {
+				return []zipEntry{
+					{name: "app/", mode: os.ModeDir | 0755},
+					{name: "app/bin/", mode: os.ModeDir | 0755},
+					{name: "app/bin/tool", mode: 0755, content: "tool"},
+					{name: "app/lib", mode: os.ModeSymlink | 0777, content: "bin"},
+				}
+			},
+			check: func(t *testing.T, dir string) {
+				checkFile(t, filepath.Join(dir, "bin", "tool"), "tool")
+				if target, err := os.Readlink(filepath.Join(dir, "lib")); err != nil || target != "bin" {
+					t.Errorf("symbolic link target = %q, %v", target, err)
+				}
+			},
+		},
+		{
+			name: "zip slip",
+			entries: func(string) []zipEntry {
+				return []zipEntry{{name: "app/../../evil", mode: 0644, content: "evil"}}
+			},
+			wantErr: errAny,
+		},
+		{
+			name: "symbolic link escape",
+			entries: func(string) []zipEntry {
+				return []zipEntry{{name: "app/link", mode: os.ModeSymlink | 0777, content: "../../outside"}}
+			},
+			wantErr: errAny,
+		},
+		{
+			name: "write through absolute symbolic link",
+			entries: func(outside string) []zipEntry {
+				return []zipEntry{
+					{name: "app/link", mode: os.ModeSymlink | 0777, content: outside},
+					{name: "app/link/evil", mode: 0644, content: "evil"},
+				}
+			},
+			wantErr: errAny,
+		},
+		{
+			name: "size bomb",
+			entries: func(string) []zipEntry {
+				return []zipEntry{{name: "app/big", mode: 0644, content: string(make([]byte, testLimits.Size+1))}}
+			},
+			wantErr: ErrExtractLimitExceeded,
+		},
+		{
+			name: "entry count bomb",
+			entries: func(string) []zipEntry {
+				var entries []zipEntry
+				for i := 0; i <= testLimits.Entries; i++ {
+					entries = append(entries, zipEntry{name: filepath.Join("app", string(rune('a'+i))), mode: 0644})
+				}
+				return entries
+			},
+			wantErr: ErrExtractLimitExceeded,
+		},
+		{
+			name: "depth",
+			entries: func(string) []zipEntry {
+				return []zipEntry{{name: "app/a/b/c/d/e", mode: 0644, content: "deep"}}
+			},
+			wantErr: ErrExtractLimitExceeded,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, outside := extractDirs(t)
+			archive := zipArchive(t, tt.entries(outside)...)
+			opts := extractOptions{limits: testLimits}
+			err := extractZipDirectory(dir, extractPrefix, archive, opts, make([]byte, 32*1024))
+			checkExtractErr(t, err, tt.wantErr)
+			checkOutside(t, dir, outside)
+			if tt.check != nil && err == nil {
+				tt.check(t, dir)
+			}
+		})
+	}
+}
+
+// errAny matches any extraction error.
+var errAny = errors.New("any error")
+
+// checkExtractErr fails the test unless the error matches the expected one.
+func checkExtractErr(t *testing.T, err, want error) {
+	t.Helper()
+	switch {
+	case want == nil && err != nil:
+		t.Fatalf("extraction failed: %v", err)
+	case want == errAny && err == nil, want != nil && want != errAny && !errors.Is(err, want):
+		t.Fatalf("extraction error = %v, want %v", err, want)
+	}
+}
+
+// fuzzLimits bound the fuzzed extractions.
+var fuzzLimits = ExtractLimits{Size: 1 << 20, Entries: 64, Depth: 16}
+
+func FuzzExtractTarDirectory(f *testing.F) {
+	outside := "/tmp/outside"
+	for _, entries := range [][]tarEntry{
+		{dirEntry("app/"), regEntry("app/file", "file")},
+		{regEntry("app/../../evil", "evil")},
+		{linkEntry(tar.TypeSymlink, "app/link", outside), regEntry("app/link/evil", "evil")},
+		{linkEntry(tar.TypeLink, "app/secret", "../outside/secret")},
+		{linkEntry(tar.TypeSymlink, "app/up", ".."), linkEntry(tar.TypeLink, "app/secret", "app/up/outside/secret")},
+		{{header: tar.Header{Typeflag: tar.TypeFifo, Name: "app/fifo", Mode: 0644}}, regEntry("app/fifo", "fifo")},
+	} {
+		f.Add(tarball(f, entries...))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		dir, outside := extractDirs(t)
+		opts := extractOptions{limits: fuzzLimits}
+		// Malformed archives fail, but must never escape the directory.
+		extractTarDirectory(dir, extractPrefix, bytes.NewReader(data), opts, make([]byte, 32*1024)) //nolint:errcheck
+		checkOutside(t, dir, outside)
+	})
+}
+
+func FuzzExtractZipDirectory(f *testing.F) {
+	for _, entries := range [][]zipEntry{
+		{{name: "app/", mode: os.ModeDir | 0755}, {name: "app/file", mode: 0644, content: "file"}},
+		{{name: "app/../../evil", mode: 0644, content: "evil"}},
+		{{name: "app/link", mode: os.ModeSymlink | 0777, content: ".."}, {name: "app/link/evil", mode: 0644}},
+	} {
+		data, err := os.ReadFile(zipArchive(f, entries...))
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		dir, outside := extractDirs(t)
+		archive := writeArchive(t, data)
+		opts := extractOptions{limits: fuzzLimits}
+		extractZipDirectory(dir, extractPrefix, archive, opts, make([]byte, 32*1024)) //nolint:errcheck
+		checkOutside(t, dir, outside)
+	})
+}
@@ -1,8 +1,9 @@
 package file
 
 import (
-	"compress/gzip"
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -11,6 +12,7 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/opencontainers/go-digest"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
@@ -23,9 +25,11 @@ import (
 	"github.com/uor-framework/uor-client-go/content"
 	"github.com/uor-framework/uor-client-go/nodes/collection"
 	"github.com/uor-framework/uor-client-go/nodes/collection/loader"
+	"github.com/uor-framework/uor-client-go/nodes/descriptor"
 	v2 "github.com/uor-framework/uor-client-go/nodes/descriptor/v2"
 
 	"github.com/jpower432/runc-attribute-wrapper/aritfact/content/file/internal/ioutil"
+	"github.com/jpower432/runc-attribute-wrapper/aritfact/spec"
 )
 
 // This a modified version of the oras `file.Store`. Most changes are localized to the
@@ -65,8 +69,10 @@ const (
 // by file paths. Meanwhile, the file paths are mapped to a virtual CAS
 // where all metadata are stored in the memory.
 // Any files without a name will be ignored.
-// As all the metadata are stored in the memory, the file store
-// cannot be restored from the file system.
+// By default, all the metadata are stored in the memory and the file store
+// cannot be restored from the file system. A store created with `NewWithIndex`
+// also persists its metadata to an index file when it is closed, and can be
+// reopened over previously pushed content.
 // After use, the file store needs to be closed by calling the `Close()` function.
 // The file store cannot be used after being closed.
 type Store struct {
@@ -75,6 +81,10 @@ type Store struct {
 	// When specified, some metadata such as change time
 	// will be stripped from the files in the tarballs. Default value: false.
 	TarReproducible bool
+	// TarPreserveOwnership controls if the tarballs generated for the added
+	// directories store the user and group ids of the files. Otherwise, the
+	// files are owned by root. Default value: false.
+	TarPreserveOwnership bool
 	// AllowPathTraversalOnWrite controls if path traversal is allowed
 	// when writing files. When specified, writing files
 	// outside the working directory will be allowed. Default value: false.
@@ -99,6 +109,38 @@ type Store struct {
 	// manifest and config file, while leaving only named layer files.
 	// Default value: false.
 	IgnoreNoName bool
+	// SourceDateEpoch is the default modification and access time of pushed
+	// entries, following the SOURCE_DATE_EPOCH convention for reproducible
+	// builds. When specified, directories modified by push operations are
+	// reset to it and times of extracted tar entries are clamped to it, so
+	// the same content always produces the same file system metadata.
+	// Default value: zero, write times are kept.
+	SourceDateEpoch time.Time
+	// ExtractLimits bounds the size, number of entries and path depth of
+	// extracted directory blobs. Default value: DefaultExtractLimits.
+	ExtractLimits ExtractLimits
+	// Dedupe controls if pushed files share storage with the blobs of the
+	// content store at ContentRoot instead of copying the content. Files
+	// are copied when the blob is missing, does not match its digest, is on
+	// another file system, or the file system does not support reflinks.
+	// Default value: DedupeNone.
+	Dedupe DedupeMode
+	// ContentRoot is the root directory of a local content store, laid out
+	// as blobs/<algorithm>/<encoded>. Only used when Dedupe is specified.
+	ContentRoot string
+	// LowerDirs are the read-only lower directories of a layered mount whose
+	// upper directory is the working directory, from the topmost. Hard links
+	// to entries missing in the working directory are resolved through them,
+	// and the linked file is copied up first, as overlayfs does. The parent
+	// directories of pushed content are also copied up from them, so they
+	// keep the metadata of the lower directories. Overlay whiteouts and
+	// opaque directories are honored.
+	// Default value: nil, hard links must target the working directory.
+	LowerDirs []string
+	// TempDir is the directory of the temporary files used by the store,
+	// such as archives generated for added directories and zip archives
+	// buffered before extraction. Default value: the system temp directory.
+	TempDir string
 
 	workingDir   string   // the working directory of the file store
 	closed       int32    // if the store is closed - 0: false, 1: true.
@@ -110,6 +152,11 @@ type Store struct {
 	graph           *collection.Collection
 	fallbackStorage orascontent.Storage
 	mu              sync.Mutex
+
+	indexPath string   // the path of the on-disk index, if enabled
+	dirTimes  sync.Map // map[string]entryTimes
+	extracted sync.Map // map[digest.Digest]bool
+	inodes    sync.Map // map[inode]string, the first name added per linked entry
 }
 
 // nameStatus contains a flag indicating if a name exists,
@@ -141,6 +188,7 @@ func NewWithFallbackLimit(workingDir string, limit int64) *Store {
 // using the provided fallback storage for contents without names.
 func NewWithFallbackStorage(workingDir string, fallbackStorage orascontent.Storage) *Store {
 	return &Store{
+		ExtractLimits:   DefaultExtractLimits,
 		workingDir:      workingDir,
 		fallbackStorage: fallbackStorage,
 		resolver:        sync.Map{},
@@ -149,6 +197,7 @@ func NewWithFallbackStorage(workingDir string, fallbackStorage orascontent.Stora
 }
 
 // Close closes the file store and cleans up all the temporary files used by it.
+// If the store has an index, the metadata is saved to it first.
 // The store cannot be used after being closed.
 // This function is not go-routine safe.
 func (s *Store) Close() error {
@@ -158,6 +207,11 @@ func (s *Store) Close() error {
 	s.setClosed()
 
 	var errs []string
+	s.mu.Lock()
+	if err := s.saveIndex(); err != nil {
+		errs = append(errs, fmt.Sprintf("failed to save index %s: %v", s.indexPath, err))
+	}
+	s.mu.Unlock()
 	s.tmpFiles.Range(func(name, _ interface{}) bool {
 		if err := os.Remove(name.(string)); err != nil {
 			errs = append(errs, err.Error())
@@ -261,25 +315,53 @@ func (s *Store) push(ctx context.Context, expected ocispec.Descriptor, content i
 		return fmt.Errorf("failed to resolve path for writing: %w", err)
 	}
 
+	needUnpack := expected.Annotations[file.AnnotationUnpack] == "true"
+	var entry spec.File
+	if _, err := spec.Decode(expected.Annotations, spec.SchemaFile, &entry); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	regular := entry.Type == "" || entry.Type == spec.FileTypeRegular
+	if needUnpack && !regular {
+		return fmt.Errorf("%s: entry type %q cannot be unpacked", name, entry.Type)
+	}
+	attrs, err := newExtendedAttributes(entry, regular && !needUnpack)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	var fileInfo uorspec.File
+	node, err := v2.NewNode(expected.Digest.String(), expected)
+	if err != nil {
+		return err
+	}
+	hasFileInfo := node.Properties != nil && node.Properties.HasFileInfo()
+	if hasFileInfo {
+		fileInfo = *node.Properties.File
+	}
+
 	// Preserve tar permissions, but apply set file permissions on individual files.
-	if needUnpack := expected.Annotations[file.AnnotationUnpack]; needUnpack == "true" {
-		err = s.pushDir(name, target, expected, content)
+	if needUnpack {
+		var ownership ownershipPolicy
+		if ownership, err = newOwnershipPolicy(entry, fileInfo, hasFileInfo); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		err = s.pushDir(name, target, expected, attrs, ownership, content)
 	} else {
-
-		var file uorspec.File
-		node, err := v2.NewNode(expected.Digest.String(), expected)
-		if err != nil {
-			return err
+		if entry.Ownership != "" {
+			return fmt.Errorf("%s: ownership policy only applies to directory blobs", name)
 		}
-		if node.Properties != nil && node.Properties.HasFileInfo() {
-			file = *node.Properties.File
+		if regular {
+			err = s.pushFile(target, expected, fileInfo, entry, attrs, content)
+		} else {
+			err = s.pushEntry(ctx, target, expected, fileInfo, entry, attrs, content)
 		}
-
-		err = s.pushFile(target, expected, file, content)
 	}
 	if err != nil {
 		return err
 	}
+	if err := s.setTimes(target, entry); err != nil {
+		return fmt.Errorf("failed to set times of %s: %w", target, err)
+	}
 
 	// update the name status as existed
 	status.exists = true
@@ -337,6 +419,10 @@ func (s *Store) Exists(ctx context.Context, target ocispec.Descriptor) (bool, er
 	if exists {
 		return true, nil
 	}
+	// extracted directories exist, but their content is not kept
+	if _, extracted := s.extracted.Load(target.Digest); extracted {
+		return true, nil
+	}
 
 	// if the content does not exist in the store,
 	// then fall back to the fallback storage.
@@ -384,7 +470,6 @@ func (s *Store) Tag(ctx context.Context, desc ocispec.Descriptor, ref string) er
 	desc.Annotations[ocispec.AnnotationRefName] = ref
 
 	s.resolver.Store(ref, desc)
-
 	return nil
 }
 
@@ -457,6 +542,88 @@ func (s *Store) Add(_ context.Context, name, mediaType, path string) (ocispec.De
 	return desc, nil
 }
 
+// AddEntry adds a file system entry into the file store without following
+// symbolic links or archiving directories, as a named blob described by
+// core-file attributes generated from the mode and owner of the entry.
+// Entries other than regular files are declared with rcl-file attributes
+// and have empty content, so pushing the blob recreates the entry. Entries
+// sharing the inode of an entry added before are declared as hard links to
+// its name, so the blobs must be pushed in the order they were added.
+func (s *Store) AddEntry(ctx context.Context, name, path string) (ocispec.Descriptor, error) {
+	if s.isClosedSet() {
+		return ocispec.Descriptor{}, file.ErrStoreClosed
+	}
+
+	if name == "" {
+		return ocispec.Descriptor{}, file.ErrMissingName
+	}
+
+	// check the status of the name
+	status := s.status(name)
+	status.Lock()
+	defer status.Unlock()
+
+	if status.exists {
+		return ocispec.Descriptor{}, fmt.Errorf("%s: %w", name, file.ErrDuplicateName)
+	}
+
+	if path == "" {
+		path = name
+	}
+	path = s.absPath(path)
+
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return ocispec.Descriptor{}, fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	fileInfo, entry, err := entryAttributes(fi, path)
+	if err != nil {
+		return ocispec.Descriptor{}, fmt.Errorf("failed to generate attributes from %s: %w", path, err)
+	}
+	if id, nlink, ok := fileInode(fi); ok && nlink > 1 && !fi.IsDir() {
+		if linked, loaded := s.inodes.LoadOrStore(id, name); loaded {
+			entry = spec.File{Type: spec.FileTypeHardlink, Linkname: linked.(string)}
+		}
+	}
+
+	var desc ocispec.Descriptor
+	if fi.Mode().IsRegular() && entry.Type == "" {
+		desc, err = s.descriptorFromFile(fi, "", path)
+	} else {
+		desc = ocispec.Descriptor{
+			MediaType: defaultBlobMediaType,
+			Digest:    digest.FromBytes(nil),
+		}
+		err = s.pushEntryContent(ctx, desc, bytes.NewReader(nil))
+	}
+	if err != nil {
+		return ocispec.Descriptor{}, fmt.Errorf("failed to generate descriptor from %s: %w", path, err)
+	}
+
+	attrs := map[string]json.RawMessage{}
+	fileJSON, err := json.Marshal(fileInfo)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	attrs[descriptor.TypeFile] = fileJSON
+	if entry.Type != "" {
+		entryJSON, err := json.Marshal(entry)
+		if err != nil {
+			return ocispec.Descriptor{}, err
+		}
+		attrs[spec.SchemaFile] = entryJSON
+	}
+	desc.Annotations, err = descriptor.AnnotationsFromAttributes(attrs)
+	if err != nil {
+		return ocispec.Descriptor{}, fmt.Errorf("failed to generate attributes from %s: %w", path, err)
+	}
+	desc.Annotations[ocispec.AnnotationTitle] = name
+
+	// update the name status as existed
+	status.exists = true
+	return desc, nil
+}
+
 // saveFile saves content matching the descriptor to the given file.
 func (s *Store) saveFile(fp *os.File, expected ocispec.Descriptor, content io.Reader) (err error) {
 	defer func() {
@@ -478,125 +645,251 @@ func (s *Store) saveFile(fp *os.File, expected ocispec.Descriptor, content io.Re
 }
 
 // pushFile saves content matching the descriptor to the target path.
-func (s *Store) pushFile(target string, expected ocispec.Descriptor, file uorspec.File, content io.Reader) error {
-	if err := ensureDir(filepath.Dir(target)); err != nil {
+// The extended attributes are set after the ownership is changed, since
+// changing the ownership clears the file capabilities.
+// With dedupe enabled, the content store blob is cloned instead of copying
+// the content.
+func (s *Store) pushFile(target string, expected ocispec.Descriptor, file uorspec.File, entry spec.File, attrs extendedAttributes, content io.Reader) error {
+	if err := s.ensureUpperDir(filepath.Dir(target)); err != nil {
 		return fmt.Errorf("failed to ensure directories of the target path: %w", err)
 	}
 
 	permissions := os.FileMode(0640)
 	if file.Permissions != 0 {
-		permissions = os.FileMode(file.Permissions)
+		permissions = fileMode(file.Permissions)
 	}
-	fp, err := os.OpenFile(target, os.O_RDWR|os.O_CREATE, permissions)
-	if err != nil {
-		return fmt.Errorf("failed to create file %s: %w", target, err)
+
+	var cloned bool
+	if s.Dedupe == DedupeReflink {
+		var err error
+		if cloned, err = s.cloneBlob(target, expected, permissions); err != nil {
+			return err
+		}
 	}
-	defer func() {
-		closeErr := fp.Close()
-		if err == nil {
-			err = closeErr
+	if !cloned {
+		fp, err := os.OpenFile(target, os.O_RDWR|os.O_CREATE, permissions)
+		if err != nil {
+			return fmt.Errorf("failed to create file %s: %w", target, err)
 		}
-	}()
 
-	if err := s.saveFile(fp, expected, content); err != nil {
-		return err
+		// the file is closed once saved
+		if err := s.saveFile(fp, expected, content); err != nil {
+			return err
+		}
 	}
 
 	if file.UID != -1 && file.GID != -1 {
-		return os.Chown(target, file.UID, file.GID)
+		if err := os.Chown(target, file.UID, file.GID); err != nil {
+			return err
+		}
+		// Changing the ownership clears the setuid and setgid bits.
+		if permissions&(os.ModeSetuid|os.ModeSetgid) != 0 {
+			if err := os.Chmod(target, permissions); err != nil {
+				return err
+			}
+		}
 	}
 
-	return nil
+	return attrs.apply(target)
 }
 
-// pushDir saves content matching the descriptor to the target directory.
-func (s *Store) pushDir(name, target string, expected ocispec.Descriptor, content io.Reader) (err error) {
-	if err := ensureDir(target); err != nil {
+// pushDir extracts content matching the descriptor to the target directory.
+// The entries are extracted to a staging directory next to the target, and
+// moved to the target once the content is verified and extracted, so a failed
+// push leaves the target as it was. An existing target directory is merged
+// into, and keeps its metadata. Tarballs are extracted while the content is
+// read and verified. Zip archives are buffered to a temporary file before
+// extraction.
+// The extended attributes are set on every extracted entry.
+func (s *Store) pushDir(name, target string, expected ocispec.Descriptor, attrs extendedAttributes, ownership ownershipPolicy, content io.Reader) (err error) {
+	if info, err := os.Lstat(target); err == nil && !info.IsDir() {
+		return fmt.Errorf("failed to ensure directories of the target path: %s is not a directory", target)
+	}
+	parent := filepath.Dir(target)
+	if err := s.ensureUpperDir(parent); err != nil {
 		return fmt.Errorf("failed to ensure directories of the target path: %w", err)
 	}
-
-	gz, err := s.tempFile()
+	// The staging directory is on the file system of the target to be renamed.
+	staging, err := os.MkdirTemp(parent, ".rcl-extract-*")
 	if err != nil {
+		return fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	defer func() {
+		if removeErr := os.RemoveAll(staging); removeErr != nil && err == nil {
+			err = fmt.Errorf("failed to remove %s: %w", staging, removeErr)
+		}
+	}()
+	if err := os.Chmod(staging, 0750); err != nil {
 		return err
 	}
 
-	gzPath := gz.Name()
-	// the digest of the gz is verified while saving
-	if err := s.saveFile(gz, expected, content); err != nil {
-		return fmt.Errorf("failed to save gzip to %s: %w", gzPath, err)
+	opts := extractOptions{
+		epoch:     s.SourceDateEpoch,
+		limits:    s.ExtractLimits,
+		ownership: ownership,
 	}
-
-	checksum := expected.Annotations[file.AnnotationDigest]
 	buf := bufPool.Get().(*[]byte)
 	defer bufPool.Put(buf)
-	if err := extractTarGzip(target, name, gzPath, checksum, *buf); err != nil {
-		return fmt.Errorf("failed to extract tar to %s: %w", target, err)
+	// extracted is set if the content is not kept once extracted.
+	var extracted bool
+	if format := archiveFormatFromMediaType(expected.MediaType); format == formatZip {
+		archive, err := s.tempFile()
+		if err != nil {
+			return err
+		}
+		archivePath := archive.Name()
+		// the digest of the archive is verified while saving
+		if err := s.saveFile(archive, expected, content); err != nil {
+			return fmt.Errorf("failed to save archive to %s: %w", archivePath, err)
+		}
+		if err := extractZipDirectory(staging, name, archivePath, opts, *buf); err != nil {
+			return fmt.Errorf("failed to extract zip to %s: %w", target, err)
+		}
+	} else {
+		vr := orascontent.NewVerifyReader(content, expected)
+		checksum := expected.Annotations[file.AnnotationDigest]
+		if err := extractTarArchive(staging, name, vr, format, checksum, opts, *buf); err != nil {
+			return fmt.Errorf("failed to extract tar to %s: %w", target, err)
+		}
+		// Read any trailing data, so the whole content is verified
+		if _, err := io.CopyBuffer(io.Discard, vr, *buf); err != nil {
+			return fmt.Errorf("failed to read %s: %w", expected.Digest, err)
+		}
+		if err := vr.Verify(); err != nil {
+			return fmt.Errorf("failed to verify %s: %w", expected.Digest, err)
+		}
+		extracted = true
+	}
+
+	if !attrs.empty() {
+		err := filepath.Walk(staging, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			// Extended attributes in the user namespace are not
+			// permitted on symbolic links, only label them.
+			if info.Mode()&os.ModeSymlink != 0 {
+				return extendedAttributes{label: attrs.label}.apply(path)
+			}
+			return attrs.apply(path)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := moveDir(staging, target); err != nil {
+		return fmt.Errorf("failed to move extracted entries to %s: %w", target, err)
+	}
+	if extracted {
+		s.extracted.Store(expected.Digest, true)
 	}
 	return nil
 }
 
+// moveDir moves the directory to the target path. If the target is an
+// existing directory, the entries are moved into it, recursively merging the
+// directories. Other existing entries are replaced.
+func moveDir(src, target string) error {
+	info, err := os.Lstat(target)
+	if err != nil || !info.IsDir() {
+		return replaceEntry(src, target)
+	}
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		srcPath, targetPath := filepath.Join(src, entry.Name()), filepath.Join(target, entry.Name())
+		if entry.IsDir() {
+			err = moveDir(srcPath, targetPath)
+		} else {
+			err = replaceEntry(srcPath, targetPath)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaceEntry renames the entry to the target path, removing
+// an existing target that cannot be replaced by the rename.
+func replaceEntry(src, target string) error {
+	if err := os.Rename(src, target); err == nil {
+		return nil
+	}
+	if err := os.RemoveAll(target); err != nil {
+		return err
+	}
+	return os.Rename(src, target)
+}
+
 // descriptorFromDir generates descriptor from the given directory.
+// The directory is archived in the format of the media type.
 func (s *Store) descriptorFromDir(name, mediaType, dir string) (desc ocispec.Descriptor, err error) {
-	// make a temp file to store the gzip
-	gz, err := s.tempFile()
+	// make a temp file to store the archive
+	fp, err := s.tempFile()
 	if err != nil {
 		return ocispec.Descriptor{}, err
 	}
 	defer func() {
-		closeErr := gz.Close()
+		closeErr := fp.Close()
 		if err == nil {
 			err = closeErr
 		}
 	}()
 
-	// compress the directory
-	gzDigester := digest.Canonical.Digester()
-	gzw := gzip.NewWriter(io.MultiWriter(gz, gzDigester.Hash()))
-	defer func() {
-		closeErr := gzw.Close()
-		if err == nil {
-			err = closeErr
-		}
-	}()
+	if mediaType == "" {
+		mediaType = defaultBlobDirMediaType
+	}
+	annotations := map[string]string{
+		file.AnnotationUnpack: "true", // the content needs to be unpacked
+	}
 
-	tarDigester := digest.Canonical.Digester()
-	tw := io.MultiWriter(gzw, tarDigester.Hash())
+	// archive the directory
+	blobDigester := digest.Canonical.Digester()
+	w := io.MultiWriter(fp, blobDigester.Hash())
 	buf := bufPool.Get().(*[]byte)
 	defer bufPool.Put(buf)
-	if err := tarDirectory(dir, name, tw, s.TarReproducible, *buf); err != nil {
-		return ocispec.Descriptor{}, fmt.Errorf("failed to tar %s: %w", dir, err)
-	}
-
-	// flush all
-	if err := gzw.Close(); err != nil {
-		return ocispec.Descriptor{}, err
+	if format := archiveFormatFromMediaType(mediaType); format == formatZip {
+		if err := zipDirectory(dir, name, w, s.TarReproducible, *buf); err != nil {
+			return ocispec.Descriptor{}, fmt.Errorf("failed to zip %s: %w", dir, err)
+		}
+	} else {
+		cw, err := newCompressWriter(w, format)
+		if err != nil {
+			return ocispec.Descriptor{}, err
+		}
+		tarDigester := digest.Canonical.Digester()
+		tw := io.MultiWriter(cw, tarDigester.Hash())
+		if err := tarDirectory(dir, name, tw, s.TarReproducible, s.TarPreserveOwnership, *buf); err != nil {
+			cw.Close()
+			return ocispec.Descriptor{}, fmt.Errorf("failed to tar %s: %w", dir, err)
+		}
+		// flush the compressed content
+		if err := cw.Close(); err != nil {
+			return ocispec.Descriptor{}, err
+		}
+		annotations[file.AnnotationDigest] = tarDigester.Digest().String() // digest for the uncompressed content
 	}
-	if err := gz.Sync(); err != nil {
+	if err := fp.Sync(); err != nil {
 		return ocispec.Descriptor{}, err
 	}
 
-	fi, err := gz.Stat()
+	fi, err := fp.Stat()
 	if err != nil {
 		return ocispec.Descriptor{}, err
 	}
 
-	// map gzip digest to gzip path
-	gzDigest := gzDigester.Digest()
-	s.digestToPath.Store(gzDigest, gz.Name())
-
-	// generate descriptor
-	if mediaType == "" {
-		mediaType = defaultBlobDirMediaType
-	}
+	// map archive digest to archive path
+	blobDigest := blobDigester.Digest()
+	s.digestToPath.Store(blobDigest, fp.Name())
 
 	return ocispec.Descriptor{
-		MediaType: mediaType,
-		Digest:    gzDigest, // digest for the compressed content
-		Size:      fi.Size(),
-		Annotations: map[string]string{
-			file.AnnotationDigest: tarDigester.Digest().String(), // digest fot the uncompressed content
-			file.AnnotationUnpack: "true",                        // the content needs to be unpacked
-		},
+		MediaType:   mediaType,
+		Digest:      blobDigest, // digest for the archived content
+		Size:        fi.Size(),
+		Annotations: annotations,
 	}, nil
 }
 
@@ -652,6 +945,10 @@ func (s *Store) resolveWritePath(name string) (string, error) {
 		if strings.HasPrefix(rel, "../") || rel == ".." {
 			return "", file.ErrPathTraversalDisallowed
 		}
+		// Declared symbolic links must not be followed when writing.
+		if _, err := ensureBasePath(base, base, target); err != nil {
+			return "", fmt.Errorf("%w: %v", file.ErrPathTraversalDisallowed, err)
+		}
 	}
 	if s.DisableOverwrite {
 		if _, err := os.Stat(path); err == nil {
@@ -682,7 +979,7 @@ func (s *Store) nameExists(name string) bool {
 // tempFile creates a temp file with the file name format "oras_file_randomString",
 // and returns the pointer to the temp file.
 func (s *Store) tempFile() (*os.File, error) {
-	tmp, err := os.CreateTemp("", "oras_file_*")
+	tmp, err := os.CreateTemp(s.TempDir, "oras_file_*")
 	if err != nil {
 		return nil, err
 	}
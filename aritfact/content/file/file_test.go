@@ -0,0 +1,55 @@
+package file
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	uorspec "github.com/uor-framework/collection-spec/specs-go/v1alpha1"
+	"github.com/uor-framework/uor-client-go/nodes/descriptor"
+
+	"github.com/jpower432/runc-attribute-wrapper/aritfact/spec"
+)
+
+// blobDescriptor returns a descriptor of the content, named if name is set.
+func blobDescriptor(mediaType string, content []byte, name string) ocispec.Descriptor {
+	desc := ocispec.Descriptor{
+		MediaType: mediaType,
+		Digest:    digest.FromBytes(content),
+		Size:      int64(len(content)),
+	}
+	if name != "" {
+		desc.Annotations = map[string]string{ocispec.AnnotationTitle: name}
+	}
+	return desc
+}
+
+// entryDescriptor returns a descriptor of the content named name, with the
+// core file attributes, if file is set, and the file schema attributes.
+func entryDescriptor(t *testing.T, name string, content []byte, file *uorspec.File, entry spec.File) ocispec.Descriptor {
+	t.Helper()
+	attrs := map[string]json.RawMessage{}
+	if file != nil {
+		fileJSON, err := json.Marshal(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		attrs[descriptor.TypeFile] = fileJSON
+	}
+	if entry != (spec.File{}) {
+		entryJSON, err := json.Marshal(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		attrs[spec.SchemaFile] = entryJSON
+	}
+	desc := blobDescriptor(ocispec.MediaTypeImageLayer, content, "")
+	annotations, err := descriptor.AnnotationsFromAttributes(attrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	annotations[ocispec.AnnotationTitle] = name
+	desc.Annotations = annotations
+	return desc
+}
@@ -0,0 +1,295 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/uor-framework/uor-client-go/nodes/collection"
+	v2 "github.com/uor-framework/uor-client-go/nodes/descriptor/v2"
+	"oras.land/oras-go/v2/errdef"
+
+	"github.com/jpower432/runc-attribute-wrapper/aritfact/content/file/internal/ioutil"
+)
+
+// indexVersion is the version of the on-disk index format.
+const indexVersion = 1
+
+// index is the on-disk representation of the file store metadata.
+type index struct {
+	Version int `json:"version"`
+	// Paths maps content digests to file paths. Paths within
+	// the working directory are stored relative to it.
+	Paths map[digest.Digest]string `json:"paths,omitempty"`
+	// Names lists the names pushed to the store.
+	Names []string `json:"names,omitempty"`
+	// Tags maps references to tagged descriptors.
+	Tags map[string]ocispec.Descriptor `json:"tags,omitempty"`
+	// Nodes lists the descriptors in the collection graph.
+	Nodes []ocispec.Descriptor `json:"nodes,omitempty"`
+	// Edges maps node IDs to the IDs of their successors.
+	Edges map[string][]string `json:"edges,omitempty"`
+	// Extracted lists the digests of the extracted directory blobs.
+	Extracted []digest.Digest `json:"extracted,omitempty"`
+}
+
+// DefaultIndexPath returns the default index location
+// for a working directory.
+func DefaultIndexPath(workingDir string) string {
+	return filepath.Clean(workingDir) + ".index.json"
+}
+
+// NewWithIndex creates a file store that persists its metadata to the
+// index file at indexPath when it is closed. Contents without names are
+// stored as files in the directory named after the index with a ".blobs"
+// suffix, instead of a limited memory CAS. If the index file exists, the
+// store is restored from it.
+//
+// Extracted directories are only restored by name, since
+// directory blobs are not kept by the store.
+func NewWithIndex(workingDir, indexPath string) (*Store, error) {
+	s := NewWithFallbackStorage(workingDir, &blobStorage{root: indexPath + ".blobs"})
+	s.indexPath = indexPath
+	if err := s.loadIndex(); err != nil {
+		return nil, fmt.Errorf("failed to load index %s: %w", indexPath, err)
+	}
+	return s, nil
+}
+
+// blobStorage is a content storage keeping blobs as
+// files laid out as blobs/<algorithm>/<encoded> in root.
+type blobStorage struct {
+	root string
+}
+
+// path returns the path of the blob with the digest.
+func (b *blobStorage) path(dgst digest.Digest) (string, error) {
+	if err := dgst.Validate(); err != nil {
+		return "", err
+	}
+	return filepath.Join(b.root, "blobs", dgst.Algorithm().String(), dgst.Encoded()), nil
+}
+
+// Fetch fetches the content identified by the descriptor.
+func (b *blobStorage) Fetch(_ context.Context, target ocispec.Descriptor) (io.ReadCloser, error) {
+	path, err := b.path(target.Digest)
+	if err != nil {
+		return nil, err
+	}
+	fp, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%s: %s: %w", target.Digest, target.MediaType, errdef.ErrNotFound)
+		}
+		return nil, err
+	}
+	return fp, nil
+}
+
+// Push verifies the content against the expected descriptor and
+// stores it. The blob is written to a temporary file and renamed,
+// so a partially written blob is never observed.
+func (b *blobStorage) Push(_ context.Context, expected ocispec.Descriptor, content io.Reader) error {
+	path, err := b.path(expected.Digest)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s: %s: %w", expected.Digest, expected.MediaType, errdef.ErrAlreadyExists)
+	}
+	dir := filepath.Dir(path)
+	if err := ensureDir(dir); err != nil {
+		return err
+	}
+	fp, err := os.CreateTemp(dir, expected.Digest.Encoded()+".*")
+	if err != nil {
+		return err
+	}
+	tmpPath := fp.Name()
+	buf := bufPool.Get().(*[]byte)
+	defer bufPool.Put(buf)
+	if err := ioutil.CopyBuffer(fp, content, *buf, expected); err != nil {
+		fp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to copy content to %s: %w", tmpPath, err)
+	}
+	if err := fp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// Exists returns true if the described content exists.
+func (b *blobStorage) Exists(_ context.Context, target ocispec.Descriptor) (bool, error) {
+	path, err := b.path(target.Digest)
+	if err != nil {
+		return false, err
+	}
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// loadIndex restores the store metadata from the index file.
+func (s *Store) loadIndex() error {
+	data, err := os.ReadFile(s.indexPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	var idx index
+	if err := json.Unmarshal(data, &idx); err != nil {
+		return err
+	}
+	if idx.Version != indexVersion {
+		return fmt.Errorf("unsupported index version %d", idx.Version)
+	}
+
+	for dgst, path := range idx.Paths {
+		s.digestToPath.Store(dgst, s.absPath(path))
+	}
+	for _, name := range idx.Names {
+		s.status(name).exists = true
+	}
+	for ref, desc := range idx.Tags {
+		s.resolver.Store(ref, desc)
+	}
+	for _, dgst := range idx.Extracted {
+		s.extracted.Store(dgst, true)
+	}
+
+	graph := collection.New(s.workingDir)
+	for _, desc := range idx.Nodes {
+		node, err := v2.NewNode(desc.Digest.String(), desc)
+		if err != nil {
+			return err
+		}
+		if err := graph.AddNode(node); err != nil {
+			return err
+		}
+	}
+	for from, successors := range idx.Edges {
+		fromNode := graph.NodeByID(from)
+		for _, to := range successors {
+			toNode := graph.NodeByID(to)
+			if fromNode == nil || toNode == nil {
+				return fmt.Errorf("edge %s to %s: %w", from, to, collection.ErrNodesNotExist)
+			}
+			if err := graph.AddEdge(collection.NewEdge(fromNode, toNode)); err != nil {
+				return fmt.Errorf("edge %s to %s: %w", from, to, err)
+			}
+		}
+	}
+	s.graph = graph
+
+	return nil
+}
+
+// saveIndex writes the store metadata to the index file. It is called
+// once when the store is closed, instead of on every change, since the
+// whole index is rewritten. The caller must hold s.mu.
+func (s *Store) saveIndex() error {
+	if s.indexPath == "" {
+		return nil
+	}
+
+	idx := index{
+		Version: indexVersion,
+		Paths:   map[digest.Digest]string{},
+		Tags:    map[string]ocispec.Descriptor{},
+		Edges:   map[string][]string{},
+	}
+
+	s.digestToPath.Range(func(key, value interface{}) bool {
+		path := value.(string)
+		// Temporary files are removed when the store is closed.
+		if _, tmp := s.tmpFiles.Load(path); tmp {
+			return true
+		}
+		if rel, err := filepath.Rel(s.workingDir, path); err == nil {
+			if rel = filepath.ToSlash(rel); rel != ".." && !strings.HasPrefix(rel, "../") {
+				path = rel
+			}
+		}
+		idx.Paths[key.(digest.Digest)] = path
+		return true
+	})
+	s.nameToStatus.Range(func(key, value interface{}) bool {
+		status := value.(*nameStatus)
+		status.RLock()
+		defer status.RUnlock()
+		if status.exists {
+			idx.Names = append(idx.Names, key.(string))
+		}
+		return true
+	})
+	s.resolver.Range(func(key, value interface{}) bool {
+		idx.Tags[key.(string)] = value.(ocispec.Descriptor)
+		return true
+	})
+	s.extracted.Range(func(key, _ interface{}) bool {
+		idx.Extracted = append(idx.Extracted, key.(digest.Digest))
+		return true
+	})
+	for _, n := range s.graph.Nodes() {
+		node, ok := n.(*v2.Node)
+		if !ok {
+			continue
+		}
+		idx.Nodes = append(idx.Nodes, node.Descriptor())
+	}
+	for _, edge := range s.graph.Edges() {
+		from := edge.From().ID()
+		idx.Edges[from] = append(idx.Edges[from], edge.To().ID())
+	}
+
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file and rename, so a partially
+	// written index is never observed.
+	dir := filepath.Dir(s.indexPath)
+	if err := ensureDir(dir); err != nil {
+		return err
+	}
+	fp, err := os.CreateTemp(dir, filepath.Base(s.indexPath)+".*")
+	if err != nil {
+		return err
+	}
+	tmpPath := fp.Name()
+	if _, err := fp.Write(data); err != nil {
+		fp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := fp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, s.indexPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
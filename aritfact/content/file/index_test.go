@@ -0,0 +1,160 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	orascontent "oras.land/oras-go/v2/content"
+)
+
+func TestIndexRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	workingDir := t.TempDir()
+	indexPath := DefaultIndexPath(workingDir)
+
+	s, err := NewWithIndex(workingDir, indexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	layerContent := []byte("hello world")
+	layer := blobDescriptor(ocispec.MediaTypeImageLayer, layerContent, "hello.txt")
+	if err := s.Push(ctx, layer, bytes.NewReader(layerContent)); err != nil {
+		t.Fatal(err)
+	}
+	configContent := []byte("{}")
+	config := blobDescriptor(ocispec.MediaTypeImageConfig, configContent, "")
+	if err := s.Push(ctx, config, bytes.NewReader(configContent)); err != nil {
+		t.Fatal(err)
+	}
+	manifestContent, err := json.Marshal(ocispec.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		Config:    config,
+		Layers:    []ocispec.Descriptor{layer},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest := blobDescriptor(ocispec.MediaTypeImageManifest, manifestContent, "")
+	if err := s.Push(ctx, manifest, bytes.NewReader(manifestContent)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Tag(ctx, manifest, "latest"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The index is only written when the store is closed.
+	if _, err := os.Stat(indexPath); !os.IsNotExist(err) {
+		t.Fatalf("index written before close: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(indexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Unnamed content is stored as files, not in the index.
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fields["blobs"]; ok {
+		t.Errorf("index has inline blobs: %s", data)
+	}
+	if _, err := os.Stat(filepath.Join(indexPath+".blobs", "blobs", "sha256", manifest.Digest.Encoded())); err != nil {
+		t.Errorf("manifest blob not stored as a file: %v", err)
+	}
+
+	s, err = NewWithIndex(workingDir, indexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for _, tt := range []struct {
+		desc    ocispec.Descriptor
+		content []byte
+	}{
+		{layer, layerContent},
+		{config, configContent},
+		{manifest, manifestContent},
+	} {
+		exists, err := s.Exists(ctx, tt.desc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !exists {
+			t.Errorf("%s does not exist after reopening", tt.desc.Digest)
+			continue
+		}
+		got, err := orascontent.FetchAll(ctx, s, tt.desc)
+		if err != nil {
+			t.Fatalf("fetch %s: %v", tt.desc.Digest, err)
+		}
+		if !bytes.Equal(got, tt.content) {
+			t.Errorf("fetch %s = %q, want %q", tt.desc.Digest, got, tt.content)
+		}
+	}
+
+	resolved, err := s.Resolve(ctx, "latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved.Digest != manifest.Digest {
+		t.Errorf("Resolve() = %s, want %s", resolved.Digest, manifest.Digest)
+	}
+
+	predecessors, err := s.Predecessors(ctx, layer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(predecessors) != 1 || predecessors[0].Digest != manifest.Digest {
+		t.Errorf("Predecessors() = %v, want %s", predecessors, manifest.Digest)
+	}
+}
+
+func TestBlobStorage(t *testing.T) {
+	ctx := context.Background()
+	b := &blobStorage{root: t.TempDir()}
+	content := []byte("blob")
+	desc := blobDescriptor(ocispec.MediaTypeImageLayer, content, "")
+
+	if _, err := b.Fetch(ctx, desc); err == nil {
+		t.Error("fetched a missing blob")
+	}
+	// Content not matching the descriptor is not stored.
+	if err := b.Push(ctx, desc, strings.NewReader("other")); err == nil {
+		t.Error("pushed content not matching the descriptor")
+	}
+	if exists, _ := b.Exists(ctx, desc); exists {
+		t.Error("content not matching the descriptor was stored")
+	}
+	if err := b.Push(ctx, desc, bytes.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Push(ctx, desc, bytes.NewReader(content)); err == nil {
+		t.Error("pushed an existing blob")
+	}
+	got, err := orascontent.FetchAll(ctx, b, desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("Fetch() = %q, want %q", got, content)
+	}
+	entries, err := os.ReadDir(filepath.Join(b.root, "blobs", "sha256"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+}
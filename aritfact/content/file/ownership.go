@@ -0,0 +1,126 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	uorspec "github.com/uor-framework/collection-spec/specs-go/v1alpha1"
+
+	"github.com/jpower432/runc-attribute-wrapper/aritfact/spec"
+)
+
+// maxID is the largest user or group id.
+const maxID = 1<<32 - 2
+
+// idRange maps a contiguous range of archive ids to host ids.
+type idRange struct {
+	archiveID int
+	hostID    int
+	size      int
+}
+
+// ownershipPolicy determines the owner of extracted entries.
+type ownershipPolicy struct {
+	policy string
+	uid    int
+	gid    int
+	uidMap []idRange
+	gidMap []idRange
+}
+
+// newOwnershipPolicy parses the ownership policy of a directory blob
+// from the file schema and the core file attributes, if present.
+func newOwnershipPolicy(entry spec.File, file uorspec.File, hasFileInfo bool) (ownershipPolicy, error) {
+	p := ownershipPolicy{policy: entry.Ownership}
+	var err error
+	switch entry.Ownership {
+	case "", spec.OwnershipPreserve:
+	case spec.OwnershipForce:
+		if !hasFileInfo || file.UID < 0 || file.GID < 0 {
+			return p, errors.New("ownership policy force requires the core-file uid and gid")
+		}
+		p.uid, p.gid = file.UID, file.GID
+	case spec.OwnershipMap:
+		if p.uidMap, err = parseIDMap(entry.UIDMap); err != nil {
+			return p, fmt.Errorf("invalid uid map: %w", err)
+		}
+		if p.gidMap, err = parseIDMap(entry.GIDMap); err != nil {
+			return p, fmt.Errorf("invalid gid map: %w", err)
+		}
+	default:
+		return p, fmt.Errorf("unsupported ownership policy %q: must be one of %s, %s, %s",
+			entry.Ownership, spec.OwnershipPreserve, spec.OwnershipForce, spec.OwnershipMap)
+	}
+	if entry.Ownership != spec.OwnershipMap && (entry.UIDMap != "" || entry.GIDMap != "") {
+		return p, fmt.Errorf("id maps require the ownership policy %s", spec.OwnershipMap)
+	}
+	return p, nil
+}
+
+// enabled returns true if the ownership of the extracted entries is changed.
+func (p ownershipPolicy) enabled() bool {
+	return p.policy != ""
+}
+
+// owner returns the owner of an entry stored in the archive with the ids.
+func (p ownershipPolicy) owner(uid, gid int) (int, int, error) {
+	switch p.policy {
+	case spec.OwnershipForce:
+		return p.uid, p.gid, nil
+	case spec.OwnershipMap:
+		hostUID, err := mapID(p.uidMap, uid)
+		if err != nil {
+			return 0, 0, fmt.Errorf("uid %d: %w", uid, err)
+		}
+		hostGID, err := mapID(p.gidMap, gid)
+		if err != nil {
+			return 0, 0, fmt.Errorf("gid %d: %w", gid, err)
+		}
+		return hostUID, hostGID, nil
+	default:
+		return uid, gid, nil
+	}
+}
+
+// mapID maps an archive id to a host id. An empty map keeps the id.
+func mapID(ranges []idRange, id int) (int, error) {
+	if len(ranges) == 0 {
+		return id, nil
+	}
+	for _, r := range ranges {
+		if id >= r.archiveID && id < r.archiveID+r.size {
+			return r.hostID + id - r.archiveID, nil
+		}
+	}
+	return 0, errors.New("not mapped")
+}
+
+// parseIDMap parses a comma separated list of archive:host:size id ranges.
+// Ranges must not extend past the largest id.
+func parseIDMap(value string) ([]idRange, error) {
+	var ranges []idRange
+	for _, entry := range spec.SplitList(value) {
+		fields := strings.Split(entry, ":")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%q: must be archive:host:size", entry)
+		}
+		var ids [3]int64
+		for i, field := range fields {
+			id, err := strconv.ParseInt(field, 10, 64)
+			if err != nil || id < 0 {
+				return nil, fmt.Errorf("%q: invalid id %q", entry, field)
+			}
+			ids[i] = id
+		}
+		if ids[2] == 0 {
+			return nil, fmt.Errorf("%q: size must be greater than zero", entry)
+		}
+		if ids[2] > maxID+1 || ids[0] > maxID+1-ids[2] || ids[1] > maxID+1-ids[2] {
+			return nil, fmt.Errorf("%q: range exceeds the largest id %d", entry, int64(maxID))
+		}
+		ranges = append(ranges, idRange{archiveID: int(ids[0]), hostID: int(ids[1]), size: int(ids[2])})
+	}
+	return ranges, nil
+}
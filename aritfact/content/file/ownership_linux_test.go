@@ -0,0 +1,82 @@
+package file
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	uorspec "github.com/uor-framework/collection-spec/specs-go/v1alpha1"
+
+	"github.com/jpower432/runc-attribute-wrapper/aritfact/spec"
+)
+
+func TestExtractTarOwnership(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("changing the owner of files requires root")
+	}
+	owned := func(entry tarEntry, uid, gid int) tarEntry {
+		entry.header.Uid, entry.header.Gid = uid, gid
+		entry.header.Format = tar.FormatPAX
+		return entry
+	}
+	data := tarball(t,
+		owned(dirEntry("app/"), 0, 0),
+		owned(regEntry("app/config", "config"), 1000, 100),
+		owned(linkEntry(tar.TypeSymlink, "app/link", "config"), 1000, 1000),
+	)
+	tests := []struct {
+		name    string
+		entry   spec.File
+		file    uorspec.File
+		want    map[string][2]int
+		wantErr bool
+	}{
+		{
+			name:  "preserve",
+			entry: spec.File{Ownership: spec.OwnershipPreserve},
+			want:  map[string][2]int{".": {0, 0}, "config": {1000, 100}, "link": {1000, 1000}},
+		},
+		{
+			name:  "force",
+			entry: spec.File{Ownership: spec.OwnershipForce},
+			file:  uorspec.File{UID: 65534, GID: 65533},
+			want:  map[string][2]int{".": {65534, 65533}, "config": {65534, 65533}, "link": {65534, 65533}},
+		},
+		{
+			name:  "map",
+			entry: spec.File{Ownership: spec.OwnershipMap, UIDMap: "0:100000:65536", GIDMap: "0:200000:65536"},
+			want:  map[string][2]int{".": {100000, 200000}, "config": {101000, 200100}, "link": {101000, 201000}},
+		},
+		{
+			name:    "unmapped id",
+			entry:   spec.File{Ownership: spec.OwnershipMap, UIDMap: "0:100000:1000"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ownership, err := newOwnershipPolicy(tt.entry, tt.file, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dir := t.TempDir()
+			opts := extractOptions{limits: testLimits, ownership: ownership}
+			err = extractTarDirectory(dir, extractPrefix, bytes.NewReader(data), opts, make([]byte, 32*1024))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("extractTarDirectory() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for name, want := range tt.want {
+				info, err := os.Lstat(filepath.Join(dir, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				uid, gid, _ := fileOwner(info)
+				if uid != want[0] || gid != want[1] {
+					t.Errorf("%s owner = %d:%d, want %d:%d", name, uid, gid, want[0], want[1])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package file
+
+import (
+	"reflect"
+	"testing"
+
+	uorspec "github.com/uor-framework/collection-spec/specs-go/v1alpha1"
+
+	"github.com/jpower432/runc-attribute-wrapper/aritfact/spec"
+)
+
+func TestNewOwnershipPolicy(t *testing.T) {
+	tests := []struct {
+		name        string
+		entry       spec.File
+		file        uorspec.File
+		hasFileInfo bool
+		want        ownershipPolicy
+		wantErr     bool
+	}{
+		{name: "none"},
+		{name: "preserve", entry: spec.File{Ownership: spec.OwnershipPreserve}, want: ownershipPolicy{policy: spec.OwnershipPreserve}},
+		{
+			name:        "force",
+			entry:       spec.File{Ownership: spec.OwnershipForce},
+			file:        uorspec.File{UID: 1000, GID: 100},
+			hasFileInfo: true,
+			want:        ownershipPolicy{policy: spec.OwnershipForce, uid: 1000, gid: 100},
+		},
+		{name: "force without file info", entry: spec.File{Ownership: spec.OwnershipForce}, wantErr: true},
+		{
+			name:        "force with negative uid",
+			entry:       spec.File{Ownership: spec.OwnershipForce},
+			file:        uorspec.File{UID: -1, GID: 100},
+			hasFileInfo: true,
+			wantErr:     true,
+		},
+		{
+			name:  "map",
+			entry: spec.File{Ownership: spec.OwnershipMap, UIDMap: "0:100000:65536, 65536:200000:1", GIDMap: "0:100000:65536"},
+			want: ownershipPolicy{
+				policy: spec.OwnershipMap,
+				uidMap: []idRange{{archiveID: 0, hostID: 100000, size: 65536}, {archiveID: 65536, hostID: 200000, size: 1}},
+				gidMap: []idRange{{archiveID: 0, hostID: 100000, size: 65536}},
+			},
+		},
+		{name: "map without ranges", entry: spec.File{Ownership: spec.OwnershipMap}, want: ownershipPolicy{policy: spec.OwnershipMap}},
+		{name: "range without size", entry: spec.File{Ownership: spec.OwnershipMap, UIDMap: "0:100000"}, wantErr: true},
+		{name: "range with extra field", entry: spec.File{Ownership: spec.OwnershipMap, GIDMap: "0:100000:1:1"}, wantErr: true},
+		{name: "negative id", entry: spec.File{Ownership: spec.OwnershipMap, UIDMap: "-1:100000:1"}, wantErr: true},
+		{name: "invalid id", entry: spec.File{Ownership: spec.OwnershipMap, GIDMap: "0:root:1"}, wantErr: true},
+		{name: "empty range", entry: spec.File{Ownership: spec.OwnershipMap, UIDMap: "0:100000:0"}, wantErr: true},
+		{name: "largest id", entry: spec.File{Ownership: spec.OwnershipMap, UIDMap: "4294967294:0:1"}, want: ownershipPolicy{
+			policy: spec.OwnershipMap,
+			uidMap: []idRange{{archiveID: 4294967294, hostID: 0, size: 1}},
+		}},
+		{name: "archive range past the largest id", entry: spec.File{Ownership: spec.OwnershipMap, UIDMap: "4294967294:0:2"}, wantErr: true},
+		{name: "host range past the largest id", entry: spec.File{Ownership: spec.OwnershipMap, GIDMap: "0:4294967000:65536"}, wantErr: true},
+		{name: "overflowing range", entry: spec.File{Ownership: spec.OwnershipMap, UIDMap: "1:1:9223372036854775807"}, wantErr: true},
+		{name: "maps without map policy", entry: spec.File{Ownership: spec.OwnershipPreserve, UIDMap: "0:100000:65536"}, wantErr: true},
+		{name: "maps without policy", entry: spec.File{GIDMap: "0:100000:65536"}, wantErr: true},
+		{name: "unsupported", entry: spec.File{Ownership: "root"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newOwnershipPolicy(tt.entry, tt.file, tt.hasFileInfo)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newOwnershipPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("newOwnershipPolicy() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOwnershipPolicyOwner(t *testing.T) {
+	mapped := spec.File{Ownership: spec.OwnershipMap, UIDMap: "0:100000:1000,1000:1000:1", GIDMap: "0:100000:1000"}
+	tests := []struct {
+		name     string
+		entry    spec.File
+		file     uorspec.File
+		uid, gid int
+		wantUID  int
+		wantGID  int
+		wantErr  bool
+	}{
+		{name: "none", uid: 1000, gid: 100, wantUID: 1000, wantGID: 100},
+		{name: "preserve", entry: spec.File{Ownership: spec.OwnershipPreserve}, uid: 1000, gid: 100, wantUID: 1000, wantGID: 100},
+		{
+			name:    "force",
+			entry:   spec.File{Ownership: spec.OwnershipForce},
+			file:    uorspec.File{UID: 65534, GID: 65534},
+			wantUID: 65534,
+			wantGID: 65534,
+		},
+		{name: "mapped root", entry: mapped, uid: 0, gid: 0, wantUID: 100000, wantGID: 100000},
+		{name: "mapped range end", entry: mapped, uid: 999, gid: 999, wantUID: 100999, wantGID: 100999},
+		{name: "second range", entry: mapped, uid: 1000, gid: 10, wantUID: 1000, wantGID: 100010},
+		{name: "unmapped uid", entry: mapped, uid: 1001, gid: 0, wantErr: true},
+		{name: "unmapped gid", entry: mapped, uid: 0, gid: 1000, wantErr: true},
+		{
+			name:    "empty gid map",
+			entry:   spec.File{Ownership: spec.OwnershipMap, UIDMap: "0:100000:1000"},
+			uid:     10,
+			gid:     5000,
+			wantUID: 100010,
+			wantGID: 5000,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := newOwnershipPolicy(tt.entry, tt.file, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			uid, gid, err := p.owner(tt.uid, tt.gid)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("owner() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if uid != tt.wantUID || gid != tt.wantGID {
+				t.Errorf("owner() = %d:%d, want %d:%d", uid, gid, tt.wantUID, tt.wantGID)
+			}
+		})
+	}
+}
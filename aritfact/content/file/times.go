@@ -0,0 +1,92 @@
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jpower432/runc-attribute-wrapper/aritfact/spec"
+)
+
+// entryTimes are the access and modification times of an entry.
+type entryTimes struct {
+	atime time.Time
+	mtime time.Time
+}
+
+// setTimes sets the times declared by the file schema, or the source date
+// epoch of the store, on the pushed entry. The parent directories modified
+// by the push are reset afterwards.
+func (s *Store) setTimes(target string, entry spec.File) error {
+	path, err := filepath.Abs(target)
+	if err != nil {
+		return err
+	}
+
+	// Hard links share the times of the linked entry.
+	if entry.Type != spec.FileTypeHardlink {
+		times := entryTimes{mtime: s.SourceDateEpoch}
+		if entry.Mtime != nil {
+			times.mtime = time.Unix(*entry.Mtime, 0)
+		}
+		times.atime = times.mtime
+		if entry.Atime != nil {
+			times.atime = time.Unix(*entry.Atime, 0)
+		}
+
+		if !times.atime.IsZero() || !times.mtime.IsZero() {
+			info, err := os.Lstat(path)
+			if err != nil {
+				return err
+			}
+			if times.mtime.IsZero() {
+				times.mtime = info.ModTime()
+			}
+			if err := lchtimes(path, times.atime, times.mtime); err != nil {
+				return err
+			}
+			// Keep the directory times to restore them
+			// when entries are pushed to the directory.
+			if info.IsDir() {
+				s.dirTimes.Store(path, times)
+			}
+		}
+	}
+
+	return s.resetParentTimes(path)
+}
+
+// resetParentTimes restores the times of the parent directories of the path
+// in the working directory to the declared directory times or the source
+// date epoch of the store.
+func (s *Store) resetParentTimes(path string) error {
+	base, err := filepath.Abs(s.workingDir)
+	if err != nil {
+		return err
+	}
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		rel, err := filepath.Rel(base, dir)
+		if err != nil {
+			return nil
+		}
+		if rel = filepath.ToSlash(rel); rel == ".." || strings.HasPrefix(rel, "../") {
+			return nil
+		}
+
+		if val, ok := s.dirTimes.Load(dir); ok {
+			times := val.(entryTimes)
+			if err := lchtimes(dir, times.atime, times.mtime); err != nil {
+				return err
+			}
+		} else if !s.SourceDateEpoch.IsZero() {
+			if err := lchtimes(dir, s.SourceDateEpoch, s.SourceDateEpoch); err != nil {
+				return err
+			}
+		}
+
+		if rel == "." {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,33 @@
+//go:build !linux
+
+package file
+
+import (
+	"os"
+	"time"
+)
+
+// lchtimes changes the access and modification times of the path. The times
+// of symbolic links are not changed and zero times are left unchanged.
+func lchtimes(path string, atime, mtime time.Time) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		return nil
+	}
+	if mtime.IsZero() {
+		mtime = info.ModTime()
+	}
+	if atime.IsZero() {
+		atime = mtime
+	}
+	return os.Chtimes(path, atime, mtime)
+}
+
+// accessTime returns the modification time of the file,
+// since the access time is not available on all platforms.
+func accessTime(info os.FileInfo) time.Time {
+	return info.ModTime()
+}
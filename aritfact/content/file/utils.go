@@ -17,7 +17,6 @@ package file
 
 import (
 	"archive/tar"
-	"compress/gzip"
 	"errors"
 	"fmt"
 	"io"
@@ -27,11 +26,13 @@ import (
 	"time"
 
 	"github.com/opencontainers/go-digest"
+
+	"github.com/jpower432/runc-attribute-wrapper/aritfact/spec"
 )
 
 // tarDirectory walks the directory specified by path, and tar those files with a new
-// path prefix.
-func tarDirectory(root, prefix string, w io.Writer, stripTimes bool, buf []byte) (err error) {
+// path prefix. Unless preserveOwnership is set, the files are owned by root.
+func tarDirectory(root, prefix string, w io.Writer, stripTimes, preserveOwnership bool, buf []byte) (err error) {
 	tw := tar.NewWriter(w)
 	defer func() {
 		closeErr := tw.Close()
@@ -66,8 +67,10 @@ func tarDirectory(root, prefix string, w io.Writer, stripTimes bool, buf []byte)
 			return fmt.Errorf("%s: %w", path, err)
 		}
 		header.Name = name
-		header.Uid = 0
-		header.Gid = 0
+		if !preserveOwnership {
+			header.Uid = 0
+			header.Gid = 0
+		}
 		header.Uname = ""
 		header.Gname = ""
 
@@ -102,40 +105,34 @@ func tarDirectory(root, prefix string, w io.Writer, stripTimes bool, buf []byte)
 	})
 }
 
-// extractTarGzip decompresses the gzip
+// extractTarArchive decompresses the tarball in the given format
 // and extracts tar file to a directory specified by the `dir` parameter.
-func extractTarGzip(dir, prefix, filename, checksum string, buf []byte) (err error) {
-	fp, err := os.Open(filename)
-	if err != nil {
-		return err
-	}
-	defer func() {
-		closeErr := fp.Close()
-		if err == nil {
-			err = closeErr
-		}
-	}()
-
-	gzr, err := gzip.NewReader(fp)
+// The uncompressed content is verified against the checksum, if specified.
+func extractTarArchive(dir, prefix string, r io.Reader, format archiveFormat, checksum string, opts extractOptions, buf []byte) (err error) {
+	dr, err := newDecompressReader(r, format)
 	if err != nil {
 		return err
 	}
 	defer func() {
-		closeErr := gzr.Close()
+		closeErr := dr.Close()
 		if err == nil {
 			err = closeErr
 		}
 	}()
 
-	var r io.Reader = gzr
+	var tr io.Reader = dr
 	var verifier digest.Verifier
 	if checksum != "" {
 		if digest, err := digest.Parse(checksum); err == nil {
 			verifier = digest.Verifier()
-			r = io.TeeReader(r, verifier)
+			tr = io.TeeReader(tr, verifier)
 		}
 	}
-	if err := extractTarDirectory(dir, prefix, r, buf); err != nil {
+	if err := extractTarDirectory(dir, prefix, tr, opts, buf); err != nil {
+		return err
+	}
+	// Read the padding after the end of the archive
+	if _, err := io.CopyBuffer(io.Discard, tr, buf); err != nil {
 		return err
 	}
 	if verifier != nil && !verifier.Verified() {
@@ -146,57 +143,161 @@ func extractTarGzip(dir, prefix, filename, checksum string, buf []byte) (err err
 
 // extractTarDirectory extracts tar file to a directory specified by the `dir`
 // parameter. The file name prefix is ensured to be the string specified by the
-// `prefix` parameter and is trimmed.
-func extractTarDirectory(dir, prefix string, r io.Reader, buf []byte) error {
+// `prefix` parameter and is trimmed. Entry times later than the epoch, if set,
+// are clamped to it, the owner of the entries is set by the ownership policy
+// and extraction fails once the tarball exceeds the limits.
+func extractTarDirectory(dir, prefix string, r io.Reader, opts extractOptions, buf []byte) (err error) {
+	root, err := openExtractRoot(dir)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		closeErr := root.close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	// Directory times are set once extracted, since
+	// extracting the entries modifies them.
+	var dirs []*tar.Header
+	var dirNames []string
+	limiter := extractLimiter{limits: opts.limits}
 	tr := tar.NewReader(r)
 	for {
 		header, err := tr.Next()
 		if err != nil {
 			if err == io.EOF {
+				for i, header := range dirs {
+					atime, mtime := tarTimes(header, opts.epoch)
+					root.lchtimes(dirNames[i], atime, mtime)
+				}
 				return nil
 			}
 			return err
 		}
 
 		// Name check
-		name := header.Name
-		path, err := ensureBasePath(dir, prefix, name)
+		name, err := ensureBasePath(dir, prefix, header.Name)
 		if err != nil {
 			return err
 		}
-		path = filepath.Join(dir, path)
+		path := filepath.Join(dir, name)
+
+		// Limit check
+		if err := limiter.entry(name); err != nil {
+			return err
+		}
+		if header.Typeflag == tar.TypeReg {
+			if err := limiter.add(header.Size); err != nil {
+				return err
+			}
+		}
 
 		// Create content
+		mode := header.FileInfo().Mode()
 		switch header.Typeflag {
 		case tar.TypeReg:
-			err = writeFile(path, tr, header.FileInfo().Mode(), buf)
+			err = root.writeFile(name, tr, mode, buf)
 		case tar.TypeDir:
-			err = os.MkdirAll(path, header.FileInfo().Mode())
+			err = root.mkdirAll(name, mode)
 		case tar.TypeLink:
+			// Hard link names are relative to the tarball root.
 			var target string
-			if target, err = ensureLinkPath(dir, prefix, path, header.Linkname); err == nil {
-				err = os.Link(target, path)
+			if target, err = ensureBasePath(dir, prefix, header.Linkname); err == nil {
+				err = root.link(target, name)
 			}
 		case tar.TypeSymlink:
 			var target string
 			if target, err = ensureLinkPath(dir, prefix, path, header.Linkname); err == nil {
-				err = os.Symlink(target, path)
+				err = root.symlink(target, name)
+			}
+		case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+			err = root.mknod(name, tarEntryType(header.Typeflag), mode, header.Devmajor, header.Devminor)
+			// Device nodes require privileges, skip them when not permitted
+			if errors.Is(err, os.ErrPermission) || errors.Is(err, errMknodNotSupported) {
+				continue
 			}
 		default:
-			continue // Non-regular files are skipped
+			continue // Other file types are skipped
 		}
 		if err != nil {
 			return err
 		}
+		// Hard links share the owner of the linked entry.
+		if header.Typeflag != tar.TypeLink {
+			if err := setOwner(root, name, mode, opts.ownership, header.Uid, header.Gid); err != nil {
+				return err
+			}
+		}
+		if err := setTarXattrs(root, name, tarXattrs(header.PAXRecords)); err != nil {
+			return err
+		}
+
+		if header.Typeflag == tar.TypeDir {
+			dirs = append(dirs, header)
+			dirNames = append(dirNames, name)
+			continue
+		}
 
 		// Change access time and modification time if possible (error ignored)
-		os.Chtimes(path, header.AccessTime, header.ModTime)
+		atime, mtime := tarTimes(header, opts.epoch)
+		root.lchtimes(name, atime, mtime)
+	}
+}
+
+// pathDepth returns the number of components of a relative path.
+func pathDepth(name string) int {
+	name = filepath.ToSlash(filepath.Clean(name))
+	if name == "." {
+		return 0
+	}
+	return strings.Count(name, "/") + 1
+}
+
+// tarTimes returns the access and modification times of a tar entry. The
+// access time defaults to the modification time, and times later than the
+// epoch, if set, are clamped to it.
+func tarTimes(header *tar.Header, epoch time.Time) (atime, mtime time.Time) {
+	return clampTimes(header.AccessTime, header.ModTime, epoch)
+}
+
+// clampTimes defaults the access time to the modification time, and
+// clamps times later than the epoch, if set, to it.
+func clampTimes(atime, mtime, epoch time.Time) (time.Time, time.Time) {
+	if atime.IsZero() {
+		atime = mtime
+	}
+	if !epoch.IsZero() {
+		if mtime.After(epoch) {
+			mtime = epoch
+		}
+		if atime.After(epoch) {
+			atime = epoch
+		}
+	}
+	return atime, mtime
+}
+
+// tarEntryType returns the file schema entry type of a tar type flag.
+func tarEntryType(typeflag byte) string {
+	switch typeflag {
+	case tar.TypeChar:
+		return spec.FileTypeCharDevice
+	case tar.TypeBlock:
+		return spec.FileTypeBlockDevice
+	default:
+		return spec.FileTypeFIFO
 	}
 }
 
 // ensureBasePath ensures the target path is in the base path,
-// returning its relative path to the base path.
+// returning its relative path to the base path. Absolute
+// targets are checked against the root path.
 func ensureBasePath(root, base, target string) (string, error) {
+	if filepath.IsAbs(target) {
+		base = root
+	}
 	path, err := filepath.Rel(base, target)
 	if err != nil {
 		return "", err
@@ -236,8 +337,15 @@ func ensureLinkPath(root, base, link, target string) (string, error) {
 }
 
 // writeFile writes content to the file specified by the `path` parameter.
+// An existing entry other than a directory is replaced, not written
+// through: it may be a symbolic link, a FIFO, a device node or a hard link.
 func writeFile(path string, r io.Reader, perm os.FileMode, buf []byte) (err error) {
-	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if info, err := os.Lstat(path); err == nil && !info.IsDir() {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL|oNoFollow, perm)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,98 @@
+package file
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/jpower432/runc-attribute-wrapper/aritfact/spec"
+)
+
+const (
+	// xattrCapability is the extended attribute storing file capabilities.
+	xattrCapability = "security.capability"
+	// paxSchilyXattr is the PAX record prefix used by tar
+	// to store extended attributes.
+	paxSchilyXattr = "SCHILY.xattr."
+)
+
+// extendedAttributes are the extended attributes
+// and SELinux label set on pushed files.
+type extendedAttributes struct {
+	xattrs map[string][]byte
+	label  string
+}
+
+// newExtendedAttributes parses the extended attributes of the file schema.
+// Capabilities are only supported on regular files.
+func newExtendedAttributes(file spec.File, regular bool) (extendedAttributes, error) {
+	var attrs extendedAttributes
+	var err error
+	attrs.label = file.SELinuxLabel
+	attrs.xattrs, err = parseXattrs(file.Xattrs)
+	if err != nil {
+		return attrs, err
+	}
+	if file.Capabilities != "" {
+		if !regular {
+			return attrs, fmt.Errorf("schema %s: capabilities are only supported for files", spec.SchemaFile)
+		}
+		capability, err := encodeCapabilities(file.Capabilities)
+		if err != nil {
+			return attrs, fmt.Errorf("schema %s: %w", spec.SchemaFile, err)
+		}
+		attrs.xattrs[xattrCapability] = capability
+	}
+	return attrs, nil
+}
+
+// empty returns true if there are no attributes to set.
+func (a extendedAttributes) empty() bool {
+	return len(a.xattrs) == 0 && a.label == ""
+}
+
+// parseXattrs parses a comma separated list of name=value extended attributes.
+func parseXattrs(value string) (map[string][]byte, error) {
+	xattrs := map[string][]byte{}
+	for _, xattr := range spec.SplitList(value) {
+		name, encoded, ok := strings.Cut(xattr, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid extended attribute %q: must be name=value", xattr)
+		}
+		decoded, err := decodeXattrValue(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid extended attribute %q: %w", name, err)
+		}
+		xattrs[name] = decoded
+	}
+	return xattrs, nil
+}
+
+// decodeXattrValue decodes a value in the getfattr encoding.
+func decodeXattrValue(value string) ([]byte, error) {
+	switch {
+	case strings.HasPrefix(value, "0x"), strings.HasPrefix(value, "0X"):
+		return hex.DecodeString(value[2:])
+	case strings.HasPrefix(value, "0s"), strings.HasPrefix(value, "0S"):
+		return base64.StdEncoding.DecodeString(value[2:])
+	default:
+		return []byte(strings.Trim(value, `"`)), nil
+	}
+}
+
+// tarXattrs returns the extended attributes stored in tar PAX records.
+func tarXattrs(records map[string]string) map[string][]byte {
+	var xattrs map[string][]byte
+	for key, value := range records {
+		name := strings.TrimPrefix(key, paxSchilyXattr)
+		if name == key || name == "" {
+			continue
+		}
+		if xattrs == nil {
+			xattrs = map[string][]byte{}
+		}
+		xattrs[name] = []byte(value)
+	}
+	return xattrs
+}
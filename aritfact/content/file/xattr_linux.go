@@ -0,0 +1,231 @@
+package file
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/containerd/containerd/pkg/cap"
+	"github.com/opencontainers/selinux/go-selinux"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// vfsCapRevision2 is the revision of the security.capability
+	// format supporting 64 capabilities.
+	vfsCapRevision2 = 0x02000000
+	// vfsCapFlagsEffective raises the permitted
+	// capabilities as effective on exec.
+	vfsCapFlagsEffective = 0x000001
+)
+
+// apply sets the extended attributes and SELinux
+// label on the path without following symbolic links.
+func (a extendedAttributes) apply(path string) error {
+	if a.label != "" {
+		if err := selinux.LsetFileLabel(path, a.label); err != nil {
+			return fmt.Errorf("failed to set SELinux label on %s: %w", path, err)
+		}
+	}
+	for name, value := range a.xattrs {
+		if err := unix.Lsetxattr(path, name, value, 0); err != nil {
+			return fmt.Errorf("failed to set extended attribute %s on %s: %w", name, path, err)
+		}
+	}
+	return nil
+}
+
+// lsetxattr sets an extended attribute on the
+// path without following symbolic links.
+func lsetxattr(path, attr string, value []byte) error {
+	if err := unix.Lsetxattr(path, attr, value, 0); err != nil {
+		return &os.PathError{Op: "lsetxattr", Path: path, Err: err}
+	}
+	return nil
+}
+
+// setTarXattrs sets the extended attributes stored in a tar header on the
+// extracted entry. Attributes that are not supported by the file system or
+// that require privileges are skipped, so extraction does not depend on the host.
+func setTarXattrs(root extractRoot, name string, xattrs map[string][]byte) error {
+	for attr, value := range xattrs {
+		if err := root.setxattr(name, attr, value); err != nil {
+			if errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EPERM) {
+				continue
+			}
+			return fmt.Errorf("failed to set extended attribute %s: %w", attr, err)
+		}
+	}
+	return nil
+}
+
+// encodeCapabilities encodes file capabilities in the libcap text format
+// (e.g. "cap_net_bind_service,cap_net_raw=+ep") as a security.capability
+// extended attribute value.
+func encodeCapabilities(text string) ([]byte, error) {
+	var effective, permitted, inheritable uint64
+	for _, clause := range strings.Fields(text) {
+		i := strings.IndexAny(clause, "=+-")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid capabilities %q: missing operator", clause)
+		}
+		caps, err := capabilityMask(clause[:i])
+		if err != nil {
+			return nil, err
+		}
+
+		actions := clause[i:]
+		for len(actions) > 0 {
+			op := actions[0]
+			end := strings.IndexAny(actions[1:], "=+-") + 1
+			if end == 0 {
+				end = len(actions)
+			}
+			flags := actions[1:end]
+			actions = actions[end:]
+
+			if op == '=' {
+				effective &^= caps
+				permitted &^= caps
+				inheritable &^= caps
+			}
+			for _, flag := range flags {
+				var set *uint64
+				switch flag {
+				case 'e':
+					set = &effective
+				case 'p':
+					set = &permitted
+				case 'i':
+					set = &inheritable
+				default:
+					return nil, fmt.Errorf("invalid capabilities %q: unknown flag %q", clause, flag)
+				}
+				if op == '-' {
+					*set &^= caps
+				} else {
+					*set |= caps
+				}
+			}
+		}
+	}
+
+	magic := uint32(vfsCapRevision2)
+	if effective != 0 {
+		magic |= vfsCapFlagsEffective
+	}
+	data := make([]byte, 20)
+	binary.LittleEndian.PutUint32(data[0:], magic)
+	binary.LittleEndian.PutUint32(data[4:], uint32(permitted))
+	binary.LittleEndian.PutUint32(data[8:], uint32(inheritable))
+	binary.LittleEndian.PutUint32(data[12:], uint32(permitted>>32))
+	binary.LittleEndian.PutUint32(data[16:], uint32(inheritable>>32))
+	return data, nil
+}
+
+// capabilityMask returns the bitmask for a comma
+// separated list of capability names.
+func capabilityMask(names string) (uint64, error) {
+	known := cap.Known()
+	var mask uint64
+	for _, name := range strings.Split(names, ",") {
+		name = strings.ToUpper(strings.TrimSpace(name))
+		if name == "ALL" || name == "" {
+			// An empty list applies to all capabilities, as with libcap.
+			for i := range known {
+				mask |= 1 << uint(i)
+			}
+			continue
+		}
+		if !strings.HasPrefix(name, "CAP_") {
+			name = "CAP_" + name
+		}
+		found := false
+		for i, c := range known {
+			if c == name {
+				mask |= 1 << uint(i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown capability %q", name)
+		}
+	}
+	return mask, nil
+}
+
+// xattrOverlayOpaque marks an overlay directory hiding
+// the entries of the lower directories.
+const xattrOverlayOpaque = "trusted.overlay.opaque"
+
+// isOpaque returns true if the directory is an opaque overlay directory.
+func isOpaque(path string) bool {
+	value := make([]byte, 1)
+	n, err := unix.Lgetxattr(path, xattrOverlayOpaque, value)
+	return err == nil && n == 1 && value[0] == 'y'
+}
+
+// copyXattrs copies the extended attributes of the source to the target
+// without following symbolic links. Overlay attributes are not copied, and
+// attributes that are not supported by the file system of the target or
+// that require privileges are skipped.
+func copyXattrs(target, src string) error {
+	names, err := listXattrs(src)
+	if err != nil {
+		if errors.Is(err, unix.ENOTSUP) {
+			return nil
+		}
+		return err
+	}
+	for _, name := range names {
+		if strings.HasPrefix(name, "trusted.overlay.") {
+			continue
+		}
+		value, err := getXattr(src, name)
+		if err != nil {
+			return err
+		}
+		if err := unix.Lsetxattr(target, name, value, 0); err != nil {
+			if errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EPERM) {
+				continue
+			}
+			return fmt.Errorf("failed to set extended attribute %s on %s: %w", name, target, err)
+		}
+	}
+	return nil
+}
+
+// listXattrs returns the names of the extended attributes of the path.
+func listXattrs(path string) ([]string, error) {
+	size, err := unix.Llistxattr(path, nil)
+	if err != nil || size == 0 {
+		return nil, err
+	}
+	buf := make([]byte, size)
+	if size, err = unix.Llistxattr(path, buf); err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, name := range strings.Split(string(buf[:size]), "\x00") {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// getXattr returns the value of an extended attribute of the path.
+func getXattr(path, name string) ([]byte, error) {
+	size, err := unix.Lgetxattr(path, name, nil)
+	if err != nil || size == 0 {
+		return nil, err
+	}
+	buf := make([]byte, size)
+	if size, err = unix.Lgetxattr(path, name, buf); err != nil {
+		return nil, err
+	}
+	return buf[:size], nil
+}
@@ -0,0 +1,181 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	uorspec "github.com/uor-framework/collection-spec/specs-go/v1alpha1"
+	"golang.org/x/sys/unix"
+
+	"github.com/jpower432/runc-attribute-wrapper/aritfact/spec"
+)
+
+// xattrDir returns a temporary directory supporting user extended
+// attributes, preferring tmpfs, and skips the test if there is none.
+func xattrDir(t *testing.T) string {
+	t.Helper()
+	var dir string
+	if shm, err := os.MkdirTemp("/dev/shm", "rcl-xattr-*"); err == nil {
+		t.Cleanup(func() { os.RemoveAll(shm) })
+		dir = shm
+	} else {
+		dir = t.TempDir()
+	}
+	if err := unix.Lsetxattr(dir, "user.rcl-test", []byte("1"), 0); err != nil {
+		t.Skipf("user extended attributes are not supported in %s: %v", dir, err)
+	}
+	return dir
+}
+
+// lgetxattr returns the value of an extended attribute of the path.
+func lgetxattr(t *testing.T, path, attr string) []byte {
+	t.Helper()
+	buf := make([]byte, 256)
+	n, err := unix.Lgetxattr(path, attr, buf)
+	if err != nil {
+		t.Fatalf("failed to get extended attribute %s of %s: %v", attr, path, err)
+	}
+	return buf[:n]
+}
+
+// vfsCap is a decoded security.capability value.
+type vfsCap struct {
+	magic                  uint32
+	permitted, inheritable uint64
+}
+
+func decodeVFSCap(t *testing.T, data []byte) vfsCap {
+	t.Helper()
+	if len(data) != 20 {
+		t.Fatalf("capability value has %d bytes, want 20", len(data))
+	}
+	return vfsCap{
+		magic:       binary.LittleEndian.Uint32(data[0:]),
+		permitted:   uint64(binary.LittleEndian.Uint32(data[4:])) | uint64(binary.LittleEndian.Uint32(data[12:]))<<32,
+		inheritable: uint64(binary.LittleEndian.Uint32(data[8:])) | uint64(binary.LittleEndian.Uint32(data[16:]))<<32,
+	}
+}
+
+func TestEncodeCapabilities(t *testing.T) {
+	const (
+		capChown             = 1 << unix.CAP_CHOWN
+		capSetuid            = 1 << unix.CAP_SETUID
+		capNetBindService    = 1 << unix.CAP_NET_BIND_SERVICE
+		capNetRaw            = 1 << unix.CAP_NET_RAW
+		capSysAdmin          = 1 << unix.CAP_SYS_ADMIN
+		capCheckpointRestore = 1 << unix.CAP_CHECKPOINT_RESTORE
+	)
+	effective := uint32(vfsCapRevision2 | vfsCapFlagsEffective)
+	all, err := capabilityMask("all")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		text    string
+		want    vfsCap
+		wantErr bool
+	}{
+		{
+			name: "effective and permitted",
+			text: "cap_net_bind_service=+ep",
+			want: vfsCap{magic: effective, permitted: capNetBindService},
+		},
+		{
+			name: "list without prefix",
+			text: "net_raw,CAP_CHOWN+p",
+			want: vfsCap{magic: vfsCapRevision2, permitted: capNetRaw | capChown},
+		},
+		{
+			name: "inheritable",
+			text: "cap_setuid=i",
+			want: vfsCap{magic: vfsCapRevision2, inheritable: capSetuid},
+		},
+		{
+			name: "clauses applied in order",
+			text: "all=p cap_sys_admin-p",
+			want: vfsCap{magic: vfsCapRevision2, permitted: all &^ capSysAdmin},
+		},
+		{
+			name: "assignment resets",
+			text: "cap_chown+pi cap_chown=e",
+			want: vfsCap{magic: effective},
+		},
+		{
+			name: "high capability",
+			text: "cap_checkpoint_restore+p",
+			want: vfsCap{magic: vfsCapRevision2, permitted: capCheckpointRestore},
+		},
+		{name: "missing operator", text: "cap_chown", wantErr: true},
+		{name: "unknown flag", text: "cap_chown=+x", wantErr: true},
+		{name: "unknown capability", text: "cap_bogus=+p", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := encodeCapabilities(tt.text)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("encodeCapabilities() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := decodeVFSCap(t, data); got != tt.want {
+				t.Errorf("encodeCapabilities() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtendedAttributesApply(t *testing.T) {
+	dir := xattrDir(t)
+	path := filepath.Join(dir, "file")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	attrs, err := newExtendedAttributes(spec.File{Xattrs: "user.origin=build,user.bin=0x00ff"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := attrs.apply(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := lgetxattr(t, path, "user.origin"); string(got) != "build" {
+		t.Errorf("user.origin = %q, want %q", got, "build")
+	}
+	if got := lgetxattr(t, path, "user.bin"); !bytes.Equal(got, []byte{0x00, 0xff}) {
+		t.Errorf("user.bin = %x, want 00ff", got)
+	}
+}
+
+func TestPushFileXattrs(t *testing.T) {
+	ctx := context.Background()
+	dir := xattrDir(t)
+	s := New(dir)
+	defer s.Close()
+
+	content := []byte("#!/bin/sh\n")
+	file := &uorspec.File{Permissions: 0755, UID: -1, GID: -1}
+	entry := spec.File{Xattrs: "user.origin=build", Capabilities: "cap_net_bind_service=+ep"}
+	desc := entryDescriptor(t, "bin/server", content, file, entry)
+	if err := s.Push(ctx, desc, bytes.NewReader(content)); err != nil {
+		if errors.Is(err, unix.EPERM) || errors.Is(err, unix.ENOTSUP) {
+			t.Skipf("file capabilities are not supported: %v", err)
+		}
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "bin", "server")
+	if got := lgetxattr(t, path, "user.origin"); string(got) != "build" {
+		t.Errorf("user.origin = %q, want %q", got, "build")
+	}
+	want := vfsCap{magic: vfsCapRevision2 | vfsCapFlagsEffective, permitted: 1 << unix.CAP_NET_BIND_SERVICE}
+	if got := decodeVFSCap(t, lgetxattr(t, path, xattrCapability)); got != want {
+		t.Errorf("%s = %+v, want %+v", xattrCapability, got, want)
+	}
+}
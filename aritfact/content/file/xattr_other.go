@@ -0,0 +1,48 @@
+//go:build !linux
+
+package file
+
+import (
+	"errors"
+)
+
+var errXattrsNotSupported = errors.New("extended attributes are not supported on this platform")
+
+// apply sets the extended attributes and SELinux
+// label on the path without following symbolic links.
+func (a extendedAttributes) apply(path string) error {
+	if a.empty() {
+		return nil
+	}
+	return errXattrsNotSupported
+}
+
+// lsetxattr sets an extended attribute on the
+// path without following symbolic links.
+func lsetxattr(path, attr string, value []byte) error {
+	return errXattrsNotSupported
+}
+
+// setTarXattrs is a no-op, extended attributes
+// from tar headers are skipped on this platform.
+func setTarXattrs(root extractRoot, name string, xattrs map[string][]byte) error {
+	return nil
+}
+
+// encodeCapabilities encodes file capabilities as a
+// security.capability extended attribute value.
+func encodeCapabilities(text string) ([]byte, error) {
+	return nil, errXattrsNotSupported
+}
+
+// isOpaque returns false, opaque overlay
+// directories are not supported on this platform.
+func isOpaque(path string) bool {
+	return false
+}
+
+// copyXattrs is a no-op, extended attributes
+// are not copied on this platform.
+func copyXattrs(target, src string) error {
+	return nil
+}
@@ -0,0 +1,90 @@
+package file
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/jpower432/runc-attribute-wrapper/aritfact/spec"
+)
+
+func TestParseXattrs(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    map[string][]byte
+		wantErr bool
+	}{
+		{name: "empty", want: map[string][]byte{}},
+		{
+			name:  "text",
+			value: `user.origin=build, user.quoted="a b"`,
+			want:  map[string][]byte{"user.origin": []byte("build"), "user.quoted": []byte("a b")},
+		},
+		{
+			name:  "hex",
+			value: "user.bin=0x00ff,user.upper=0X0A",
+			want:  map[string][]byte{"user.bin": {0x00, 0xff}, "user.upper": {0x0a}},
+		},
+		{
+			name:  "base64",
+			value: "user.b64=0sAAE=",
+			want:  map[string][]byte{"user.b64": {0x00, 0x01}},
+		},
+		{name: "empty value", value: "user.empty=", want: map[string][]byte{"user.empty": {}}},
+		{name: "missing value", value: "user.origin", wantErr: true},
+		{name: "missing name", value: "=build", wantErr: true},
+		{name: "invalid hex", value: "user.bin=0xzz", wantErr: true},
+		{name: "invalid base64", value: "user.b64=0s!", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseXattrs(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseXattrs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("parseXattrs() = %q, want %q", got, tt.want)
+			}
+			for name, value := range tt.want {
+				if !bytes.Equal(got[name], value) {
+					t.Errorf("parseXattrs()[%s] = %q, want %q", name, got[name], value)
+				}
+			}
+		})
+	}
+}
+
+func TestTarXattrs(t *testing.T) {
+	got := tarXattrs(map[string]string{
+		"SCHILY.xattr.user.origin": "build",
+		"SCHILY.xattr.":            "ignored",
+		"path":                     "ignored",
+	})
+	if len(got) != 1 || string(got["user.origin"]) != "build" {
+		t.Errorf("tarXattrs() = %q", got)
+	}
+	if got := tarXattrs(map[string]string{"path": "file"}); got != nil {
+		t.Errorf("tarXattrs() = %q, want nil", got)
+	}
+}
+
+func TestNewExtendedAttributes(t *testing.T) {
+	file := spec.File{Xattrs: "user.origin=build", SELinuxLabel: "system_u:object_r:container_file_t:s0"}
+	attrs, err := newExtendedAttributes(file, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attrs.empty() || attrs.label != file.SELinuxLabel || string(attrs.xattrs["user.origin"]) != "build" {
+		t.Errorf("newExtendedAttributes() = %+v", attrs)
+	}
+	if attrs, err := newExtendedAttributes(spec.File{}, true); err != nil || !attrs.empty() {
+		t.Errorf("newExtendedAttributes() = %+v, %v, want empty", attrs, err)
+	}
+	// Capabilities are only supported on regular files.
+	if _, err := newExtendedAttributes(spec.File{Capabilities: "cap_chown=ep"}, false); err == nil {
+		t.Error("capabilities accepted for an entry other than a regular file")
+	}
+}
@@ -0,0 +1,390 @@
+package aritfact
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"time"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/diff"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/log"
+	"github.com/containerd/containerd/mount"
+	"github.com/containerd/containerd/platforms"
+	"github.com/containerd/containerd/rootfs"
+	"github.com/containerd/containerd/snapshots"
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	uorspec "github.com/uor-framework/collection-spec/specs-go/v1alpha1"
+	"github.com/uor-framework/uor-client-go/nodes/descriptor"
+
+	"github.com/jpower432/runc-attribute-wrapper/aritfact/content/file"
+)
+
+// ExportFormat is the format snapshots are exported to.
+type ExportFormat string
+
+const (
+	// ExportFormatImage exports a standard OCI image with
+	// a tar layer per committed snapshot of the chain.
+	ExportFormatImage ExportFormat = "image"
+	// ExportFormatCollection exports a collection
+	// with a blob per file of the snapshot.
+	ExportFormatCollection ExportFormat = "collection"
+)
+
+// ParseExportFormat parses an export format.
+func ParseExportFormat(format string) (ExportFormat, error) {
+	switch f := ExportFormat(format); f {
+	case ExportFormatImage, ExportFormatCollection:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unsupported export format %q: must be one of %s, %s", format, ExportFormatImage, ExportFormatCollection)
+	}
+}
+
+// ExportOpt configures Export.
+type ExportOpt func(*exporter)
+
+// exporter exports a snapshot into the content store.
+type exporter struct {
+	client      *containerd.Client
+	snapshotter string
+	format      ExportFormat
+	platform    ocispec.Platform
+	config      ocispec.ImageConfig
+	created     time.Time
+}
+
+// WithExportSnapshotter sets the snapshotter of the exported
+// snapshot. Defaults to the snapshotter of the namespace.
+func WithExportSnapshotter(name string) ExportOpt {
+	return func(e *exporter) {
+		e.snapshotter = name
+	}
+}
+
+// WithExportFormat sets the export format. Defaults to an image.
+func WithExportFormat(format ExportFormat) ExportOpt {
+	return func(e *exporter) {
+		e.format = format
+	}
+}
+
+// WithExportPlatform sets the platform of the exported
+// image. Defaults to the platform of the host.
+func WithExportPlatform(platform ocispec.Platform) ExportOpt {
+	return func(e *exporter) {
+		e.platform = platform
+	}
+}
+
+// WithExportConfig sets the runtime configuration of the exported image.
+// Collections declare the configuration with core-runtime attributes.
+func WithExportConfig(config ocispec.ImageConfig) ExportOpt {
+	return func(e *exporter) {
+		e.config = config
+	}
+}
+
+// WithExportCreated sets the creation time of the exported image, such as
+// the SOURCE_DATE_EPOCH time, so the same snapshot always produces the same
+// image configuration. Defaults to the current time.
+func WithExportCreated(created time.Time) ExportOpt {
+	return func(e *exporter) {
+		e.created = created
+	}
+}
+
+// Export exports the snapshot with the key into the content store as an
+// image with the name. The snapshot is either a committed snapshot, such
+// as the chain ID of the artifacts applied by ApplyArtifacts, or the active
+// snapshot of a container. Active snapshots are mounted again to be
+// exported, so the container must not be running. An existing image with
+// the name is updated.
+//
+// Images have a layer per committed snapshot of the chain, generated by the
+// diff service, and an active snapshot is the top layer. Collections have a
+// blob per file of the snapshot, titled by its path and described by
+// core-file attributes generated from its mode and owner, so unpacking the
+// collection constructs the same rootfs. Entries other than regular files are
+// declared with rcl-file attributes. Entries sharing an inode are declared as
+// hard links to the first of them in lexical order.
+func Export(ctx context.Context, client *containerd.Client, name, key string, opts ...ExportOpt) (images.Image, error) {
+	e := exporter{
+		client:   client,
+		format:   ExportFormatImage,
+		platform: platforms.DefaultSpec(),
+	}
+	for _, o := range opts {
+		o(&e)
+	}
+
+	ctx, done, err := client.WithLease(ctx)
+	if err != nil {
+		return images.Image{}, err
+	}
+	defer done(ctx)
+
+	sn, err := getSnapshotter(ctx, client, e.snapshotter)
+	if err != nil {
+		return images.Image{}, err
+	}
+
+	var manifest ocispec.Manifest
+	switch e.format {
+	case ExportFormatImage:
+		manifest, err = e.exportImage(ctx, sn, key)
+	case ExportFormatCollection:
+		manifest, err = e.exportCollection(ctx, sn, key)
+	default:
+		_, err = ParseExportFormat(string(e.format))
+	}
+	if err != nil {
+		return images.Image{}, fmt.Errorf("failed to export snapshot %s: %w", key, err)
+	}
+
+	target, err := e.writeManifest(ctx, manifest)
+	if err != nil {
+		return images.Image{}, err
+	}
+	return e.updateImage(ctx, name, target)
+}
+
+// exportImage writes a tar layer for each snapshot of the chain,
+// from the base snapshot, and the image configuration.
+func (e *exporter) exportImage(ctx context.Context, sn snapshots.Snapshotter, key string) (ocispec.Manifest, error) {
+	var chain []string
+	for parent := key; parent != ""; {
+		info, err := sn.Stat(ctx, parent)
+		if err != nil {
+			return ocispec.Manifest{}, err
+		}
+		chain = append([]string{parent}, chain...)
+		parent = info.Parent
+	}
+
+	var (
+		cs      = e.client.ContentStore()
+		differ  = e.client.DiffService()
+		layers  []ocispec.Descriptor
+		diffIDs []digest.Digest
+	)
+	for _, snapshot := range chain {
+		layer, err := rootfs.CreateDiff(ctx, snapshot, sn, differ, diff.WithMediaType(ocispec.MediaTypeImageLayerGzip))
+		if err != nil {
+			return ocispec.Manifest{}, fmt.Errorf("failed to create diff of snapshot %s: %w", snapshot, err)
+		}
+		info, err := cs.Info(ctx, layer.Digest)
+		if err != nil {
+			return ocispec.Manifest{}, err
+		}
+		diffID, err := digest.Parse(info.Labels["containerd.io/uncompressed"])
+		if err != nil {
+			return ocispec.Manifest{}, fmt.Errorf("layer %s has no uncompressed digest: %w", layer.Digest, err)
+		}
+		layers = append(layers, layer)
+		diffIDs = append(diffIDs, diffID)
+	}
+
+	created := e.created
+	if created.IsZero() {
+		created = time.Now()
+	}
+	created = created.UTC()
+	config, err := e.writeConfig(ctx, ocispec.MediaTypeImageConfig, ocispec.Image{
+		Created:      &created,
+		Architecture: e.platform.Architecture,
+		OS:           e.platform.OS,
+		Config:       e.config,
+		RootFS: ocispec.RootFS{
+			Type:    "layers",
+			DiffIDs: diffIDs,
+		},
+	})
+	if err != nil {
+		return ocispec.Manifest{}, err
+	}
+
+	return ocispec.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config:    config,
+		Layers:    layers,
+	}, nil
+}
+
+// exportCollection writes a blob for each entry of the mounted snapshot, in
+// lexical order of the paths, and the collection configuration.
+func (e *exporter) exportCollection(ctx context.Context, sn snapshots.Snapshotter, key string) (ocispec.Manifest, error) {
+	mounts, cleanup, err := snapshotMounts(ctx, sn, key)
+	if err != nil {
+		return ocispec.Manifest{}, err
+	}
+	defer cleanup()
+
+	var layers []ocispec.Descriptor
+	err = mount.WithTempMount(ctx, mounts, func(root string) error {
+		layers, err = writeEntries(ctx, e.client.ContentStore(), root)
+		return err
+	})
+	if err != nil {
+		return ocispec.Manifest{}, err
+	}
+
+	// Collection configurations only carry the platform.
+	config, err := e.writeConfig(ctx, uorspec.MediaTypeConfiguration, ocispec.Image{
+		Architecture: e.platform.Architecture,
+		OS:           e.platform.OS,
+	})
+	if err != nil {
+		return ocispec.Manifest{}, err
+	}
+
+	runtime, err := json.Marshal(e.config)
+	if err != nil {
+		return ocispec.Manifest{}, err
+	}
+	annotations, err := descriptor.AnnotationsFromAttributes(map[string]json.RawMessage{
+		descriptor.TypeRuntime: runtime,
+	})
+	if err != nil {
+		return ocispec.Manifest{}, err
+	}
+
+	return ocispec.Manifest{
+		Versioned:   specs.Versioned{SchemaVersion: 2},
+		MediaType:   ocispec.MediaTypeImageManifest,
+		Config:      config,
+		Layers:      layers,
+		Annotations: annotations,
+	}, nil
+}
+
+// writeEntries writes a blob for each entry of the root directory to the
+// content store, in lexical order of the paths, and returns the blobs.
+func writeEntries(ctx context.Context, cs content.Ingester, root string) ([]ocispec.Descriptor, error) {
+	store := file.New(root)
+	defer store.Close()
+
+	var layers []ocispec.Descriptor
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == root {
+			return err
+		}
+		name, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		desc, err := store.AddEntry(ctx, filepath.ToSlash(name), path)
+		if err != nil {
+			return err
+		}
+		rc, err := store.Fetch(ctx, desc)
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		if err := content.WriteBlob(ctx, cs, desc.Digest.String(), rc, desc); err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+		layers = append(layers, desc)
+		return nil
+	})
+	return layers, err
+}
+
+// snapshotMounts returns the mounts of the snapshot with the key. Committed
+// snapshots are mounted through a view, removed by the cleanup function.
+func snapshotMounts(ctx context.Context, sn snapshots.Snapshotter, key string) ([]mount.Mount, func(), error) {
+	info, err := sn.Stat(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if info.Kind != snapshots.KindCommitted {
+		mounts, err := sn.Mounts(ctx, key)
+		return mounts, func() {}, err
+	}
+
+	viewKey := fmt.Sprintf("export-view %s %s", key, uniquePart())
+	mounts, err := sn.View(ctx, viewKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return mounts, func() {
+		if err := sn.Remove(ctx, viewKey); err != nil && !errdefs.IsNotFound(err) {
+			log.G(ctx).WithError(err).Warnf("failed to remove snapshot %s", viewKey)
+		}
+	}, nil
+}
+
+// writeConfig writes the image configuration to the content store.
+func (e *exporter) writeConfig(ctx context.Context, mediaType string, config ocispec.Image) (ocispec.Descriptor, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	desc := ocispec.Descriptor{
+		MediaType: mediaType,
+		Digest:    digest.FromBytes(data),
+		Size:      int64(len(data)),
+	}
+	if err := content.WriteBlob(ctx, e.client.ContentStore(), desc.Digest.String(), bytes.NewReader(data), desc); err != nil {
+		return ocispec.Descriptor{}, fmt.Errorf("failed to write config: %w", err)
+	}
+	return desc, nil
+}
+
+// writeManifest writes the manifest to the content store, labeled
+// with references to its config and layers for garbage collection.
+func (e *exporter) writeManifest(ctx context.Context, manifest ocispec.Manifest) (ocispec.Descriptor, error) {
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	desc := ocispec.Descriptor{
+		MediaType: manifest.MediaType,
+		Digest:    digest.FromBytes(data),
+		Size:      int64(len(data)),
+		Platform:  &e.platform,
+	}
+
+	labels := map[string]string{
+		"containerd.io/gc.ref.content.config": manifest.Config.Digest.String(),
+	}
+	for i, layer := range manifest.Layers {
+		labels[fmt.Sprintf("containerd.io/gc.ref.content.l.%d", i)] = layer.Digest.String()
+	}
+	if err := content.WriteBlob(ctx, e.client.ContentStore(), desc.Digest.String(), bytes.NewReader(data), desc, content.WithLabels(labels)); err != nil {
+		return ocispec.Descriptor{}, fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return desc, nil
+}
+
+// updateImage creates the image with the name, or updates its target.
+func (e *exporter) updateImage(ctx context.Context, name string, target ocispec.Descriptor) (images.Image, error) {
+	is := e.client.ImageService()
+	img := images.Image{
+		Name:   name,
+		Target: target,
+	}
+	created, err := is.Create(ctx, img)
+	if err == nil {
+		return created, nil
+	}
+	if !errdefs.IsAlreadyExists(err) {
+		return images.Image{}, fmt.Errorf("failed to create image %s: %w", name, err)
+	}
+	updated, err := is.Update(ctx, img, "target")
+	if err != nil {
+		return images.Image{}, fmt.Errorf("failed to update image %s: %w", name, err)
+	}
+	return updated, nil
+}
@@ -0,0 +1,231 @@
+//go:build linux
+
+package aritfact
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/mount"
+	"github.com/containerd/containerd/pkg/userns"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func (m memoryStore) Fetch(_ context.Context, desc ocispec.Descriptor) (io.ReadCloser, error) {
+	b, ok := m[desc.Digest]
+	if !ok {
+		return nil, fmt.Errorf("content %s: %w", desc.Digest, errdefs.ErrNotFound)
+	}
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (m memoryStore) Writer(_ context.Context, opts ...content.WriterOpt) (content.Writer, error) {
+	var wOpts content.WriterOpts
+	for _, opt := range opts {
+		if err := opt(&wOpts); err != nil {
+			return nil, err
+		}
+	}
+	return &memoryWriter{store: m, ref: wOpts.Ref, started: time.Now()}, nil
+}
+
+// memoryWriter writes a blob to a memory store once committed.
+type memoryWriter struct {
+	store   memoryStore
+	ref     string
+	buf     bytes.Buffer
+	started time.Time
+}
+
+func (w *memoryWriter) Write(p []byte) (int, error) { return w.buf.Write(p) }
+
+func (w *memoryWriter) Close() error { return nil }
+
+func (w *memoryWriter) Digest() digest.Digest { return digest.FromBytes(w.buf.Bytes()) }
+
+func (w *memoryWriter) Commit(_ context.Context, size int64, expected digest.Digest, _ ...content.Opt) error {
+	if size > 0 && size != int64(w.buf.Len()) {
+		return fmt.Errorf("%s: size %d, want %d: %w", w.ref, w.buf.Len(), size, errdefs.ErrFailedPrecondition)
+	}
+	dgst := w.Digest()
+	if expected != "" && expected != dgst {
+		return fmt.Errorf("%s: digest %s, want %s: %w", w.ref, dgst, expected, errdefs.ErrFailedPrecondition)
+	}
+	w.store[dgst] = append([]byte(nil), w.buf.Bytes()...)
+	return nil
+}
+
+func (w *memoryWriter) Status() (content.Status, error) {
+	return content.Status{Ref: w.ref, Offset: int64(w.buf.Len()), StartedAt: w.started, UpdatedAt: time.Now()}, nil
+}
+
+func (w *memoryWriter) Truncate(size int64) error {
+	if size != 0 {
+		return fmt.Errorf("truncate to %d: %w", size, errdefs.ErrNotImplemented)
+	}
+	w.buf.Reset()
+	return nil
+}
+
+// topmost returns the path of the entry in the topmost layer containing it,
+// as the entry appears in the overlay mount of the layers.
+func topmost(t *testing.T, layers []string, name string) string {
+	t.Helper()
+	for i := len(layers) - 1; i >= 0; i-- {
+		path := filepath.Join(layers[i], name)
+		if _, err := os.Lstat(path); err == nil {
+			return path
+		}
+	}
+	t.Fatalf("%s not found in the layers", name)
+	return ""
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	if userns.RunningInUserNS() {
+		t.Skip("overlay snapshots are mounted to be applied in a user namespace")
+	}
+	collection := []struct {
+		name     string
+		content  string
+		mode     os.FileMode
+		linkname string
+		hardlink string
+	}{
+		{name: "app", mode: os.ModeDir | 0755},
+		{name: "app/bin", mode: os.ModeDir | 0711},
+		{name: "app/bin/tool", content: "tool", mode: 0755},
+		{name: "app/lib", mode: os.ModeDir | 0700},
+		{name: "app/lib/tool", hardlink: "app/bin/tool"},
+		{name: "app/link", mode: os.ModeSymlink, linkname: "bin/tool"},
+		{name: "empty", mode: os.ModeDir | 0750},
+		{name: "etc", mode: os.ModeDir | 0755},
+		// Files of the same content are distinct blobs.
+		{name: "etc/a", content: "config", mode: 0644},
+		{name: "etc/b", content: "config", mode: 0600},
+	}
+
+	root := t.TempDir()
+	for _, e := range collection {
+		path := filepath.Join(root, e.name)
+		var err error
+		switch {
+		case e.hardlink != "":
+			err = os.Link(filepath.Join(root, e.hardlink), path)
+		case e.mode&os.ModeSymlink != 0:
+			err = os.Symlink(e.linkname, path)
+		case e.mode.IsDir():
+			if err = os.Mkdir(path, e.mode.Perm()); err == nil {
+				err = os.Chmod(path, e.mode.Perm())
+			}
+		default:
+			if err = os.WriteFile(path, []byte(e.content), e.mode.Perm()); err == nil {
+				err = os.Chmod(path, e.mode.Perm())
+			}
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	store := memoryStore{}
+	blobs, err := writeEntries(context.Background(), store, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var titles []string
+	for _, desc := range blobs {
+		titles = append(titles, desc.Annotations[ocispec.AnnotationTitle])
+	}
+	if len(blobs) != len(collection) {
+		t.Fatalf("exported %s, want %d blobs", strings.Join(titles, ", "), len(collection))
+	}
+
+	// Apply each blob to its own overlay snapshot,
+	// on top of the snapshots of the earlier blobs.
+	a := &artifactApplier{store: store, tempRoot: t.TempDir()}
+	var layers []string
+	for _, desc := range blobs {
+		upper := t.TempDir()
+		lowers := []string{t.TempDir()}
+		if len(layers) > 0 {
+			lowers = nil
+			for i := len(layers) - 1; i >= 0; i-- {
+				lowers = append(lowers, layers[i])
+			}
+		}
+		mounts := []mount.Mount{{
+			Type:    "overlay",
+			Source:  "overlay",
+			Options: []string{"upperdir=" + upper, "lowerdir=" + strings.Join(lowers, ":"), "workdir=" + t.TempDir()},
+		}}
+		if _, err := a.Apply(context.Background(), desc, mounts); err != nil {
+			t.Fatalf("apply %s: %v", desc.Annotations[ocispec.AnnotationTitle], err)
+		}
+		layers = append(layers, upper)
+	}
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The overlay of the snapshots matches the exported root.
+	for _, e := range collection {
+		want, err := os.Lstat(filepath.Join(root, e.name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := topmost(t, layers, e.name)
+		got, err := os.Lstat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Mode() != want.Mode() {
+			t.Errorf("%s mode = %v, want %v", e.name, got.Mode(), want.Mode())
+		}
+		switch {
+		case want.Mode().IsRegular():
+			wantContent, err := os.ReadFile(filepath.Join(root, e.name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			content, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(content, wantContent) {
+				t.Errorf("%s content = %q, want %q", e.name, content, wantContent)
+			}
+		case want.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if link != e.linkname {
+				t.Errorf("%s link = %s, want %s", e.name, link, e.linkname)
+			}
+		}
+	}
+
+	// The hard link is preserved.
+	target, err := os.Lstat(topmost(t, layers, "app/bin/tool"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	link, err := os.Lstat(topmost(t, layers, "app/lib/tool"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(target, link) {
+		t.Error("app/lib/tool is not a hard link to app/bin/tool")
+	}
+}
@@ -0,0 +1,296 @@
+package aritfact
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/log"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/uor-framework/uor-client-go/model"
+	"github.com/uor-framework/uor-client-go/model/traversal"
+	"github.com/uor-framework/uor-client-go/nodes/collection"
+	"github.com/uor-framework/uor-client-go/nodes/collection/loader"
+	v2 "github.com/uor-framework/uor-client-go/nodes/descriptor/v2"
+)
+
+// Graph is the collection graph of an image. Its nodes are the index,
+// manifests and blobs of the image, identified by digest, with edges
+// from each manifest to its successors. Blobs with the same digest are
+// the same node, with the attributes of the first descriptor loaded.
+// The layer descriptors of the manifests are kept, so blobs with the
+// same content under different titles are found once per title.
+//
+// A Graph is not safe for concurrent modification.
+type Graph struct {
+	*collection.Collection
+
+	root ocispec.Descriptor
+	// layers are the distinct layer descriptors
+	// of the manifests, by node ID.
+	layers map[string][]*v2.Node
+}
+
+// LoadGraph loads the collection graph rooted at the target from the
+// content provider, following the links to collections in the provider.
+// Manifests missing from the provider, such as the manifests of other
+// platforms or linked collections which were not pulled, are leaf nodes.
+func LoadGraph(ctx context.Context, provider content.Provider, target ocispec.Descriptor) (*Graph, error) {
+	graph := collection.New(target.Digest.String())
+	layers := map[string][]*v2.Node{}
+	fetcher := func(ctx context.Context, desc ocispec.Descriptor) ([]byte, error) {
+		data, err := content.ReadBlob(ctx, provider, desc)
+		if err != nil {
+			return nil, err
+		}
+		if err := addLayers(layers, data); err != nil {
+			return nil, fmt.Errorf("manifest %s: %w", desc.Digest, err)
+		}
+		return data, nil
+	}
+
+	seen := map[string]struct{}{}
+	queue := []ocispec.Descriptor{target}
+	for len(queue) > 0 {
+		desc := queue[0]
+		queue = queue[1:]
+		id := desc.Digest.String()
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+
+		err := loader.AddManifest(ctx, graph, fetcher, desc)
+		if errdefs.IsNotFound(err) && id != target.Digest.String() {
+			log.G(ctx).Debugf("manifest %s not found, adding as leaf", id)
+			err = addLeaf(graph, desc)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %s into graph: %w", id, err)
+		}
+		for _, successor := range graph.From(id) {
+			if n, ok := successor.(*v2.Node); ok {
+				queue = append(queue, n.Descriptor())
+			}
+		}
+	}
+	return &Graph{Collection: graph, root: target, layers: layers}, nil
+}
+
+// addLayers adds the layers or blobs of the manifest
+// to the layer descriptors, skipping known descriptors.
+func addLayers(layers map[string][]*v2.Node, manifest []byte) error {
+	var m struct {
+		Layers []ocispec.Descriptor `json:"layers"`
+		Blobs  []ocispec.Descriptor `json:"blobs"`
+	}
+	if err := json.Unmarshal(manifest, &m); err != nil {
+		return err
+	}
+next:
+	for _, desc := range append(m.Layers, m.Blobs...) {
+		id := desc.Digest.String()
+		for _, n := range layers[id] {
+			if reflect.DeepEqual(n.Descriptor(), desc) {
+				continue next
+			}
+		}
+		node, err := v2.NewNode(id, desc)
+		if err != nil {
+			return err
+		}
+		layers[id] = append(layers[id], node)
+	}
+	return nil
+}
+
+// addLeaf adds a descriptor without successors to the graph.
+func addLeaf(graph *collection.Collection, desc ocispec.Descriptor) error {
+	if graph.HasNode(desc.Digest.String()) {
+		return nil
+	}
+	node, err := v2.NewNode(desc.Digest.String(), desc)
+	if err != nil {
+		return err
+	}
+	return graph.AddNode(node)
+}
+
+// Graph returns the collection graph of the image,
+// loaded from the content store.
+func (i *image) Graph(ctx context.Context) (*Graph, error) {
+	return LoadGraph(ctx, i.ContentStore(), i.Target())
+}
+
+// RootDescriptor returns the descriptor the graph was loaded from.
+func (g *Graph) RootDescriptor() ocispec.Descriptor {
+	return g.root
+}
+
+// Descriptors returns the descriptors of the nodes, sorted by digest.
+func (g *Graph) Descriptors() []ocispec.Descriptor {
+	return descriptors(g.Nodes())
+}
+
+// Successors returns the descriptors the node points to, sorted by digest.
+func (g *Graph) Successors(desc ocispec.Descriptor) []ocispec.Descriptor {
+	return descriptors(g.From(desc.Digest.String()))
+}
+
+// Predecessors returns the descriptors pointing to the node, sorted by digest.
+func (g *Graph) Predecessors(desc ocispec.Descriptor) []ocispec.Descriptor {
+	return descriptors(g.To(desc.Digest.String()))
+}
+
+// Find returns the descriptor nodes satisfying the matcher, sorted by
+// digest and title. Blobs are matched once per distinct layer descriptor,
+// so a blob listed under several titles is found once per matching title.
+func (g *Graph) Find(matcher model.Matcher) ([]*v2.Node, error) {
+	var nodes []*v2.Node
+	for _, node := range g.Nodes() {
+		for _, n := range g.descriptorNodes(node) {
+			match, err := matcher.Matches(n)
+			if err != nil {
+				return nil, fmt.Errorf("node %s: %w", n.ID(), err)
+			}
+			if match {
+				nodes = append(nodes, n)
+			}
+		}
+	}
+	sort.SliceStable(nodes, func(i, j int) bool {
+		if nodes[i].ID() != nodes[j].ID() {
+			return nodes[i].ID() < nodes[j].ID()
+		}
+		return nodes[i].Descriptor().Annotations[ocispec.AnnotationTitle] < nodes[j].Descriptor().Annotations[ocispec.AnnotationTitle]
+	})
+	return nodes, nil
+}
+
+// SubCollection returns the graph of the nodes satisfying the matcher,
+// with the edges between them. Blobs are kept if any of their layer
+// descriptors satisfies the matcher.
+func (g *Graph) SubCollection(matcher model.Matcher) (*Graph, error) {
+	sub, err := g.Collection.SubCollection(MatcherFunc(func(node model.Node) (bool, error) {
+		for _, n := range g.descriptorNodes(node) {
+			if match, err := matcher.Matches(n); match || err != nil {
+				return match, err
+			}
+		}
+		return false, nil
+	}))
+	if err != nil {
+		return nil, err
+	}
+	return &Graph{Collection: &sub, root: g.root, layers: g.layers}, nil
+}
+
+// descriptorNodes returns the layer descriptors of the node,
+// or the node itself if it is not a layer of a manifest.
+func (g *Graph) descriptorNodes(node model.Node) []*v2.Node {
+	if layers, ok := g.layers[node.ID()]; ok {
+		return layers
+	}
+	if n, ok := node.(*v2.Node); ok {
+		return []*v2.Node{n}
+	}
+	return nil
+}
+
+// WalkFunc is called for each node visited by Walk with the
+// node and its parent, which is nil for the root node.
+type WalkFunc func(node, parent *v2.Node) error
+
+// Walk walks the graph depth first from the root node, visiting
+// each node once. Successors are visited in digest order.
+func (g *Graph) Walk(ctx context.Context, fn WalkFunc) error {
+	root, ok := g.NodeByID(g.root.Digest.String()).(*v2.Node)
+	if !ok {
+		return fmt.Errorf("root %s not in graph: %w", g.root.Digest, errdefs.ErrNotFound)
+	}
+
+	seen := map[string]struct{}{}
+	handler := traversal.HandlerFunc(func(ctx context.Context, tracker traversal.Tracker, node model.Node) ([]model.Node, error) {
+		if _, ok := seen[node.ID()]; ok {
+			return nil, traversal.ErrSkip
+		}
+		seen[node.ID()] = struct{}{}
+
+		n, ok := node.(*v2.Node)
+		if !ok {
+			return nil, traversal.ErrSkip
+		}
+		parent, _ := tracker.Path.Prev(node).(*v2.Node)
+		if err := fn(n, parent); err != nil {
+			return nil, err
+		}
+
+		successors := g.From(node.ID())
+		sort.Slice(successors, func(i, j int) bool { return successors[i].ID() < successors[j].ID() })
+		return successors, nil
+	})
+	return traversal.NewTracker(root, nil).Walk(ctx, handler, root)
+}
+
+// descriptors returns the descriptors of the descriptor nodes, sorted by digest.
+func descriptors(nodes []model.Node) []ocispec.Descriptor {
+	var descs []ocispec.Descriptor
+	for _, node := range nodes {
+		if n, ok := node.(*v2.Node); ok {
+			descs = append(descs, n.Descriptor())
+		}
+	}
+	sort.Slice(descs, func(i, j int) bool { return descs[i].Digest < descs[j].Digest })
+	return descs
+}
+
+// MatcherFunc is a function implementing model.Matcher.
+type MatcherFunc func(node model.Node) (bool, error)
+
+// Matches calls the function.
+func (f MatcherFunc) Matches(node model.Node) (bool, error) {
+	return f(node)
+}
+
+// MatchPath matches the blobs providing the file at the path, which
+// is the title of the blob relative to the rootfs. Used with Find and
+// SubCollection, it matches each title of the blobs.
+func MatchPath(p string) model.Matcher {
+	want := cleanTitle(p)
+	return MatcherFunc(func(node model.Node) (bool, error) {
+		n, ok := node.(*v2.Node)
+		if !ok {
+			return false, nil
+		}
+		title, ok := n.Descriptor().Annotations[ocispec.AnnotationTitle]
+		return ok && cleanTitle(title) == want, nil
+	})
+}
+
+// cleanTitle returns the path of a title relative to the rootfs.
+func cleanTitle(title string) string {
+	return strings.TrimPrefix(path.Clean("/"+title), "/")
+}
+
+// MatchLicense matches the nodes whose core-descriptor
+// attributes list the license, ignoring case.
+func MatchLicense(license string) model.Matcher {
+	return MatcherFunc(func(node model.Node) (bool, error) {
+		n, ok := node.(*v2.Node)
+		if !ok || n.Properties == nil || n.Properties.Descriptor == nil {
+			return false, nil
+		}
+		for _, l := range n.Properties.Descriptor.Licenses {
+			if strings.EqualFold(l, license) {
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+}
@@ -0,0 +1,189 @@
+package aritfact
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/uor-framework/uor-client-go/model"
+	v2 "github.com/uor-framework/uor-client-go/nodes/descriptor/v2"
+)
+
+// titledBlob returns the descriptor of a blob
+// titled title, without attributes.
+func titledBlob(title, content string) ocispec.Descriptor {
+	return ocispec.Descriptor{
+		MediaType:   "application/octet-stream",
+		Digest:      digest.FromString(content),
+		Size:        int64(len(content)),
+		Annotations: map[string]string{ocispec.AnnotationTitle: title},
+	}
+}
+
+// titles returns the digests and titles of the nodes.
+func titles(nodes []*v2.Node) []string {
+	var got []string
+	for _, n := range nodes {
+		desc := n.Descriptor()
+		got = append(got, desc.Digest.Encoded()[:4]+" "+desc.Annotations[ocispec.AnnotationTitle])
+	}
+	return got
+}
+
+// nodesOf returns the descriptor nodes of the descriptors.
+func nodesOf(t *testing.T, descs ...ocispec.Descriptor) []*v2.Node {
+	t.Helper()
+	var nodes []*v2.Node
+	for _, desc := range descs {
+		n, err := v2.NewNode(desc.Digest.String(), desc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nodes = append(nodes, n)
+	}
+	return nodes
+}
+
+// sortedNodes sorts the nodes by digest and title, as Find does.
+func sortedNodes(nodes []*v2.Node) []*v2.Node {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		if nodes[i].ID() != nodes[j].ID() {
+			return nodes[i].ID() < nodes[j].ID()
+		}
+		return nodes[i].Descriptor().Annotations[ocispec.AnnotationTitle] < nodes[j].Descriptor().Annotations[ocispec.AnnotationTitle]
+	})
+	return nodes
+}
+
+func TestLoadGraph(t *testing.T) {
+	store := memoryStore{}
+	blob := titledBlob("bin/tool", "tool")
+	config := store.add(t, "application/vnd.uor.config.v1+json", map[string]string{})
+	manifest := store.add(t, ocispec.MediaTypeImageManifest, ocispec.Manifest{
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config:    config,
+		Layers:    []ocispec.Descriptor{blob},
+	})
+	// The manifest of the other platform was not pulled.
+	missing := ocispec.Descriptor{MediaType: ocispec.MediaTypeImageManifest, Digest: digest.FromString("missing"), Size: 7}
+	index := store.add(t, ocispec.MediaTypeImageIndex, ocispec.Index{
+		MediaType: ocispec.MediaTypeImageIndex,
+		Manifests: []ocispec.Descriptor{manifest, missing},
+	})
+
+	graph, err := LoadGraph(context.Background(), store, index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := graph.RootDescriptor(); got.Digest != index.Digest {
+		t.Errorf("RootDescriptor() = %s, want %s", got.Digest, index.Digest)
+	}
+	if got := len(graph.Descriptors()); got != 5 {
+		t.Errorf("Descriptors() has %d nodes, want 5", got)
+	}
+	if got := graph.Successors(missing); len(got) != 0 {
+		t.Errorf("Successors(missing manifest) = %v, want none", got)
+	}
+	successors := graph.Successors(manifest)
+	if len(successors) != 2 {
+		t.Fatalf("Successors(manifest) = %v, want the config and blob", successors)
+	}
+	for _, desc := range successors {
+		if desc.Digest != config.Digest && desc.Digest != blob.Digest {
+			t.Errorf("unexpected successor %s", desc.Digest)
+		}
+	}
+	if got := graph.Predecessors(blob); len(got) != 1 || got[0].Digest != manifest.Digest {
+		t.Errorf("Predecessors(blob) = %v, want the manifest", got)
+	}
+
+	// The target is always loaded.
+	if _, err := LoadGraph(context.Background(), store, missing); err == nil {
+		t.Error("LoadGraph() of a missing target succeeded, want an error")
+	}
+}
+
+func TestGraphFind(t *testing.T) {
+	tool := componentBlob(t, "bin/tool", "tool", "tool", "MIT")
+	// The same content under another title, without attributes.
+	link := titledBlob("usr/bin/tool", "tool")
+	lib := componentBlob(t, "lib/libtool.so", "libtool", "libtool", "Apache-2.0")
+	// Directories have no content, so they share a digest.
+	etc := titledBlob("etc/", "")
+	usr := titledBlob("/usr/", "")
+	graph := collectionGraph(t, memoryStore{}, tool, link, lib, etc, usr)
+
+	isBlob := MatcherFunc(func(node model.Node) (bool, error) {
+		n, ok := node.(*v2.Node)
+		return ok && n.Descriptor().MediaType == "application/octet-stream", nil
+	})
+	tests := []struct {
+		name    string
+		matcher model.Matcher
+		want    []*v2.Node
+	}{
+		{name: "path", matcher: MatchPath("/bin/tool"), want: nodesOf(t, tool)},
+		{name: "path of duplicate content", matcher: MatchPath("usr/bin/tool"), want: nodesOf(t, link)},
+		{name: "directory path", matcher: MatchPath("etc"), want: nodesOf(t, etc)},
+		{name: "other directory path", matcher: MatchPath("/usr"), want: nodesOf(t, usr)},
+		{name: "missing path", matcher: MatchPath("bin/other")},
+		{name: "license", matcher: MatchLicense("mit"), want: nodesOf(t, tool)},
+		{name: "every title", matcher: isBlob, want: nodesOf(t, tool, link, lib, etc, usr)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := graph.Find(tt.matcher)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := sortedNodes(tt.want)
+			if !reflect.DeepEqual(titles(got), titles(want)) {
+				t.Errorf("Find() = %v, want %v", titles(got), titles(want))
+			}
+			for i := range got {
+				if i < len(want) && !reflect.DeepEqual(got[i].Descriptor(), want[i].Descriptor()) {
+					t.Errorf("Find()[%d] = %+v, want %+v", i, got[i].Descriptor(), want[i].Descriptor())
+				}
+			}
+		})
+	}
+}
+
+func TestGraphSubCollection(t *testing.T) {
+	tool := componentBlob(t, "bin/tool", "tool", "tool")
+	link := titledBlob("usr/bin/tool", "tool")
+	lib := titledBlob("lib/libtool.so", "libtool")
+	graph := collectionGraph(t, memoryStore{}, tool, link, lib)
+
+	// The blob is kept by its second title.
+	sub, err := graph.SubCollection(MatchPath("usr/bin/tool"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := sub.Descriptors()
+	if len(got) != 1 || got[0].Digest != tool.Digest {
+		t.Fatalf("SubCollection() = %v, want the tool blob", got)
+	}
+	if got := sub.RootDescriptor(); got.Digest != graph.RootDescriptor().Digest {
+		t.Errorf("RootDescriptor() = %s, want %s", got.Digest, graph.RootDescriptor().Digest)
+	}
+	// The sub collection keeps the titles of the blob.
+	nodes, err := sub.Find(MatchPath("bin/tool"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(titles(nodes), titles(nodesOf(t, tool))) {
+		t.Errorf("Find() = %v, want %v", titles(nodes), titles(nodesOf(t, tool)))
+	}
+
+	sub, err = graph.SubCollection(MatchPath("bin/other"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sub.Descriptors(); len(got) != 0 {
+		t.Errorf("SubCollection() = %v, want no nodes", got)
+	}
+}
@@ -5,18 +5,23 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/containerd/containerd"
 	"github.com/containerd/containerd/content"
 	"github.com/containerd/containerd/defaults"
 	"github.com/containerd/containerd/errdefs"
 	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/log"
 	"github.com/containerd/containerd/platforms"
 	"github.com/containerd/containerd/snapshots"
 	"github.com/opencontainers/go-digest"
 	"github.com/opencontainers/image-spec/identity"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	v2 "github.com/uor-framework/uor-client-go/nodes/descriptor/v2"
+
+	"github.com/jpower432/runc-attribute-wrapper/aritfact/content/file"
+	"github.com/jpower432/runc-attribute-wrapper/aritfact/spec"
 )
 
 // Image describes an image used by containers.
@@ -39,6 +44,8 @@ type Image interface {
 	Config(ctx context.Context) (ocispec.Descriptor, error)
 	// ConfigWithAttributes return image config information.
 	ConfigWithAttributes(ctx context.Context) (ocispec.ImageConfig, error)
+	// Attributes decodes the manifest attribute set for a schema ID.
+	Attributes(ctx context.Context, schemaID string, v interface{}) (bool, error)
 	// IsUnpacked returns whether or not an image is unpacked.
 	IsUnpacked(context.Context, string) (bool, error)
 	// ContentStore provides a content store which contains image blob data
@@ -49,27 +56,95 @@ type Image interface {
 	Platform() platforms.MatchComparer
 	// Spec returns the OCI image spec for a given image.
 	Spec(ctx context.Context) (ocispec.Image, error)
+	// Graph returns the collection graph of the image.
+	Graph(ctx context.Context) (*Graph, error)
+	// CheckLicenses checks the unpacked components against the license policy.
+	CheckLicenses(ctx context.Context) error
+	// Components returns the components declared across the collection graph.
+	Components(ctx context.Context) ([]Component, error)
 }
 
 var _ = (Image)(&image{})
 
+// ImageOpt configures how the image is unpacked.
+type ImageOpt func(*image)
+
+// WithSelector only unpacks the blobs selected by the selector. Since the
+// snapshots are identified by the chain of applied blobs, images unpacked
+// with different selections do not share snapshots, unless the same blobs
+// are selected.
+func WithSelector(selector Selector) ImageOpt {
+	return func(i *image) {
+		i.selector = selector
+	}
+}
+
+// WithDedupe shares the storage of unpacked files with the blobs of the
+// local content store at contentRoot using the dedupe mode.
+func WithDedupe(mode file.DedupeMode, contentRoot string) ImageOpt {
+	return func(i *image) {
+		i.dedupe = mode
+		i.contentRoot = contentRoot
+	}
+}
+
+// WithExtractLimits bounds the size, number of entries and path depth of the
+// unpacked directory blobs. Defaults to file.DefaultExtractLimits.
+func WithExtractLimits(limits file.ExtractLimits) ImageOpt {
+	return func(i *image) {
+		i.extractLimits = limits
+	}
+}
+
+// WithTempDir sets the directory of the temporary files created while
+// unpacking, such as buffered zip archives. They are removed once unpacked.
+// Defaults to the system temporary directory.
+func WithTempDir(dir string) ImageOpt {
+	return func(i *image) {
+		i.tempDir = dir
+	}
+}
+
+// WithSourceDateEpoch sets the default modification and access time of
+// unpacked files and directories, following the SOURCE_DATE_EPOCH
+// convention for reproducible builds. Since the file system metadata depends
+// on it, the epoch is part of the snapshot chain IDs, and images unpacked
+// with different epochs, or without one, do not share snapshots.
+func WithSourceDateEpoch(epoch time.Time) ImageOpt {
+	return func(i *image) {
+		i.sourceDateEpoch = epoch
+	}
+}
+
 // NewImage returns a client image object from the metadata image.
-func NewImage(client *containerd.Client, i images.Image, cI containerd.Image) Image {
-	return &image{
-		client:   client,
-		i:        i,
-		image:    cI,
-		platform: cI.Platform(),
+func NewImage(client *containerd.Client, i images.Image, cI containerd.Image, opts ...ImageOpt) Image {
+	img := &image{
+		client:        client,
+		i:             i,
+		image:         cI,
+		platform:      cI.Platform(),
+		extractLimits: file.DefaultExtractLimits,
 	}
+	for _, o := range opts {
+		o(img)
+	}
+	return img
 }
 
 // NewImageWithPlatform returns a client image object from the metadata image
-func NewImageWithPlatform(client *containerd.Client, i images.Image, platform platforms.MatchComparer) Image {
-	return &image{
-		client:   client,
-		i:        i,
-		platform: platform,
+// with content selected by the platform.
+func NewImageWithPlatform(client *containerd.Client, i images.Image, platform platforms.MatchComparer, opts ...ImageOpt) Image {
+	img := &image{
+		client:        client,
+		i:             i,
+		image:         containerd.NewImageWithPlatform(client, i, platform),
+		platform:      platform,
+		extractLimits: file.DefaultExtractLimits,
 	}
+	for _, o := range opts {
+		o(img)
+	}
+	return img
 }
 
 type image struct {
@@ -78,6 +153,28 @@ type image struct {
 	i        images.Image
 	image    containerd.Image
 	platform platforms.MatchComparer
+
+	// selector selects the unpacked blobs.
+	selector Selector
+	// schemaPolicy and schemaCollections configure the
+	// validation of the attributes before unpacking.
+	schemaPolicy      SchemaPolicy
+	schemaCollections []string
+	// dedupe and contentRoot configure the
+	// dedupe of unpacked files.
+	dedupe      file.DedupeMode
+	contentRoot string
+	// sourceDateEpoch is the default time of the unpacked
+	// files. Write times are kept if zero.
+	sourceDateEpoch time.Time
+	// extractLimits bounds the unpacked directory blobs.
+	extractLimits file.ExtractLimits
+	// tempDir is the directory of the temporary files.
+	tempDir string
+	// licensePolicy is checked before unpacking,
+	// logging the violations with licenseOverride.
+	licensePolicy   LicensePolicy
+	licenseOverride bool
 }
 
 func (i *image) Metadata() images.Image {
@@ -96,15 +193,22 @@ func (i *image) Labels() map[string]string {
 	return i.i.Labels
 }
 
+// RootFS returns the digests of the blobs unpacked to the rootfs,
+// which are the blobs selected by the image selector. With a source
+// date epoch, the first digest is mixed with it, so the chain IDs
+// computed from the digests identify the unpacked snapshots.
 func (i *image) RootFS(ctx context.Context) ([]digest.Digest, error) {
-	cs := i.client.ContentStore()
-	manifest, err := images.Manifest(ctx, cs, i.i.Target, i.platform)
+	manifest, err := i.getManifest(ctx, i.platform)
+	if err != nil {
+		return nil, err
+	}
+	artifacts, err := i.getArtifacts(ctx, i.platform, manifest)
 	if err != nil {
 		return nil, err
 	}
 	var digests []digest.Digest
-	for _, layer := range manifest.Layers {
-		digests = append(digests, layer.Digest)
+	for _, artifact := range artifacts {
+		digests = append(digests, artifact.diffID())
 	}
 	return digests, nil
 }
@@ -126,6 +230,11 @@ func (i *image) ConfigWithAttributes(ctx context.Context) (ocispec.ImageConfig,
 	return ConfigFromAttributes(ctx, provider, i.Target(), i.platform)
 }
 
+func (i *image) Attributes(ctx context.Context, schemaID string, v interface{}) (bool, error) {
+	provider := i.client.ContentStore()
+	return AttributesFromManifest(ctx, provider, i.Target(), i.platform, schemaID, v)
+}
+
 func (i *image) IsUnpacked(ctx context.Context, snapshotterName string) (bool, error) {
 	sn, err := getSnapshotter(ctx, i.client, snapshotterName)
 	if err != nil {
@@ -187,18 +296,41 @@ func (i *image) Unpack(ctx context.Context, snapshotterName string, opts ...cont
 		return err
 	}
 
+	if err := i.validateAttributes(ctx, manifest); err != nil {
+		return err
+	}
+
 	artifacts, err := i.getArtifacts(ctx, i.platform, manifest)
 	if err != nil {
 		return err
 	}
 
+	if err := i.checkLicenses(ctx, manifest, artifacts); err != nil {
+		return err
+	}
+
 	var (
 		cs = i.client.ContentStore()
-		a  = &artifactApplier{&contentStore{cs}}
+		a  = &artifactApplier{
+			store:           &contentStore{cs},
+			sourceDateEpoch: i.sourceDateEpoch,
+			extractLimits:   i.extractLimits,
+			dedupe:          i.dedupe,
+			contentRoot:     i.contentRoot,
+			tempRoot:        i.tempDir,
+		}
 
 		chain    []digest.Digest
 		unpacked bool
 	)
+	// The file stores are closed once unpacked, on
+	// success, failure or cancellation alike.
+	defer func() {
+		if cerr := a.Close(); cerr != nil {
+			log.G(ctx).WithError(cerr).Warn("failed to close artifact applier")
+		}
+	}()
+
 	snapshotterName, err = resolveSnapshotterName(ctx, i.client, snapshotterName)
 	if err != nil {
 		return err
@@ -233,7 +365,7 @@ func (i *image) Unpack(ctx context.Context, snapshotterName string, opts ...cont
 			}
 		}
 
-		chain = append(chain, artifact.Blob.Digest)
+		chain = append(chain, artifact.diffID())
 	}
 
 	desc, err := i.i.Config(ctx, cs, i.platform)
@@ -263,14 +395,98 @@ func (i *image) getManifest(ctx context.Context, platform platforms.MatchCompare
 	return manifest, nil
 }
 
+// getArtifacts returns the manifest blobs selected by the image selector.
+// Blobs declaring a platform are skipped unless it matches the platform.
+// When platform specific blobs share a name, only the blob with the
+// preferred platform is returned.
 func (i *image) getArtifacts(ctx context.Context, platform platforms.MatchComparer, manifest ocispec.Manifest) ([]Artifact, error) {
-	artifacts := make([]Artifact, len(manifest.Layers))
-	for i := range manifest.Layers {
-		artifacts[i].Blob = manifest.Layers[i]
+	if platform == nil {
+		platform = platforms.Default()
+	}
+	var (
+		artifacts []Artifact
+		// byName maps names to the index of the selected platform
+		// specific blob, and namePlatforms the index to its platform.
+		byName        = map[string]int{}
+		namePlatforms = map[int]ocispec.Platform{}
+	)
+	for _, layer := range manifest.Layers {
+		blobPlatform, err := getBlobPlatform(layer)
+		if err != nil {
+			return nil, err
+		}
+		if blobPlatform != nil && !platform.Match(*blobPlatform) {
+			continue
+		}
+
+		if !i.selector.Empty() {
+			node, err := v2.NewNode(layer.Digest.String(), layer)
+			if err != nil {
+				return nil, err
+			}
+			selected, err := i.selector.Matches(node)
+			if err != nil {
+				return nil, fmt.Errorf("failed to select blob %s: %w", layer.Digest, err)
+			}
+			if !selected {
+				continue
+			}
+		}
+
+		name := layer.Annotations[ocispec.AnnotationTitle]
+		if blobPlatform == nil || name == "" {
+			artifacts = append(artifacts, Artifact{Blob: layer})
+			continue
+		}
+		if idx, ok := byName[name]; ok {
+			if platform.Less(*blobPlatform, namePlatforms[idx]) {
+				artifacts[idx] = Artifact{Blob: layer}
+				namePlatforms[idx] = *blobPlatform
+			}
+			continue
+		}
+		byName[name] = len(artifacts)
+		namePlatforms[len(artifacts)] = *blobPlatform
+		artifacts = append(artifacts, Artifact{Blob: layer})
+	}
+	if len(artifacts) == 0 && len(manifest.Layers) > 0 {
+		return nil, fmt.Errorf("no blobs of image %s match the platform and selector %q: %w", i.Name(), i.selector, errdefs.ErrNotFound)
+	}
+	if len(artifacts) > 0 && !i.sourceDateEpoch.IsZero() {
+		artifacts[0].Diff = epochDiffID(artifacts[0].Blob.Digest, i.sourceDateEpoch)
 	}
 	return artifacts, nil
 }
 
+// epochDiffID mixes the source date epoch into the digest of the first
+// applied blob, so the chain IDs of all the snapshots unpacked with the
+// epoch differ from the ones unpacked without it or with another epoch.
+func epochDiffID(dgst digest.Digest, epoch time.Time) digest.Digest {
+	return digest.FromString(fmt.Sprintf("%s source-date-epoch=%d", dgst, epoch.Unix()))
+}
+
+// getBlobPlatform returns the platform declared by the blob descriptor or its
+// platform attributes, or nil if the blob is not platform specific.
+func getBlobPlatform(desc ocispec.Descriptor) (*ocispec.Platform, error) {
+	if desc.Platform != nil {
+		p := platforms.Normalize(*desc.Platform)
+		return &p, nil
+	}
+	var attrs spec.Platform
+	found, err := spec.Decode(desc.Annotations, spec.SchemaPlatform, &attrs)
+	if err != nil {
+		return nil, fmt.Errorf("blob %s: %w", desc.Digest, err)
+	}
+	if !found {
+		return nil, nil
+	}
+	if attrs.OS == "" || attrs.Architecture == "" {
+		return nil, fmt.Errorf("blob %s: schema %s: os and architecture are required", desc.Digest, spec.SchemaPlatform)
+	}
+	p := platforms.Normalize(attrs.OCI())
+	return &p, nil
+}
+
 func (i *image) getManifestPlatform(ctx context.Context, manifest ocispec.Manifest) (ocispec.Platform, error) {
 	cs := i.ContentStore()
 	p, err := content.ReadBlob(ctx, cs, manifest.Config)
@@ -282,9 +498,43 @@ func (i *image) getManifestPlatform(ctx context.Context, manifest ocispec.Manife
 	if err := json.Unmarshal(p, &image); err != nil {
 		return ocispec.Platform{}, err
 	}
+	if image.OS == "" || image.Architecture == "" {
+		// Collection configurations are not required to carry
+		// platform information.
+		return i.getTargetPlatform(ctx)
+	}
 	return platforms.Normalize(ocispec.Platform{OS: image.OS, Architecture: image.Architecture}), nil
 }
 
+// getTargetPlatform returns the platform of the manifest descriptor selected
+// by the image platform. If the descriptor does not declare a platform, the
+// default platform is returned.
+func (i *image) getTargetPlatform(ctx context.Context) (ocispec.Platform, error) {
+	target := i.Target()
+	if images.IsIndexType(target.MediaType) {
+		p, err := content.ReadBlob(ctx, i.ContentStore(), target)
+		if err != nil {
+			return ocispec.Platform{}, err
+		}
+		var index ocispec.Index
+		if err := json.Unmarshal(p, &index); err != nil {
+			return ocispec.Platform{}, err
+		}
+		for _, desc := range index.Manifests {
+			if desc.Platform != nil && (i.platform == nil || i.platform.Match(*desc.Platform)) {
+				return platforms.Normalize(*desc.Platform), nil
+			}
+		}
+	} else if target.Platform != nil {
+		return platforms.Normalize(*target.Platform), nil
+	}
+	return platforms.DefaultSpec(), nil
+}
+
+// checkSnapshotterSupport verifies the snapshotter supports the manifest platform.
+// Snapshot content does not depend on the CPU architecture, so a platform on the
+// same operating system as a supported platform is accepted. This allows running
+// collections for other architectures under emulation (e.g. binfmt/qemu).
 func (i *image) checkSnapshotterSupport(ctx context.Context, snapshotterName string, manifest ocispec.Manifest) error {
 	snapshotterPlatformMatcher, err := i.client.GetSnapshotterSupportedPlatforms(ctx, snapshotterName)
 	if err != nil {
@@ -296,10 +546,21 @@ func (i *image) checkSnapshotterSupport(ctx context.Context, snapshotterName str
 		return err
 	}
 
-	if snapshotterPlatformMatcher.Match(manifestPlatform) {
+	if platformSupported(snapshotterPlatformMatcher, manifestPlatform) {
 		return nil
 	}
-	return fmt.Errorf("snapshotter %s does not support platform %s for image %s", snapshotterName, manifestPlatform, manifest.Config.Digest)
+	return fmt.Errorf("snapshotter %s does not support platform %s for image %s", snapshotterName, platforms.Format(manifestPlatform), manifest.Config.Digest)
+}
+
+// platformSupported returns true if the platform is supported, or if the
+// host architecture on the operating system of the platform is supported.
+func platformSupported(supported platforms.Matcher, platform ocispec.Platform) bool {
+	if supported.Match(platform) {
+		return true
+	}
+	hostPlatform := platforms.DefaultSpec()
+	hostPlatform.OS = platform.OS
+	return supported.Match(hostPlatform)
 }
 
 func (i *image) ContentStore() content.Store {
@@ -360,6 +621,16 @@ func ConfigFromAttributes(ctx context.Context, provider content.Provider, image
 	return *props.Runtime, err
 }
 
+// AttributesFromManifest decodes the manifest attribute set stored under the schema ID
+// into v. It returns false if the manifest does not set attributes for the schema.
+func AttributesFromManifest(ctx context.Context, provider content.Provider, image ocispec.Descriptor, platform platforms.MatchComparer, schemaID string, v interface{}) (bool, error) {
+	manifest, err := images.Manifest(ctx, provider, image, platform)
+	if err != nil {
+		return false, err
+	}
+	return spec.Decode(manifest.Annotations, schemaID, v)
+}
+
 func getSnapshotter(ctx context.Context, c *containerd.Client, name string) (snapshots.Snapshotter, error) {
 	name, err := resolveSnapshotterName(ctx, c, name)
 	if err != nil {
@@ -0,0 +1,154 @@
+package aritfact
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/containerd/containerd/platforms"
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/identity"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/uor-framework/uor-client-go/nodes/descriptor"
+
+	"github.com/jpower432/runc-attribute-wrapper/aritfact/spec"
+)
+
+// chainID returns the chain ID of the snapshot
+// the artifacts are unpacked to.
+func chainID(artifacts []Artifact) digest.Digest {
+	var chain []digest.Digest
+	for _, artifact := range artifacts {
+		chain = append(chain, artifact.diffID())
+	}
+	return identity.ChainID(chain)
+}
+
+func TestGetArtifactsSourceDateEpoch(t *testing.T) {
+	manifest := ocispec.Manifest{
+		Layers: []ocispec.Descriptor{
+			{MediaType: ocispec.MediaTypeImageLayer, Digest: digest.FromString("a"), Size: 1},
+			{MediaType: ocispec.MediaTypeImageLayer, Digest: digest.FromString("b"), Size: 1},
+		},
+	}
+	artifacts := func(opts ...ImageOpt) []Artifact {
+		t.Helper()
+		i := &image{}
+		for _, o := range opts {
+			o(i)
+		}
+		artifacts, err := i.getArtifacts(context.Background(), nil, manifest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return artifacts
+	}
+
+	plain := artifacts()
+	for i, artifact := range plain {
+		if artifact.diffID() != manifest.Layers[i].Digest {
+			t.Errorf("diff ID of blob %d = %s, want the blob digest", i, artifact.diffID())
+		}
+	}
+
+	epoch := time.Unix(1700000000, 0)
+	withEpoch := artifacts(WithSourceDateEpoch(epoch))
+	if withEpoch[0].Blob.Digest != manifest.Layers[0].Digest {
+		t.Errorf("blob digest changed to %s", withEpoch[0].Blob.Digest)
+	}
+	if withEpoch[0].diffID() == manifest.Layers[0].Digest {
+		t.Error("diff ID of the first blob does not depend on the epoch")
+	}
+
+	// Every snapshot of the chain depends on the epoch.
+	for n := 1; n <= len(manifest.Layers); n++ {
+		if chainID(plain[:n]) == chainID(withEpoch[:n]) {
+			t.Errorf("snapshot %d is shared with the unpack without epoch", n)
+		}
+	}
+	if got := chainID(artifacts(WithSourceDateEpoch(epoch))); got != chainID(withEpoch) {
+		t.Errorf("chain ID with the same epoch = %s, want %s", got, chainID(withEpoch))
+	}
+	if got := chainID(artifacts(WithSourceDateEpoch(epoch.Add(time.Second)))); got == chainID(withEpoch) {
+		t.Error("snapshots are shared with another epoch")
+	}
+}
+
+func TestGetBlobPlatform(t *testing.T) {
+	annotations := func(platform string) map[string]string {
+		a, err := descriptor.AnnotationsFromAttributes(map[string]json.RawMessage{spec.SchemaPlatform: json.RawMessage(platform)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return a
+	}
+	tests := []struct {
+		name    string
+		desc    ocispec.Descriptor
+		want    *ocispec.Platform
+		wantErr bool
+	}{
+		{name: "not platform specific", desc: ocispec.Descriptor{}},
+		{
+			name: "attributes",
+			desc: ocispec.Descriptor{Annotations: annotations(`{"os":"windows","architecture":"amd64","os.version":"10.0.17763","os.features":"win32k, gpu"}`)},
+			want: &ocispec.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.17763", OSFeatures: []string{"win32k", "gpu"}},
+		},
+		{
+			name: "normalized",
+			desc: ocispec.Descriptor{Annotations: annotations(`{"os":"Linux","architecture":"aarch64"}`)},
+			want: &ocispec.Platform{OS: "linux", Architecture: "arm64"},
+		},
+		{
+			name: "descriptor platform first",
+			desc: ocispec.Descriptor{
+				Platform:    &ocispec.Platform{OS: "linux", Architecture: "arm", Variant: "v7"},
+				Annotations: annotations(`{"os":"linux","architecture":"amd64"}`),
+			},
+			want: &ocispec.Platform{OS: "linux", Architecture: "arm", Variant: "v7"},
+		},
+		{name: "missing architecture", desc: ocispec.Descriptor{Annotations: annotations(`{"os":"linux"}`)}, wantErr: true},
+		// The OS features are a list in a string, since attribute values are scalars.
+		{name: "features array", desc: ocispec.Descriptor{Annotations: annotations(`{"os":"linux","architecture":"amd64","os.features":["a"]}`)}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := getBlobPlatform(tt.desc)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getBlobPlatform() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getBlobPlatform() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlatformSupported(t *testing.T) {
+	host := platforms.DefaultSpec()
+	other := "windows"
+	if host.OS == other {
+		other = "linux"
+	}
+	supported := platforms.NewMatcher(host)
+	tests := []struct {
+		name     string
+		platform ocispec.Platform
+		want     bool
+	}{
+		{name: "host", platform: host, want: true},
+		// Other architectures of the host operating system
+		// are supported under emulation.
+		{name: "emulated", platform: ocispec.Platform{OS: host.OS, Architecture: "s390x"}, want: true},
+		{name: "other operating system", platform: ocispec.Platform{OS: other, Architecture: host.Architecture}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := platformSupported(supported, tt.platform); got != tt.want {
+				t.Errorf("platformSupported(%s) = %v, want %v", platforms.Format(tt.platform), got, tt.want)
+			}
+		})
+	}
+}
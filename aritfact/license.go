@@ -0,0 +1,363 @@
+package aritfact
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/log"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	uorspec "github.com/uor-framework/collection-spec/specs-go/v1alpha1"
+	"github.com/uor-framework/uor-client-go/nodes/descriptor"
+	"sigs.k8s.io/yaml"
+
+	"github.com/jpower432/runc-attribute-wrapper/aritfact/spec"
+)
+
+// LicensePolicy restricts the licenses of the components
+// declared by the core-descriptor attributes of a collection.
+// The licenses of a component are SPDX license expressions which
+// must all be satisfied. An expression with OR alternatives is
+// satisfied if one alternative is. License identifiers are compared
+// ignoring case, and license exceptions are not checked.
+type LicensePolicy struct {
+	// Allow lists the allowed licenses. If set, every
+	// license of a component must be allowed, and
+	// components without licenses are rejected.
+	Allow []string `json:"allow,omitempty"`
+	// Deny lists the denied licenses. Denied
+	// licenses are never allowed.
+	Deny []string `json:"deny,omitempty"`
+	// AllowUnlicensed allows the components
+	// without licenses when Allow is set.
+	AllowUnlicensed bool `json:"allowUnlicensed,omitempty"`
+}
+
+// LicenseConfig is a license policy configuration
+// file, with policies set per containerd namespace.
+type LicenseConfig struct {
+	// Default is the policy of namespaces without a policy.
+	Default LicensePolicy `json:"default"`
+	// Namespaces are the policies by namespace.
+	Namespaces map[string]LicensePolicy `json:"namespaces,omitempty"`
+}
+
+// LoadLicenseConfig loads a license policy configuration
+// file, formatted as JSON or YAML.
+func LoadLicenseConfig(path string) (LicenseConfig, error) {
+	var config LicenseConfig
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("failed to read license policy: %w", err)
+	}
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return config, fmt.Errorf("invalid license policy %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// Policy returns the license policy of the namespace.
+func (c LicenseConfig) Policy(namespace string) LicensePolicy {
+	if policy, ok := c.Namespaces[namespace]; ok {
+		return policy
+	}
+	return c.Default
+}
+
+// Empty returns true if the policy allows every license.
+func (p LicensePolicy) Empty() bool {
+	return len(p.Allow) == 0 && len(p.Deny) == 0
+}
+
+// LicenseViolation is a component license rejected by a license policy.
+type LicenseViolation struct {
+	// Descriptor declares the component.
+	Descriptor ocispec.Descriptor
+	Component  string
+	License    string
+	// Reason is why the license is rejected.
+	Reason string
+}
+
+func (v LicenseViolation) String() string {
+	name := "manifest"
+	if v.Descriptor.Digest != "" {
+		name = fmt.Sprintf("blob %s", v.Descriptor.Digest)
+	}
+	if title, ok := v.Descriptor.Annotations[ocispec.AnnotationTitle]; ok {
+		name = fmt.Sprintf("%s (%s)", name, title)
+	}
+	if v.License == "" {
+		return fmt.Sprintf("%s: component %s is %s", name, v.Component, v.Reason)
+	}
+	return fmt.Sprintf("%s: component %s license %s is %s", name, v.Component, v.License, v.Reason)
+}
+
+// Check returns the violations of the licenses of the
+// component declared by the descriptor annotations.
+func (p LicensePolicy) Check(desc ocispec.Descriptor) ([]LicenseViolation, error) {
+	var attrs uorspec.DescriptorAttributes
+	ok, err := spec.Decode(desc.Annotations, descriptor.TypeDescriptor, &attrs)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	var violations []LicenseViolation
+	violation := func(license, reason string) {
+		violations = append(violations, LicenseViolation{
+			Descriptor: desc,
+			Component:  attrs.Name,
+			License:    license,
+			Reason:     reason,
+		})
+	}
+	if len(attrs.Licenses) == 0 && attrs.Name != "" && len(p.Allow) > 0 && !p.AllowUnlicensed {
+		violation("", "unlicensed")
+	}
+	for _, expression := range attrs.Licenses {
+		node, err := parseLicenseExpression(expression)
+		if err != nil {
+			violation(expression, "not a valid SPDX license expression")
+			continue
+		}
+		for _, r := range p.rejected(node) {
+			violation(r.license, r.reason)
+		}
+	}
+	return violations, nil
+}
+
+// licenseRejection is a license of an expression rejected by a policy.
+type licenseRejection struct {
+	license string
+	reason  string
+}
+
+// rejected returns the licenses rejected by the policy which prevent the
+// expression from being satisfied. An OR is satisfied by any alternative,
+// so the licenses of its alternatives are only returned if none is.
+func (p LicensePolicy) rejected(node licenseNode) []licenseRejection {
+	switch node.op {
+	case "AND":
+		var rejections []licenseRejection
+		for _, operand := range node.operands {
+			rejections = append(rejections, p.rejected(operand)...)
+		}
+		return rejections
+	case "OR":
+		var rejections []licenseRejection
+		for _, operand := range node.operands {
+			r := p.rejected(operand)
+			if len(r) == 0 {
+				return nil
+			}
+			rejections = append(rejections, r...)
+		}
+		return rejections
+	}
+	switch {
+	case containsFold(p.Deny, node.license):
+		return []licenseRejection{{license: node.license, reason: "denied"}}
+	case len(p.Allow) > 0 && !containsFold(p.Allow, node.license):
+		return []licenseRejection{{license: node.license, reason: "not allowed"}}
+	}
+	return nil
+}
+
+// licenseNode is a node of a parsed SPDX license expression: a license
+// identifier, or the AND or OR of its operands.
+type licenseNode struct {
+	op       string
+	license  string
+	operands []licenseNode
+}
+
+// parseLicenseExpression parses an SPDX license expression. WITH binds
+// tighter than AND, which binds tighter than OR. The license exceptions
+// are dropped.
+func parseLicenseExpression(expression string) (licenseNode, error) {
+	p := &licenseParser{tokens: licenseTokens(expression)}
+	node, err := p.parseOr()
+	if err != nil {
+		return licenseNode{}, err
+	}
+	if p.pos != len(p.tokens) {
+		return licenseNode{}, fmt.Errorf("unexpected %q in license expression %q", p.tokens[p.pos], expression)
+	}
+	return node, nil
+}
+
+// licenseTokens splits a license expression into license
+// identifiers, operators and parentheses.
+func licenseTokens(expression string) []string {
+	return strings.Fields(strings.NewReplacer("(", " ( ", ")", " ) ").Replace(expression))
+}
+
+// licenseParser is a recursive descent parser of SPDX license expressions.
+type licenseParser struct {
+	tokens []string
+	pos    int
+}
+
+// peek returns the next token, or an empty
+// string at the end of the expression.
+func (p *licenseParser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *licenseParser) parseOr() (licenseNode, error) {
+	return p.parseBinary("OR", p.parseAnd)
+}
+
+func (p *licenseParser) parseAnd() (licenseNode, error) {
+	return p.parseBinary("AND", p.parseWith)
+}
+
+// parseBinary parses the operands joined by the operator.
+func (p *licenseParser) parseBinary(op string, operand func() (licenseNode, error)) (licenseNode, error) {
+	first, err := operand()
+	if err != nil {
+		return licenseNode{}, err
+	}
+	operands := []licenseNode{first}
+	for strings.EqualFold(p.peek(), op) {
+		p.pos++
+		next, err := operand()
+		if err != nil {
+			return licenseNode{}, err
+		}
+		operands = append(operands, next)
+	}
+	if len(operands) == 1 {
+		return first, nil
+	}
+	return licenseNode{op: op, operands: operands}, nil
+}
+
+func (p *licenseParser) parseWith() (licenseNode, error) {
+	node, err := p.parsePrimary()
+	if err != nil {
+		return licenseNode{}, err
+	}
+	if strings.EqualFold(p.peek(), "WITH") {
+		p.pos++
+		if !isLicenseID(p.peek()) {
+			return licenseNode{}, fmt.Errorf("expected a license exception after WITH")
+		}
+		p.pos++
+	}
+	return node, nil
+}
+
+func (p *licenseParser) parsePrimary() (licenseNode, error) {
+	token := p.peek()
+	switch {
+	case token == "(":
+		p.pos++
+		node, err := p.parseOr()
+		if err != nil {
+			return licenseNode{}, err
+		}
+		if p.peek() != ")" {
+			return licenseNode{}, fmt.Errorf("missing closing parenthesis")
+		}
+		p.pos++
+		return node, nil
+	case isLicenseID(token):
+		p.pos++
+		return licenseNode{license: token}, nil
+	case token == "":
+		return licenseNode{}, fmt.Errorf("expected a license")
+	default:
+		return licenseNode{}, fmt.Errorf("unexpected %q", token)
+	}
+}
+
+// isLicenseID returns true if the token is a license
+// identifier rather than an operator or a parenthesis.
+func isLicenseID(token string) bool {
+	switch strings.ToUpper(token) {
+	case "", "(", ")", "AND", "OR", "WITH":
+		return false
+	}
+	return true
+}
+
+// containsFold returns true if the list contains the value, ignoring case.
+func containsFold(list []string, value string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// WithLicensePolicy checks the licenses of the components of the
+// manifest and the unpacked blobs before any blob is applied. With
+// override, the violations are logged and the image is unpacked.
+func WithLicensePolicy(policy LicensePolicy, override bool) ImageOpt {
+	return func(i *image) {
+		i.licensePolicy = policy
+		i.licenseOverride = override
+	}
+}
+
+// CheckLicenses checks the licenses of the manifest and the selected
+// blobs against the license policy of the image. Unpack checks the
+// licenses itself, so images which are already unpacked are checked
+// before running them.
+func (i *image) CheckLicenses(ctx context.Context) error {
+	if i.licensePolicy.Empty() {
+		return nil
+	}
+	manifest, err := i.getManifest(ctx, i.platform)
+	if err != nil {
+		return err
+	}
+	artifacts, err := i.getArtifacts(ctx, i.platform, manifest)
+	if err != nil {
+		return err
+	}
+	return i.checkLicenses(ctx, manifest, artifacts)
+}
+
+// checkLicenses checks the licenses of the manifest and
+// the artifacts against the license policy of the image.
+func (i *image) checkLicenses(ctx context.Context, manifest ocispec.Manifest, artifacts []Artifact) error {
+	if i.licensePolicy.Empty() {
+		return nil
+	}
+
+	// The manifest violations are reported without a digest.
+	descs := []ocispec.Descriptor{{Annotations: manifest.Annotations}}
+	for _, artifact := range artifacts {
+		descs = append(descs, artifact.Blob)
+	}
+	var report []string
+	for _, desc := range descs {
+		violations, err := i.licensePolicy.Check(desc)
+		if err != nil {
+			return fmt.Errorf("failed to check licenses: %w", err)
+		}
+		for _, v := range violations {
+			report = append(report, v.String())
+		}
+	}
+	if len(report) == 0 {
+		return nil
+	}
+
+	if i.licenseOverride {
+		for _, r := range report {
+			log.G(ctx).Warnf("image %s: license policy overridden: %s", i.Name(), r)
+		}
+		return nil
+	}
+	return fmt.Errorf("image %s violates the license policy: %s: %w", i.Name(), strings.Join(report, "; "), errdefs.ErrFailedPrecondition)
+}
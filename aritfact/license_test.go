@@ -0,0 +1,219 @@
+package aritfact
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/platforms"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestParseLicenseExpression(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       licenseNode
+		wantErr    bool
+	}{
+		{expression: "MIT", want: licenseNode{license: "MIT"}},
+		{
+			expression: "MIT or Apache-2.0 AND BSD-3-Clause",
+			want: licenseNode{op: "OR", operands: []licenseNode{
+				{license: "MIT"},
+				{op: "AND", operands: []licenseNode{{license: "Apache-2.0"}, {license: "BSD-3-Clause"}}},
+			}},
+		},
+		{
+			expression: "(MIT OR Apache-2.0) AND GPL-2.0-only WITH Classpath-exception-2.0",
+			want: licenseNode{op: "AND", operands: []licenseNode{
+				{op: "OR", operands: []licenseNode{{license: "MIT"}, {license: "Apache-2.0"}}},
+				{license: "GPL-2.0-only"},
+			}},
+		},
+		{expression: "", wantErr: true},
+		{expression: "MIT OR", wantErr: true},
+		{expression: "(MIT", wantErr: true},
+		{expression: "MIT)", wantErr: true},
+		{expression: "MIT Apache-2.0", wantErr: true},
+		{expression: "MIT WITH", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseLicenseExpression(tt.expression)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseLicenseExpression(%q) error = %v, wantErr %v", tt.expression, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseLicenseExpression(%q) = %+v, want %+v", tt.expression, got, tt.want)
+		}
+	}
+}
+
+func TestLicensePolicyCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   LicensePolicy
+		licenses []string
+		want     []string
+	}{
+		{
+			name:     "allowed",
+			policy:   LicensePolicy{Allow: []string{"mit"}},
+			licenses: []string{"MIT"},
+		},
+		{
+			name:     "not allowed",
+			policy:   LicensePolicy{Allow: []string{"MIT"}},
+			licenses: []string{"MIT", "GPL-3.0-only"},
+			want:     []string{"GPL-3.0-only not allowed"},
+		},
+		{
+			name:     "allowed alternative",
+			policy:   LicensePolicy{Allow: []string{"MIT"}},
+			licenses: []string{"GPL-3.0-only OR MIT"},
+		},
+		{
+			name:     "denied alternative",
+			policy:   LicensePolicy{Deny: []string{"GPL-3.0-only"}},
+			licenses: []string{"GPL-3.0-only OR MIT"},
+		},
+		{
+			name:     "every alternative denied",
+			policy:   LicensePolicy{Deny: []string{"GPL-3.0-only", "AGPL-3.0-only"}},
+			licenses: []string{"GPL-3.0-only OR AGPL-3.0-only"},
+			want:     []string{"GPL-3.0-only denied", "AGPL-3.0-only denied"},
+		},
+		{
+			name:     "denied conjunction",
+			policy:   LicensePolicy{Deny: []string{"GPL-3.0-only"}},
+			licenses: []string{"(MIT OR Apache-2.0) AND GPL-3.0-only"},
+			want:     []string{"GPL-3.0-only denied"},
+		},
+		{
+			name:     "exception",
+			policy:   LicensePolicy{Allow: []string{"GPL-2.0-only"}},
+			licenses: []string{"GPL-2.0-only WITH Classpath-exception-2.0"},
+		},
+		{
+			name:     "invalid expression",
+			policy:   LicensePolicy{Deny: []string{"GPL-3.0-only"}},
+			licenses: []string{"MIT OR"},
+			want:     []string{"MIT OR not a valid SPDX license expression"},
+		},
+		{
+			name:   "unlicensed with allow list",
+			policy: LicensePolicy{Allow: []string{"MIT"}},
+			want:   []string{" unlicensed"},
+		},
+		{
+			name:   "unlicensed allowed",
+			policy: LicensePolicy{Allow: []string{"MIT"}, AllowUnlicensed: true},
+		},
+		{
+			name:   "unlicensed with deny list",
+			policy: LicensePolicy{Deny: []string{"GPL-3.0-only"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			desc := componentBlob(t, "bin/tool", "tool", "tool", tt.licenses...)
+			violations, err := tt.policy.Check(desc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, v := range violations {
+				if v.Component != "tool" || v.Descriptor.Digest != desc.Digest {
+					t.Errorf("violation of component %s in %s", v.Component, v.Descriptor.Digest)
+				}
+				got = append(got, v.License+" "+v.Reason)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("violations = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckLicenses(t *testing.T) {
+	store := memoryStore{}
+	manifestComponent := componentBlob(t, "", "", "collection", "Apache-2.0").Annotations
+	delete(manifestComponent, ocispec.AnnotationTitle)
+	// The blob of another platform is not unpacked, so its license is not checked.
+	otherPlatform := componentBlob(t, "bin/other", "other", "other", "AGPL-3.0-only")
+	otherPlatform.Platform = &ocispec.Platform{OS: "plan9", Architecture: "mips"}
+	config := store.add(t, "application/vnd.uor.config.v1+json", map[string]string{})
+	target := store.add(t, ocispec.MediaTypeImageManifest, ocispec.Manifest{
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config:    config,
+		Layers: []ocispec.Descriptor{
+			componentBlob(t, "bin/tool", "tool", "tool", "MIT OR GPL-3.0-only"),
+			componentBlob(t, "lib/unlicensed", "lib", "unlicensed"),
+			otherPlatform,
+		},
+		Annotations: manifestComponent,
+	})
+	manifest, err := images.Manifest(context.Background(), store, target, platforms.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		policy   LicensePolicy
+		override bool
+		want     []string
+	}{
+		{name: "no policy"},
+		{
+			name:   "allowed",
+			policy: LicensePolicy{Allow: []string{"MIT", "Apache-2.0"}, AllowUnlicensed: true},
+		},
+		{
+			name:   "denied",
+			policy: LicensePolicy{Allow: []string{"GPL-3.0-only"}, Deny: []string{"Apache-2.0"}},
+			want: []string{
+				"manifest: component collection license Apache-2.0 is denied",
+				"component unlicensed is unlicensed",
+			},
+		},
+		{
+			name:     "overridden",
+			policy:   LicensePolicy{Deny: []string{"Apache-2.0"}},
+			override: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := &image{i: images.Image{Name: "test", Target: target}}
+			WithLicensePolicy(tt.policy, tt.override)(i)
+			artifacts, err := i.getArtifacts(context.Background(), platforms.Default(), manifest)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = i.checkLicenses(context.Background(), manifest, artifacts)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("checkLicenses() error = %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, errdefs.ErrFailedPrecondition) {
+				t.Fatalf("checkLicenses() error = %v, want a failed precondition", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not report %q", err, want)
+				}
+			}
+			if strings.Contains(err.Error(), "component other") {
+				t.Errorf("error %q reports a blob which is not unpacked", err)
+			}
+		})
+	}
+}
@@ -24,6 +24,8 @@ var (
 // Image interface used by some SpecOpt to query image configuration
 type Image interface {
 	ConfigWithAttributes(ctx context.Context) (ocispec.ImageConfig, error)
+	// Attributes decodes the manifest attribute set for a schema ID.
+	Attributes(ctx context.Context, schemaID string, v interface{}) (bool, error)
 	// Config descriptor for the image.
 	Config(ctx context.Context) (ocispec.Descriptor, error)
 	// ContentStore provides a content store which contains image blob data
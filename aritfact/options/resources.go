@@ -0,0 +1,139 @@
+package options
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/containerd/containerd/containers"
+	"github.com/containerd/containerd/oci"
+	"github.com/docker/go-units"
+	"github.com/opencontainers/runtime-spec/specs-go"
+
+	"github.com/jpower432/runc-attribute-wrapper/aritfact/spec"
+)
+
+// defaultCPUPeriod is the CFS period used when
+// converting a CPU count to a quota.
+const defaultCPUPeriod = 100000
+
+// WithResources configures resource limits and security options from the
+// collection defaults of an Image. Any value set in overrides takes precedence
+// over the collection defaults, except capability lists which are merged
+// as described by spec.Resources.Merge.
+func WithResources(image Image, overrides spec.Resources) oci.SpecOpts {
+	return func(ctx context.Context, client oci.Client, c *containers.Container, s *oci.Spec) error {
+		var defaults spec.Resources
+		if _, err := image.Attributes(ctx, spec.SchemaResources, &defaults); err != nil {
+			return err
+		}
+		opts, err := ResourceOpts(defaults.Merge(overrides))
+		if err != nil {
+			return err
+		}
+		return oci.ApplyOpts(ctx, client, c, s, opts...)
+	}
+}
+
+// ResourceOpts converts resources to the spec options that apply them.
+func ResourceOpts(r spec.Resources) ([]oci.SpecOpts, error) {
+	var opts []oci.SpecOpts
+
+	if r.Memory != "" {
+		limit, err := units.RAMInBytes(r.Memory)
+		if err != nil {
+			return nil, fmt.Errorf("invalid memory limit %q: %w", r.Memory, err)
+		}
+		opts = append(opts, oci.WithMemoryLimit(uint64(limit)))
+	}
+
+	if r.CPUs < 0 {
+		return nil, fmt.Errorf("invalid cpus %v: must be positive", r.CPUs)
+	}
+	if r.CPUs > 0 {
+		opts = append(opts, withCPUCFS(int64(r.CPUs*defaultCPUPeriod), defaultCPUPeriod))
+	}
+
+	if r.PidsLimit > 0 {
+		opts = append(opts, withPidsLimit(r.PidsLimit))
+	}
+
+	if caps := spec.SplitList(r.CapAdd); len(caps) > 0 {
+		if err := validateCapabilities(caps); err != nil {
+			return nil, err
+		}
+		opts = append(opts, oci.WithAddedCapabilities(caps))
+	}
+
+	if caps := spec.SplitList(r.CapDrop); len(caps) > 0 {
+		if err := validateCapabilities(caps); err != nil {
+			return nil, err
+		}
+		opts = append(opts, oci.WithDroppedCapabilities(caps))
+	}
+
+	if r.NoNewPrivileges != nil {
+		if *r.NoNewPrivileges {
+			opts = append(opts, oci.WithNoNewPrivileges)
+		} else {
+			opts = append(opts, oci.WithNewPrivileges)
+		}
+	}
+
+	if r.ReadOnly != nil && *r.ReadOnly {
+		opts = append(opts, oci.WithRootFSReadonly())
+	}
+
+	return opts, nil
+}
+
+// validateCapabilities ensures all capabilities are specified
+// with the "CAP_" prefix.
+func validateCapabilities(caps []string) error {
+	for _, c := range caps {
+		if !strings.HasPrefix(c, "CAP_") {
+			return fmt.Errorf("capability %q must be specified with 'CAP_' prefix", c)
+		}
+	}
+	return nil
+}
+
+// withCPUCFS sets the container's Completely fair scheduling (CFS) quota and period.
+func withCPUCFS(quota int64, period uint64) oci.SpecOpts {
+	return func(_ context.Context, _ oci.Client, _ *containers.Container, s *oci.Spec) error {
+		setCPU(s)
+		s.Linux.Resources.CPU.Quota = &quota
+		s.Linux.Resources.CPU.Period = &period
+		return nil
+	}
+}
+
+// withPidsLimit sets the container's pid limit or maximum.
+func withPidsLimit(limit int64) oci.SpecOpts {
+	return func(_ context.Context, _ oci.Client, _ *containers.Container, s *oci.Spec) error {
+		setResources(s)
+		if s.Linux.Resources.Pids == nil {
+			s.Linux.Resources.Pids = &specs.LinuxPids{}
+		}
+		s.Linux.Resources.Pids.Limit = limit
+		return nil
+	}
+}
+
+// setResources sets Linux.Resources to empty if unset
+func setResources(s *oci.Spec) {
+	if s.Linux == nil {
+		s.Linux = &specs.Linux{}
+	}
+	if s.Linux.Resources == nil {
+		s.Linux.Resources = &specs.LinuxResources{}
+	}
+}
+
+// setCPU sets Linux.Resources.CPU to empty if unset
+func setCPU(s *oci.Spec) {
+	setResources(s)
+	if s.Linux.Resources.CPU == nil {
+		s.Linux.Resources.CPU = &specs.LinuxCPU{}
+	}
+}
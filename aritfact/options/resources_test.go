@@ -0,0 +1,87 @@
+package options
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/containerd/containerd/containers"
+	"github.com/containerd/containerd/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+
+	"github.com/jpower432/runc-attribute-wrapper/aritfact/spec"
+)
+
+func TestResourceOpts(t *testing.T) {
+	yes := true
+	resources := spec.Resources{
+		Memory:          "512m",
+		CPUs:            1.5,
+		PidsLimit:       100,
+		CapAdd:          "CAP_NET_ADMIN",
+		CapDrop:         "CAP_CHOWN",
+		NoNewPrivileges: &yes,
+		ReadOnly:        &yes,
+	}
+	opts, err := ResourceOpts(resources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &oci.Spec{
+		Process: &specs.Process{Capabilities: &specs.LinuxCapabilities{
+			Bounding:  []string{"CAP_CHOWN", "CAP_KILL"},
+			Effective: []string{"CAP_CHOWN", "CAP_KILL"},
+			Permitted: []string{"CAP_CHOWN", "CAP_KILL"},
+		}},
+		Linux: &specs.Linux{},
+	}
+	if err := oci.ApplyOpts(context.Background(), nil, &containers.Container{}, s, opts...); err != nil {
+		t.Fatal(err)
+	}
+
+	r := s.Linux.Resources
+	if got := *r.Memory.Limit; got != 512*1024*1024 {
+		t.Errorf("memory limit = %d, want %d", got, 512*1024*1024)
+	}
+	if got := *r.CPU.Quota; got != 150000 {
+		t.Errorf("cpu quota = %d, want 150000", got)
+	}
+	if got := *r.CPU.Period; got != defaultCPUPeriod {
+		t.Errorf("cpu period = %d, want %d", got, defaultCPUPeriod)
+	}
+	if got := r.Pids.Limit; got != 100 {
+		t.Errorf("pids limit = %d, want 100", got)
+	}
+	want := []string{"CAP_KILL", "CAP_NET_ADMIN"}
+	if got := s.Process.Capabilities.Bounding; !reflect.DeepEqual(got, want) {
+		t.Errorf("bounding capabilities = %v, want %v", got, want)
+	}
+	if got := s.Process.Capabilities.Effective; !reflect.DeepEqual(got, want) {
+		t.Errorf("effective capabilities = %v, want %v", got, want)
+	}
+	if !s.Process.NoNewPrivileges {
+		t.Error("no_new_privs not set")
+	}
+	if s.Root == nil || !s.Root.Readonly {
+		t.Error("rootfs not read-only")
+	}
+}
+
+func TestResourceOptsInvalid(t *testing.T) {
+	tests := []struct {
+		name      string
+		resources spec.Resources
+	}{
+		{name: "memory", resources: spec.Resources{Memory: "lots"}},
+		{name: "cpus", resources: spec.Resources{CPUs: -1}},
+		{name: "added capability", resources: spec.Resources{CapAdd: "NET_ADMIN"}},
+		{name: "dropped capability", resources: spec.Resources{CapDrop: "CAP_CHOWN,chown"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ResourceOpts(tt.resources); err == nil {
+				t.Error("ResourceOpts() succeeded, want an error")
+			}
+		})
+	}
+}
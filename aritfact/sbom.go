@@ -0,0 +1,602 @@
+package aritfact
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/containerd/containerd/images"
+	"github.com/google/uuid"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	uorspec "github.com/uor-framework/collection-spec/specs-go/v1alpha1"
+	v2 "github.com/uor-framework/uor-client-go/nodes/descriptor/v2"
+)
+
+// SBOMFormat is the document format of a software bill of materials.
+type SBOMFormat string
+
+const (
+	// SBOMFormatSPDX is the SPDX 2.3 JSON format.
+	SBOMFormatSPDX SBOMFormat = "spdx"
+	// SBOMFormatCycloneDX is the CycloneDX 1.4 JSON format.
+	SBOMFormatCycloneDX SBOMFormat = "cyclonedx"
+)
+
+// ParseSBOMFormat parses an SBOM format.
+func ParseSBOMFormat(format string) (SBOMFormat, error) {
+	switch f := SBOMFormat(format); f {
+	case SBOMFormatSPDX, SBOMFormatCycloneDX:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unsupported sbom format %q: must be one of %s, %s", format, SBOMFormatSPDX, SBOMFormatCycloneDX)
+	}
+}
+
+// Component is a component declared by the core-descriptor
+// attributes of a node of the collection graph.
+type Component struct {
+	uorspec.Component
+	// Descriptor is the descriptor declaring the component.
+	Descriptor ocispec.Descriptor
+	// Paths are the paths the blob is unpacked at in the snapshot, sorted.
+	// A blob is unpacked at several paths when the manifest lists it under
+	// several titles. It is empty for manifests, the blobs of linked
+	// collections and the blobs which are not unpacked.
+	Paths []string
+	// Linked is true if the component is declared by a linked collection.
+	Linked bool
+}
+
+// Components aggregates the components declared across the
+// collection graph and its linked collections, sorted by name,
+// version and digest. The paths of the components are set from the
+// titles of the unpacked blobs, such as the blobs selected for the
+// platform and the selector of an image. The graph has a node per
+// digest, so the titles are not read from the graph.
+func Components(ctx context.Context, graph *Graph, unpacked []ocispec.Descriptor) ([]Component, error) {
+	paths := map[digest.Digest][]string{}
+	for _, desc := range unpacked {
+		if title, ok := desc.Annotations[ocispec.AnnotationTitle]; ok {
+			paths[desc.Digest] = append(paths[desc.Digest], "/"+cleanTitle(title))
+		}
+	}
+
+	// linked tracks the nodes reached through a link.
+	linked := map[string]bool{}
+	var components []Component
+	err := graph.Walk(ctx, func(node, parent *v2.Node) error {
+		if parent != nil {
+			linked[node.ID()] = linked[parent.ID()] || (parent.Properties != nil && parent.Properties.IsALink())
+		}
+		if node.Properties == nil || !node.Properties.IsAComponent() {
+			return nil
+		}
+
+		desc := node.Descriptor()
+		component := Component{
+			Component:  node.Properties.Descriptor.Component,
+			Descriptor: desc,
+			Linked:     linked[node.ID()],
+		}
+		if !component.Linked && !isManifest(desc) {
+			component.Paths = uniqueSorted(paths[desc.Digest])
+		}
+		components = append(components, component)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(components, func(i, j int) bool {
+		a, b := components[i], components[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if a.Version != b.Version {
+			return a.Version < b.Version
+		}
+		return a.Descriptor.Digest < b.Descriptor.Digest
+	})
+	return components, nil
+}
+
+// Components returns the components declared across the collection graph
+// of the image, with the paths of the blobs unpacked for the platform and
+// the selector of the image.
+func (i *image) Components(ctx context.Context) ([]Component, error) {
+	graph, err := i.Graph(ctx)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := i.getManifest(ctx, i.platform)
+	if err != nil {
+		return nil, err
+	}
+	artifacts, err := i.getArtifacts(ctx, i.platform, manifest)
+	if err != nil {
+		return nil, err
+	}
+	var unpacked []ocispec.Descriptor
+	for _, artifact := range artifacts {
+		unpacked = append(unpacked, artifact.Blob)
+	}
+	return Components(ctx, graph, unpacked)
+}
+
+// uniqueSorted returns the sorted values without duplicates.
+func uniqueSorted(values []string) []string {
+	if len(values) == 0 {
+		return nil
+	}
+	sorted := append([]string(nil), values...)
+	sort.Strings(sorted)
+	unique := sorted[:1]
+	for _, v := range sorted[1:] {
+		if v != unique[len(unique)-1] {
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
+
+// isManifest returns true if the descriptor is a manifest or an index.
+func isManifest(desc ocispec.Descriptor) bool {
+	return images.IsManifestType(desc.MediaType) || images.IsIndexType(desc.MediaType) ||
+		desc.MediaType == ocispec.MediaTypeArtifactManifest || desc.MediaType == uorspec.MediaTypeCollectionManifest
+}
+
+// WriteSBOM writes the components of the collection as an SBOM document
+// created at the created time, or the current time if it is zero. Pass
+// the SOURCE_DATE_EPOCH time, so the same collection always produces the
+// same document.
+func WriteSBOM(w io.Writer, format SBOMFormat, name string, target ocispec.Descriptor, components []Component, created time.Time) error {
+	if created.IsZero() {
+		created = time.Now()
+	}
+	created = created.UTC()
+	// The document ID is derived from the collection, so
+	// documents of the same collection share their ID.
+	id := uuid.NewSHA1(uuid.NameSpaceURL, []byte(name+"@"+target.Digest.String()))
+
+	var doc interface{}
+	switch format {
+	case SBOMFormatSPDX:
+		doc = newSPDXDocument(name, id, created, components)
+	case SBOMFormatCycloneDX:
+		doc = newCycloneDXDocument(name, target, id, created, components)
+	default:
+		return fmt.Errorf("unsupported sbom format %q", format)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+// spdxDocument is an SPDX 2.3 JSON document.
+type spdxDocument struct {
+	SPDXVersion                string                 `json:"spdxVersion"`
+	DataLicense                string                 `json:"dataLicense"`
+	SPDXID                     string                 `json:"SPDXID"`
+	Name                       string                 `json:"name"`
+	DocumentNamespace          string                 `json:"documentNamespace"`
+	CreationInfo               spdxCreationInfo       `json:"creationInfo"`
+	Packages                   []spdxPackage          `json:"packages"`
+	Relationships              []spdxRelationship     `json:"relationships"`
+	HasExtractedLicensingInfos []spdxExtractedLicense `json:"hasExtractedLicensingInfos,omitempty"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	SPDXID           string            `json:"SPDXID"`
+	Name             string            `json:"name"`
+	VersionInfo      string            `json:"versionInfo,omitempty"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	LicenseConcluded string            `json:"licenseConcluded"`
+	LicenseDeclared  string            `json:"licenseDeclared"`
+	Checksums        []spdxChecksum    `json:"checksums,omitempty"`
+	SourceInfo       string            `json:"sourceInfo,omitempty"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs,omitempty"`
+}
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+// spdxExtractedLicense is a license which is not on the SPDX license
+// list, referenced by its LicenseRef- ID in the license expressions.
+type spdxExtractedLicense struct {
+	LicenseID     string `json:"licenseId"`
+	ExtractedText string `json:"extractedText"`
+	Name          string `json:"name"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+// spdxNoAssertion is the SPDX value of unknown fields.
+const spdxNoAssertion = "NOASSERTION"
+
+func newSPDXDocument(name string, id uuid.UUID, created time.Time, components []Component) spdxDocument {
+	doc := spdxDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              name,
+		DocumentNamespace: fmt.Sprintf("https://spdx.org/spdxdocs/%s-%s", strings.ReplaceAll(name, "/", "-"), id),
+		CreationInfo: spdxCreationInfo{
+			Created:  created.Format(time.RFC3339),
+			Creators: []string{"Tool: rcl"},
+		},
+		Packages:      []spdxPackage{},
+		Relationships: []spdxRelationship{},
+	}
+	refs := spdxLicenseRefs{}
+	for i, c := range components {
+		pkg := spdxPackage{
+			SPDXID:           fmt.Sprintf("SPDXRef-Package-%d", i+1),
+			Name:             c.Name,
+			VersionInfo:      c.Version,
+			DownloadLocation: spdxNoAssertion,
+			LicenseConcluded: spdxNoAssertion,
+			LicenseDeclared:  spdxNoAssertion,
+			SourceInfo:       sourceInfo(c),
+		}
+		if len(c.Licenses) > 0 {
+			pkg.LicenseDeclared = refs.expression(c.Licenses)
+		}
+		if c.Descriptor.Digest.Algorithm() == digest.SHA256 {
+			pkg.Checksums = []spdxChecksum{{Algorithm: "SHA256", ChecksumValue: c.Descriptor.Digest.Encoded()}}
+		}
+		if c.PURL != "" {
+			pkg.ExternalRefs = append(pkg.ExternalRefs, spdxExternalRef{
+				ReferenceCategory: "PACKAGE-MANAGER",
+				ReferenceType:     "purl",
+				ReferenceLocator:  c.PURL,
+			})
+		}
+		for _, cpe := range c.CPEs {
+			pkg.ExternalRefs = append(pkg.ExternalRefs, spdxExternalRef{
+				ReferenceCategory: "SECURITY",
+				ReferenceType:     "cpe23Type",
+				ReferenceLocator:  cpe,
+			})
+		}
+		doc.Packages = append(doc.Packages, pkg)
+		doc.Relationships = append(doc.Relationships, spdxRelationship{
+			SPDXElementID:      doc.SPDXID,
+			RelationshipType:   "DESCRIBES",
+			RelatedSPDXElement: pkg.SPDXID,
+		})
+	}
+	doc.HasExtractedLicensingInfos = refs.licenses
+	return doc
+}
+
+// spdxLicenseRefs references the licenses which are not
+// valid SPDX expressions by LicenseRef- IDs.
+type spdxLicenseRefs struct {
+	ids      map[string]string
+	licenses []spdxExtractedLicense
+}
+
+// expression returns the SPDX expression requiring all the licenses,
+// replacing the licenses which are not valid SPDX expressions, such as
+// "Apache License 2.0", by LicenseRef- IDs. The license references of
+// the expressions are declared without their text.
+func (r *spdxLicenseRefs) expression(licenses []string) string {
+	elements := make([]string, len(licenses))
+	for i, license := range licenses {
+		license = strings.TrimSpace(license)
+		if isSPDXExpression(license) {
+			for _, token := range licenseTokens(license) {
+				if strings.HasPrefix(token, "LicenseRef-") && !r.used(token) {
+					r.licenses = append(r.licenses, spdxExtractedLicense{LicenseID: token, ExtractedText: spdxNoAssertion, Name: token})
+				}
+			}
+		} else {
+			license = r.ref(license)
+		}
+		elements[i] = license
+	}
+	return licenseExpression(elements)
+}
+
+// ref returns the LicenseRef- ID of the license, derived from its
+// name. Licenses with the same ID once sanitized are numbered.
+func (r *spdxLicenseRefs) ref(license string) string {
+	if id, ok := r.ids[license]; ok {
+		return id
+	}
+	if r.ids == nil {
+		r.ids = map[string]string{}
+	}
+	base := "LicenseRef-" + sanitizeSPDXID(license)
+	id := base
+	for n := 2; r.used(id); n++ {
+		id = fmt.Sprintf("%s-%d", base, n)
+	}
+	r.ids[license] = id
+	r.licenses = append(r.licenses, spdxExtractedLicense{LicenseID: id, ExtractedText: license, Name: license})
+	return id
+}
+
+func (r *spdxLicenseRefs) used(id string) bool {
+	for _, l := range r.licenses {
+		if l.LicenseID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// sanitizeSPDXID replaces the runs of characters which are not
+// allowed in SPDX IDs by a dash.
+func sanitizeSPDXID(name string) string {
+	id := strings.Join(strings.FieldsFunc(name, func(r rune) bool { return !isSPDXIDRune(r) }), "-")
+	id = strings.Trim(id, "-")
+	if id == "" {
+		return "unknown"
+	}
+	return id
+}
+
+// isSPDXExpression returns true if the license is a valid SPDX
+// expression of license identifiers and license references.
+func isSPDXExpression(license string) bool {
+	if _, err := parseLicenseExpression(license); err != nil {
+		return false
+	}
+	for _, token := range licenseTokens(license) {
+		if isLicenseID(token) && !isSPDXLicenseID(token) && !isSPDXLicenseRef(token) {
+			return false
+		}
+	}
+	return true
+}
+
+// isSPDXLicenseRef returns true if the token is a license reference,
+// such as LicenseRef-vendor or DocumentRef-spdx:LicenseRef-vendor.
+func isSPDXLicenseRef(token string) bool {
+	if rest := strings.TrimPrefix(token, "DocumentRef-"); rest != token {
+		doc, ref, ok := strings.Cut(rest, ":")
+		if !ok || !isSPDXIDString(doc) {
+			return false
+		}
+		token = ref
+	}
+	rest := strings.TrimPrefix(token, "LicenseRef-")
+	return rest != token && isSPDXIDString(rest)
+}
+
+// isSPDXIDString returns true if the ID is made of letters, digits,
+// dots and dashes, as the IDs of SPDX references.
+func isSPDXIDString(id string) bool {
+	if id == "" {
+		return false
+	}
+	for _, r := range id {
+		if !isSPDXIDRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func isSPDXIDRune(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '.'
+}
+
+// licenseExpression returns the SPDX expression requiring all the
+// licenses. Compound expressions are parenthesized, so the AND applies
+// to the whole expression, e.g. "(MIT OR Apache-2.0) AND BSD-3-Clause".
+func licenseExpression(licenses []string) string {
+	if len(licenses) == 1 {
+		return strings.TrimSpace(licenses[0])
+	}
+	elements := make([]string, len(licenses))
+	for i, license := range licenses {
+		license = strings.TrimSpace(license)
+		if isCompoundLicense(license) {
+			license = "(" + license + ")"
+		}
+		elements[i] = license
+	}
+	return strings.Join(elements, " AND ")
+}
+
+// isCompoundLicense returns true if the license is an SPDX expression
+// combining licenses or exceptions, rather than a single license.
+func isCompoundLicense(license string) bool {
+	if strings.ContainsAny(license, "()") {
+		return true
+	}
+	for _, field := range strings.Fields(license) {
+		switch strings.ToUpper(field) {
+		case "AND", "OR", "WITH":
+			return true
+		}
+	}
+	return false
+}
+
+// isSPDXLicenseID returns true if the license is an SPDX license identifier
+// of the SPDX license list, rather than a license reference or a name.
+func isSPDXLicenseID(license string) bool {
+	if license == "" || strings.HasPrefix(license, "LicenseRef-") || strings.HasPrefix(license, "DocumentRef-") {
+		return false
+	}
+	for _, r := range license {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '.' || r == '+') {
+			return false
+		}
+	}
+	return true
+}
+
+// sourceInfo describes where the component was found.
+func sourceInfo(c Component) string {
+	var info []string
+	if len(c.Paths) > 0 {
+		info = append(info, fmt.Sprintf("unpacked at %s", strings.Join(c.Paths, ", ")))
+	}
+	if c.Linked {
+		info = append(info, "declared by a linked collection")
+	}
+	info = append(info, fmt.Sprintf("blob %s", c.Descriptor.Digest))
+	if len(c.Locations) > 0 {
+		info = append(info, fmt.Sprintf("locations %s", strings.Join(c.Locations, ", ")))
+	}
+	return strings.Join(info, "; ")
+}
+
+// cycloneDXDocument is a CycloneDX 1.4 JSON document.
+type cycloneDXDocument struct {
+	BOMFormat    string               `json:"bomFormat"`
+	SpecVersion  string               `json:"specVersion"`
+	SerialNumber string               `json:"serialNumber"`
+	Version      int                  `json:"version"`
+	Metadata     cycloneDXMetadata    `json:"metadata"`
+	Components   []cycloneDXComponent `json:"components"`
+}
+
+type cycloneDXMetadata struct {
+	Timestamp string             `json:"timestamp"`
+	Tools     []cycloneDXTool    `json:"tools"`
+	Component cycloneDXComponent `json:"component"`
+}
+
+type cycloneDXTool struct {
+	Name string `json:"name"`
+}
+
+type cycloneDXComponent struct {
+	BOMRef     string              `json:"bom-ref,omitempty"`
+	Type       string              `json:"type"`
+	Name       string              `json:"name"`
+	Version    string              `json:"version,omitempty"`
+	PURL       string              `json:"purl,omitempty"`
+	CPE        string              `json:"cpe,omitempty"`
+	Licenses   []cycloneDXLicense  `json:"licenses,omitempty"`
+	Hashes     []cycloneDXHash     `json:"hashes,omitempty"`
+	Properties []cycloneDXProperty `json:"properties,omitempty"`
+}
+
+// cycloneDXLicense is a license or an SPDX license expression.
+type cycloneDXLicense struct {
+	License    *cycloneDXLicenseChoice `json:"license,omitempty"`
+	Expression string                  `json:"expression,omitempty"`
+}
+
+// cycloneDXLicenseChoice is a license set by SPDX license ID or by name.
+type cycloneDXLicenseChoice struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+type cycloneDXHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type cycloneDXProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// cycloneDXTypes are the CycloneDX component types.
+var cycloneDXTypes = map[string]bool{
+	"application": true, "framework": true, "library": true, "container": true,
+	"operating-system": true, "device": true, "firmware": true, "file": true,
+}
+
+func newCycloneDXDocument(name string, target ocispec.Descriptor, id uuid.UUID, created time.Time, components []Component) cycloneDXDocument {
+	doc := cycloneDXDocument{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.4",
+		SerialNumber: id.URN(),
+		Version:      1,
+		Metadata: cycloneDXMetadata{
+			Timestamp: created.Format(time.RFC3339),
+			Tools:     []cycloneDXTool{{Name: "rcl"}},
+			Component: cycloneDXComponent{
+				BOMRef:  target.Digest.String(),
+				Type:    "container",
+				Name:    name,
+				Version: target.Digest.String(),
+			},
+		},
+		Components: []cycloneDXComponent{},
+	}
+	for i, c := range components {
+		component := cycloneDXComponent{
+			BOMRef:  fmt.Sprintf("component-%d", i+1),
+			Type:    "library",
+			Name:    c.Name,
+			Version: c.Version,
+			PURL:    c.PURL,
+		}
+		if cycloneDXTypes[c.Type] {
+			component.Type = c.Type
+		}
+		if len(c.CPEs) > 0 {
+			component.CPE = c.CPEs[0]
+		}
+		component.Licenses = cycloneDXLicenses(c.Licenses)
+		if c.Descriptor.Digest.Algorithm() == digest.SHA256 {
+			component.Hashes = []cycloneDXHash{{Alg: "SHA-256", Content: c.Descriptor.Digest.Encoded()}}
+		}
+		component.Properties = append(component.Properties, cycloneDXProperty{Name: "rcl:digest", Value: c.Descriptor.Digest.String()})
+		for _, path := range c.Paths {
+			component.Properties = append(component.Properties, cycloneDXProperty{Name: "rcl:path", Value: path})
+		}
+		if c.Linked {
+			component.Properties = append(component.Properties, cycloneDXProperty{Name: "rcl:linked", Value: "true"})
+		}
+		for _, location := range c.Locations {
+			component.Properties = append(component.Properties, cycloneDXProperty{Name: "rcl:location", Value: location})
+		}
+		doc.Components = append(doc.Components, component)
+	}
+	return doc
+}
+
+// cycloneDXLicenses returns the CycloneDX licenses of the component. SPDX
+// license IDs are set as IDs and other licenses as names. Licenses with a
+// compound expression are combined in a single SPDX expression, since
+// expressions cannot be listed next to other licenses.
+func cycloneDXLicenses(licenses []string) []cycloneDXLicense {
+	var result []cycloneDXLicense
+	for _, license := range licenses {
+		license = strings.TrimSpace(license)
+		if isCompoundLicense(license) {
+			return []cycloneDXLicense{{Expression: licenseExpression(licenses)}}
+		}
+		choice := &cycloneDXLicenseChoice{Name: license}
+		if isSPDXLicenseID(license) {
+			choice = &cycloneDXLicenseChoice{ID: license}
+		}
+		result = append(result, cycloneDXLicense{License: choice})
+	}
+	return result
+}
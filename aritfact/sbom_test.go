@@ -0,0 +1,254 @@
+package aritfact
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/google/uuid"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	uorspec "github.com/uor-framework/collection-spec/specs-go/v1alpha1"
+	"github.com/uor-framework/uor-client-go/nodes/descriptor"
+)
+
+// memoryStore is a content provider holding blobs in memory.
+type memoryStore map[digest.Digest][]byte
+
+func (m memoryStore) ReaderAt(_ context.Context, desc ocispec.Descriptor) (content.ReaderAt, error) {
+	b, ok := m[desc.Digest]
+	if !ok {
+		return nil, fmt.Errorf("content %s: %w", desc.Digest, errdefs.ErrNotFound)
+	}
+	return memoryReaderAt{bytes.NewReader(b)}, nil
+}
+
+type memoryReaderAt struct {
+	*bytes.Reader
+}
+
+func (memoryReaderAt) Close() error { return nil }
+
+// add stores the JSON encoding of v and returns its descriptor.
+func (m memoryStore) add(t *testing.T, mediaType string, v interface{}) ocispec.Descriptor {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dgst := digest.FromBytes(b)
+	m[dgst] = b
+	return ocispec.Descriptor{MediaType: mediaType, Digest: dgst, Size: int64(len(b))}
+}
+
+// componentBlob returns the descriptor of a blob titled title, declaring
+// a component with the licenses. The digest only depends on the content.
+func componentBlob(t *testing.T, title, content, name string, licenses ...string) ocispec.Descriptor {
+	t.Helper()
+	attrs, err := json.Marshal(map[string]interface{}{"name": name, "version": "1.0.0", "licenses": licenses})
+	if err != nil {
+		t.Fatal(err)
+	}
+	annotations, err := descriptor.AnnotationsFromAttributes(map[string]json.RawMessage{descriptor.TypeDescriptor: attrs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	annotations[ocispec.AnnotationTitle] = title
+	return ocispec.Descriptor{
+		MediaType:   "application/octet-stream",
+		Digest:      digest.FromString(content),
+		Size:        int64(len(content)),
+		Annotations: annotations,
+	}
+}
+
+// collectionGraph stores a manifest of the blobs and loads its graph.
+func collectionGraph(t *testing.T, store memoryStore, blobs ...ocispec.Descriptor) *Graph {
+	t.Helper()
+	config := store.add(t, "application/vnd.uor.config.v1+json", map[string]string{})
+	target := store.add(t, ocispec.MediaTypeImageManifest, ocispec.Manifest{
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config:    config,
+		Layers:    blobs,
+	})
+	graph, err := LoadGraph(context.Background(), store, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return graph
+}
+
+func TestComponentsPaths(t *testing.T) {
+	shared := componentBlob(t, "bin/tool", "tool", "tool")
+	duplicate := componentBlob(t, "usr/bin/tool", "tool", "tool")
+	skipped := componentBlob(t, "lib/other", "other", "other")
+	graph := collectionGraph(t, memoryStore{}, shared, duplicate, skipped)
+
+	tests := []struct {
+		name     string
+		unpacked []ocispec.Descriptor
+		want     map[string][]string
+	}{
+		{
+			name:     "duplicate paths",
+			unpacked: []ocispec.Descriptor{duplicate, shared, skipped},
+			want:     map[string][]string{"tool": {"/bin/tool", "/usr/bin/tool"}, "other": {"/lib/other"}},
+		},
+		{
+			name:     "skipped blob",
+			unpacked: []ocispec.Descriptor{shared},
+			want:     map[string][]string{"tool": {"/bin/tool"}, "other": nil},
+		},
+		{
+			name: "nothing unpacked",
+			want: map[string][]string{"tool": nil, "other": nil},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			components, err := Components(context.Background(), graph, tt.unpacked)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := map[string][]string{}
+			for _, c := range components {
+				got[c.Name] = c.Paths
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("paths = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLicenseExpression(t *testing.T) {
+	tests := []struct {
+		licenses []string
+		want     string
+	}{
+		{licenses: []string{"MIT"}, want: "MIT"},
+		{licenses: []string{"MIT OR Apache-2.0"}, want: "MIT OR Apache-2.0"},
+		{licenses: []string{"MIT", "BSD-3-Clause"}, want: "MIT AND BSD-3-Clause"},
+		{licenses: []string{"MIT OR Apache-2.0", "BSD-3-Clause"}, want: "(MIT OR Apache-2.0) AND BSD-3-Clause"},
+		{licenses: []string{"GPL-2.0-only WITH Classpath-exception-2.0", "MIT"}, want: "(GPL-2.0-only WITH Classpath-exception-2.0) AND MIT"},
+		{licenses: []string{"(MIT)", "ISC"}, want: "((MIT)) AND ISC"},
+	}
+	for _, tt := range tests {
+		if got := licenseExpression(tt.licenses); got != tt.want {
+			t.Errorf("licenseExpression(%q) = %q, want %q", tt.licenses, got, tt.want)
+		}
+	}
+}
+
+func TestSPDXLicenses(t *testing.T) {
+	component := func(name string, licenses ...string) Component {
+		return Component{
+			Component:  uorspec.Component{Name: name, Licenses: licenses},
+			Descriptor: ocispec.Descriptor{Digest: digest.FromString(name)},
+		}
+	}
+	components := []Component{
+		component("none"),
+		component("ids", "MIT", "Apache-2.0 OR BSD-2-Clause"),
+		component("exception", "GPL-2.0-only WITH Classpath-exception-2.0"),
+		component("ref", "LicenseRef-vendor", "DocumentRef-spdx:LicenseRef-other"),
+		component("names", "Apache License 2.0", "MIT"),
+		component("same name", " Apache License 2.0 "),
+		component("same id", "Apache License/2.0", "GPL/2"),
+		component("invalid expression", "MIT OR", "(MIT"),
+		component("invalid ref", "LicenseRef-"),
+	}
+	doc := newSPDXDocument("localhost:5001/app:v1", uuid.Nil, time.Unix(0, 0), components)
+
+	want := map[string]string{
+		"none":               spdxNoAssertion,
+		"ids":                "MIT AND (Apache-2.0 OR BSD-2-Clause)",
+		"exception":          "GPL-2.0-only WITH Classpath-exception-2.0",
+		"ref":                "LicenseRef-vendor AND DocumentRef-spdx:LicenseRef-other",
+		"names":              "LicenseRef-Apache-License-2.0 AND MIT",
+		"same name":          "LicenseRef-Apache-License-2.0",
+		"same id":            "LicenseRef-Apache-License-2.0-2 AND LicenseRef-GPL-2",
+		"invalid expression": "LicenseRef-MIT-OR AND LicenseRef-MIT",
+		"invalid ref":        "LicenseRef-LicenseRef",
+	}
+	for _, pkg := range doc.Packages {
+		if pkg.LicenseDeclared != want[pkg.Name] {
+			t.Errorf("%s: licenseDeclared = %q, want %q", pkg.Name, pkg.LicenseDeclared, want[pkg.Name])
+		}
+		if pkg.LicenseConcluded != spdxNoAssertion {
+			t.Errorf("%s: licenseConcluded = %q, want %q", pkg.Name, pkg.LicenseConcluded, spdxNoAssertion)
+		}
+	}
+
+	wantLicenses := []spdxExtractedLicense{
+		{LicenseID: "LicenseRef-vendor", ExtractedText: spdxNoAssertion, Name: "LicenseRef-vendor"},
+		{LicenseID: "LicenseRef-Apache-License-2.0", ExtractedText: "Apache License 2.0", Name: "Apache License 2.0"},
+		{LicenseID: "LicenseRef-Apache-License-2.0-2", ExtractedText: "Apache License/2.0", Name: "Apache License/2.0"},
+		{LicenseID: "LicenseRef-GPL-2", ExtractedText: "GPL/2", Name: "GPL/2"},
+		{LicenseID: "LicenseRef-MIT-OR", ExtractedText: "MIT OR", Name: "MIT OR"},
+		{LicenseID: "LicenseRef-MIT", ExtractedText: "(MIT", Name: "(MIT"},
+		{LicenseID: "LicenseRef-LicenseRef", ExtractedText: "LicenseRef-", Name: "LicenseRef-"},
+	}
+	if !reflect.DeepEqual(doc.HasExtractedLicensingInfos, wantLicenses) {
+		t.Errorf("hasExtractedLicensingInfos = %+v, want %+v", doc.HasExtractedLicensingInfos, wantLicenses)
+	}
+
+	// Every license reference of the packages is declared.
+	declared := map[string]bool{}
+	for _, l := range doc.HasExtractedLicensingInfos {
+		declared[l.LicenseID] = true
+	}
+	for _, pkg := range doc.Packages {
+		for _, token := range licenseTokens(pkg.LicenseDeclared) {
+			if strings.HasPrefix(token, "LicenseRef-") && !declared[token] {
+				t.Errorf("%s: license reference %s is not declared", pkg.Name, token)
+			}
+		}
+	}
+}
+
+func TestCycloneDXLicenses(t *testing.T) {
+	tests := []struct {
+		name     string
+		licenses []string
+		want     []cycloneDXLicense
+	}{
+		{name: "none"},
+		{
+			name:     "license IDs",
+			licenses: []string{"MIT", "Apache-2.0"},
+			want: []cycloneDXLicense{
+				{License: &cycloneDXLicenseChoice{ID: "MIT"}},
+				{License: &cycloneDXLicenseChoice{ID: "Apache-2.0"}},
+			},
+		},
+		{
+			name:     "license names",
+			licenses: []string{"Proprietary license", "LicenseRef-vendor"},
+			want: []cycloneDXLicense{
+				{License: &cycloneDXLicenseChoice{Name: "Proprietary license"}},
+				{License: &cycloneDXLicenseChoice{Name: "LicenseRef-vendor"}},
+			},
+		},
+		{
+			name:     "expression",
+			licenses: []string{"MIT", "Apache-2.0 OR BSD-2-Clause"},
+			want:     []cycloneDXLicense{{Expression: "MIT AND (Apache-2.0 OR BSD-2-Clause)"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := cycloneDXLicenses(tt.licenses)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("cycloneDXLicenses() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
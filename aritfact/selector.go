@@ -0,0 +1,217 @@
+package aritfact
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/uor-framework/uor-client-go/attributes"
+	"github.com/uor-framework/uor-client-go/model"
+	"github.com/uor-framework/uor-client-go/nodes/descriptor"
+	v2 "github.com/uor-framework/uor-client-go/nodes/descriptor/v2"
+)
+
+// Selector selects blobs by their attributes. A blob is selected when
+// it sets every attribute of the selector. The zero value selects
+// every blob.
+type Selector struct {
+	// schemas maps schema IDs to the attributes set under the schema.
+	schemas map[string]attributes.Attributes
+	// any are the attributes set under any schema.
+	any []model.Attribute
+}
+
+var _ model.Matcher = Selector{}
+
+// ParseSelector parses attribute queries into a selector matching all of
+// them. A query is either a JSON object of attribute sets keyed by schema
+// ID, e.g. {"core-descriptor":{"type":"binary"}}, or a comma separated
+// list of [schema:]key=value pairs. Values are JSON scalars or strings,
+// so `version="1"` selects the string "1".
+func ParseSelector(queries ...string) (Selector, error) {
+	s := Selector{schemas: map[string]attributes.Attributes{}}
+	for _, query := range queries {
+		query = strings.TrimSpace(query)
+		var err error
+		if strings.HasPrefix(query, "{") {
+			err = s.parseJSON(query)
+		} else {
+			err = s.parsePairs(query)
+		}
+		if err != nil {
+			return Selector{}, fmt.Errorf("invalid selector %q: %w", query, err)
+		}
+	}
+	return s, nil
+}
+
+// parseJSON parses a JSON attribute query.
+func (s *Selector) parseJSON(query string) error {
+	var sets map[string]map[string]interface{}
+	if err := json.Unmarshal([]byte(query), &sets); err != nil {
+		return err
+	}
+	for schema, set := range sets {
+		for key, value := range set {
+			attr, err := attributes.Reflect(key, value)
+			if err != nil {
+				return fmt.Errorf("schema %s key %s: %w", schema, key, err)
+			}
+			s.add(schema, attr)
+		}
+	}
+	return nil
+}
+
+// parsePairs parses a comma separated list of [schema:]key=value pairs.
+func (s *Selector) parsePairs(query string) error {
+	for _, pair := range strings.Split(query, ",") {
+		pair = strings.TrimSpace(pair)
+		key, raw, ok := strings.Cut(pair, "=")
+		var schema string
+		if i := strings.LastIndex(key, ":"); i >= 0 {
+			schema, key = key[:i], key[i+1:]
+		}
+		if !ok || key == "" {
+			return fmt.Errorf("%q must be formatted as [schema:]key=value", pair)
+		}
+
+		var value interface{} = raw
+		if err := json.Unmarshal([]byte(raw), &value); err != nil {
+			value = raw
+		}
+		attr, err := attributes.Reflect(key, value)
+		if err != nil {
+			return fmt.Errorf("key %s: %w", key, err)
+		}
+		s.add(schema, attr)
+	}
+	return nil
+}
+
+// add adds an attribute under the schema, or under any
+// schema if the schema is empty.
+func (s *Selector) add(schema string, attr model.Attribute) {
+	if schema == "" {
+		s.any = append(s.any, attr)
+		return
+	}
+	set, ok := s.schemas[schema]
+	if !ok {
+		set = attributes.Attributes{}
+		s.schemas[schema] = set
+	}
+	set[attr.Key()] = attr
+}
+
+// Empty returns true if the selector selects every blob.
+func (s Selector) Empty() bool {
+	return len(s.schemas) == 0 && len(s.any) == 0
+}
+
+// String returns the selector as a canonical query, so
+// equal selectors always produce the same string.
+func (s Selector) String() string {
+	var pairs []string
+	for schema, set := range s.schemas {
+		for _, attr := range set {
+			pairs = append(pairs, fmt.Sprintf("%s:%s", schema, formatAttribute(attr)))
+		}
+	}
+	for _, attr := range s.any {
+		pairs = append(pairs, formatAttribute(attr))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// formatAttribute formats an attribute as a key=value pair.
+func formatAttribute(attr model.Attribute) string {
+	value, _ := json.Marshal(attr.AsAny())
+	return fmt.Sprintf("%s=%s", attr.Key(), value)
+}
+
+// Matches returns true if the node is a descriptor
+// node setting every attribute of the selector.
+func (s Selector) Matches(node model.Node) (bool, error) {
+	if s.Empty() {
+		return true, nil
+	}
+	n, ok := node.(*v2.Node)
+	if !ok || n.Properties == nil {
+		return false, nil
+	}
+	props := n.Properties
+	core, err := coreAttributes(props)
+	if err != nil {
+		return false, err
+	}
+
+	for schema, set := range s.schemas {
+		for _, attr := range set {
+			var exists bool
+			if coreSet, ok := core[schema]; ok {
+				exists, err = coreSet.Exists(attr)
+			} else {
+				exists, err = props.ExistsBySchema(schema, attr)
+			}
+			if err != nil || !exists {
+				return false, err
+			}
+		}
+	}
+	for _, attr := range s.any {
+		exists, err := props.Exists(attr)
+		if err != nil {
+			return false, err
+		}
+		for _, coreSet := range core {
+			if exists {
+				break
+			}
+			if exists, err = coreSet.Exists(attr); err != nil {
+				return false, err
+			}
+		}
+		if !exists {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// coreAttributes returns the scalar attributes of the core schemas, which
+// are decoded into their spec types instead of attribute sets.
+func coreAttributes(props *descriptor.Properties) (map[string]attributes.Attributes, error) {
+	core := map[string]interface{}{
+		descriptor.TypeDescriptor: props.Descriptor,
+		descriptor.TypeFile:       props.File,
+		descriptor.TypeLink:       props.Link,
+		descriptor.TypeSchema:     props.Schema,
+		descriptor.TypeRuntime:    props.Runtime,
+	}
+	sets := map[string]attributes.Attributes{}
+	for schema, v := range core {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		var values map[string]interface{}
+		if err := json.Unmarshal(data, &values); err != nil {
+			return nil, err
+		}
+		if values == nil {
+			continue
+		}
+		set := attributes.Attributes{}
+		for key, value := range values {
+			// Only scalar values can be selected.
+			if attr, err := attributes.Reflect(key, value); err == nil {
+				set[key] = attr
+			}
+		}
+		sets[schema] = set
+	}
+	return sets, nil
+}
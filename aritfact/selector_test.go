@@ -0,0 +1,153 @@
+package aritfact
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/uor-framework/uor-client-go/nodes/descriptor"
+	v2 "github.com/uor-framework/uor-client-go/nodes/descriptor/v2"
+)
+
+// attributeAnnotations returns the annotations setting
+// the attribute sets, keyed by schema ID.
+func attributeAnnotations(t *testing.T, sets map[string]interface{}) map[string]string {
+	t.Helper()
+	attrs := map[string]json.RawMessage{}
+	for schema, set := range sets {
+		b, err := json.Marshal(set)
+		if err != nil {
+			t.Fatal(err)
+		}
+		attrs[schema] = b
+	}
+	annotations, err := descriptor.AnnotationsFromAttributes(attrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return annotations
+}
+
+// attributeNode returns the descriptor node of a blob
+// setting the attribute sets, keyed by schema ID.
+func attributeNode(t *testing.T, sets map[string]interface{}) *v2.Node {
+	t.Helper()
+	desc := ocispec.Descriptor{
+		MediaType:   "application/octet-stream",
+		Digest:      digest.FromString("blob"),
+		Size:        4,
+		Annotations: attributeAnnotations(t, sets),
+	}
+	node, err := v2.NewNode(desc.Digest.String(), desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return node
+}
+
+func TestParseSelector(t *testing.T) {
+	tests := []struct {
+		name    string
+		queries []string
+		want    string
+		wantErr bool
+	}{
+		{name: "empty"},
+		{name: "pair", queries: []string{"core-descriptor:type=binary"}, want: `core-descriptor:type="binary"`},
+		{
+			name:    "pairs",
+			queries: []string{" version=\"1\" , rcl-platform:os=linux,size=3,debug=true"},
+			want:    `debug=true,rcl-platform:os="linux",size=3,version="1"`,
+		},
+		{name: "schema with colons", queries: []string{"example.com:8080/schema:key=value"}, want: `example.com:8080/schema:key="value"`},
+		{
+			name:    "json",
+			queries: []string{`{"core-descriptor":{"type":"binary"},"rcl-platform":{"os":"linux","size":3}}`},
+			want:    `core-descriptor:type="binary",rcl-platform:os="linux",rcl-platform:size=3`,
+		},
+		{
+			name:    "several queries",
+			queries: []string{`{"core-descriptor":{"type":"binary"}}`, "os=linux"},
+			want:    `core-descriptor:type="binary",os="linux"`,
+		},
+		{name: "missing value", queries: []string{"type"}, wantErr: true},
+		{name: "missing key", queries: []string{"=binary"}, wantErr: true},
+		{name: "missing schema key", queries: []string{"core-descriptor:=binary"}, wantErr: true},
+		{name: "empty pair", queries: []string{"type=binary,"}, wantErr: true},
+		{name: "malformed json", queries: []string{`{"core-descriptor":{"type":"binary"}`}, wantErr: true},
+		{name: "json without schema", queries: []string{`{"type":"binary"}`}, wantErr: true},
+		{name: "json list value", queries: []string{`{"core-descriptor":{"licenses":["MIT"]}}`}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSelector(tt.queries...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSelector() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got.String() != tt.want {
+				t.Errorf("ParseSelector() = %s, want %s", got, tt.want)
+			}
+			if got.Empty() != (tt.want == "") {
+				t.Errorf("Empty() = %v for %s", got.Empty(), got)
+			}
+		})
+	}
+}
+
+func TestSelectorMatches(t *testing.T) {
+	node := attributeNode(t, map[string]interface{}{
+		descriptor.TypeDescriptor: map[string]interface{}{"name": "tool", "version": "1.0.0", "type": "binary"},
+		descriptor.TypeFile:       map[string]interface{}{"permissions": 0755, "uid": 0, "gid": 0},
+		"rcl-platform":            map[string]interface{}{"os": "linux", "architecture": "amd64"},
+		"example":                 map[string]interface{}{"debug": true, "size": 3, "name": "example"},
+	})
+	tests := []struct {
+		name    string
+		queries []string
+		want    bool
+	}{
+		{name: "empty", want: true},
+		{name: "core schema", queries: []string{"core-descriptor:type=binary"}, want: true},
+		{name: "core schema number", queries: []string{"core-file:permissions=493"}, want: true},
+		{name: "core schema non-match", queries: []string{"core-descriptor:type=library"}},
+		// Core attributes are only matched under their own schema.
+		{name: "core attribute under other schema", queries: []string{"rcl-platform:type=binary"}},
+		{name: "other schema", queries: []string{"rcl-platform:os=linux,example:size=3"}, want: true},
+		{name: "other schema bool", queries: []string{`{"example":{"debug":true}}`}, want: true},
+		{name: "other schema non-match", queries: []string{"rcl-platform:os=windows"}},
+		{name: "other schema value type", queries: []string{`example:size="3"`}},
+		{name: "missing schema", queries: []string{"missing:os=linux"}},
+		{name: "unscoped core attribute", queries: []string{"version=\"1.0.0\""}, want: true},
+		{name: "unscoped other attribute", queries: []string{"architecture=amd64"}, want: true},
+		{name: "unscoped attribute of several schemas", queries: []string{"name=example"}, want: true},
+		{name: "unscoped non-match", queries: []string{"architecture=arm64"}},
+		{name: "every attribute", queries: []string{"type=binary", "rcl-platform:os=linux"}, want: true},
+		{name: "one attribute missing", queries: []string{"type=binary", "rcl-platform:os=darwin"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := ParseSelector(tt.queries...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := s.Matches(node)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Matches(%s) = %v, want %v", s, got, tt.want)
+			}
+		})
+	}
+
+	// Nodes without attributes are only selected by the empty selector.
+	bare := attributeNode(t, nil)
+	s, err := ParseSelector("type=binary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.Matches(bare); err != nil || got {
+		t.Errorf("Matches(no attributes) = %v, %v, want false", got, err)
+	}
+}
@@ -0,0 +1,68 @@
+package spec
+
+// SchemaFile is the schema ID for extended file metadata.
+const SchemaFile = "rcl-file"
+
+// File types that can be declared with the file schema.
+const (
+	FileTypeRegular     = "file"
+	FileTypeDirectory   = "dir"
+	FileTypeSymlink     = "symlink"
+	FileTypeHardlink    = "hardlink"
+	FileTypeCharDevice  = "char"
+	FileTypeBlockDevice = "block"
+	FileTypeFIFO        = "fifo"
+)
+
+// Ownership policies for the entries extracted from directory blobs.
+const (
+	OwnershipPreserve = "preserve"
+	OwnershipForce    = "force"
+	OwnershipMap      = "map"
+)
+
+// File is a schema that extends the core file attributes with
+// metadata stored as extended attributes on the written files.
+// For directory blobs, the extended attributes and the SELinux
+// label are set on every extracted entry.
+type File struct {
+	// Type declares the type of the entry written for the blob. Entries other
+	// than regular files are created from the attributes and the blob content
+	// is not written. Defaults to a regular file.
+	Type string `json:"type,omitempty"`
+	// Linkname is the target of a symbolic link, or the name
+	// of the existing entry for a hard link.
+	Linkname string `json:"linkname,omitempty"`
+	// Major is the major number of a device node.
+	Major int64 `json:"major,omitempty"`
+	// Minor is the minor number of a device node.
+	Minor int64 `json:"minor,omitempty"`
+	// Xattrs is a comma separated list of name=value extended attributes
+	// (e.g. user.origin=build). Binary values can be hex encoded with a "0x"
+	// prefix or base64 encoded with a "0s" prefix, as printed by getfattr.
+	Xattrs string `json:"xattrs,omitempty"`
+	// Capabilities are the file capabilities in the libcap
+	// text format (e.g. cap_net_bind_service=+ep).
+	Capabilities string `json:"capabilities,omitempty"`
+	// SELinuxLabel is the SELinux security context of the file
+	// (e.g. system_u:object_r:container_file_t:s0).
+	SELinuxLabel string `json:"selinuxLabel,omitempty"`
+	// Mtime is the modification time of the entry in seconds since the
+	// Unix epoch. Defaults to the source date epoch of the store, if set.
+	Mtime *int64 `json:"mtime,omitempty"`
+	// Atime is the access time of the entry in seconds
+	// since the Unix epoch. Defaults to the modification time.
+	Atime *int64 `json:"atime,omitempty"`
+	// Ownership is the ownership policy of the entries extracted from a
+	// directory blob. "preserve" keeps the ids stored in the archive, "force"
+	// sets the core-file uid and gid on every entry and "map" maps the ids
+	// stored in the archive with UIDMap and GIDMap. By default, the entries
+	// are owned by the user extracting the blob.
+	Ownership string `json:"ownership,omitempty"`
+	// UIDMap is a comma separated list of archive:host:size ranges
+	// mapping the user ids stored in the archive (e.g. 0:100000:65536).
+	UIDMap string `json:"uidMap,omitempty"`
+	// GIDMap is a comma separated list of archive:host:size ranges
+	// mapping the group ids stored in the archive.
+	GIDMap string `json:"gidMap,omitempty"`
+}
@@ -0,0 +1,55 @@
+package spec
+
+import (
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	uorspec "github.com/uor-framework/collection-spec/specs-go/v1alpha1"
+)
+
+// SchemaPlatform is the schema ID for the platform of a blob.
+const SchemaPlatform = "rcl-platform"
+
+// Platform is a schema declaring the platform a blob is built for, so a
+// collection can carry blobs for several platforms.
+//
+// The collection spec defines a platform type, but no core schema sets it:
+// uor-client-go only parses the core-link, core-descriptor, core-schema,
+// core-runtime and core-file attributes. It is also not usable as is, since
+// attribute values are scalars (null, bool, number or string), which the
+// os.features array is not. Platform is the collection spec platform with
+// the OS features encoded as a comma separated list instead, so the schema
+// only has scalar values and is stored as an attribute set like the others.
+type Platform struct {
+	// Architecture is the CPU architecture (e.g. amd64 or arm64).
+	Architecture string `json:"architecture,omitempty"`
+	// OS is the operating system (e.g. linux).
+	OS string `json:"os,omitempty"`
+	// OSVersion is the operating system version.
+	OSVersion string `json:"os.version,omitempty"`
+	// OSFeatures is a comma separated list of required OS features.
+	OSFeatures string `json:"os.features,omitempty"`
+	// Variant is the CPU variant (e.g. v7 for arm).
+	Variant string `json:"variant,omitempty"`
+}
+
+// Spec returns the collection spec platform.
+func (p Platform) Spec() uorspec.Platform {
+	return uorspec.Platform{
+		Architecture: p.Architecture,
+		OS:           p.OS,
+		OSVersion:    p.OSVersion,
+		OSFeatures:   SplitList(p.OSFeatures),
+		Variant:      p.Variant,
+	}
+}
+
+// OCI returns the OCI platform.
+func (p Platform) OCI() ocispec.Platform {
+	s := p.Spec()
+	return ocispec.Platform{
+		Architecture: s.Architecture,
+		OS:           s.OS,
+		OSVersion:    s.OSVersion,
+		OSFeatures:   s.OSFeatures,
+		Variant:      s.Variant,
+	}
+}
@@ -0,0 +1,73 @@
+package spec
+
+import "strings"
+
+// SchemaResources is the schema ID for container resource defaults.
+const SchemaResources = "rcl-resources"
+
+// Resources is a schema that sets default resource limits and
+// security options for containers created from a collection.
+// Options that widen the container privileges (e.g. privileged mode
+// or seccomp and AppArmor profiles) are intentionally only configurable
+// by the caller.
+type Resources struct {
+	// Memory is the memory limit in a human-readable format (e.g. 512m).
+	Memory string `json:"memory,omitempty"`
+	// CPUs is the number of CPUs the container can use.
+	CPUs float64 `json:"cpus,omitempty"`
+	// PidsLimit is the maximum number of processes.
+	PidsLimit int64 `json:"pidsLimit,omitempty"`
+	// CapAdd is a comma separated list of capabilities to add.
+	CapAdd string `json:"capAdd,omitempty"`
+	// CapDrop is a comma separated list of capabilities to drop.
+	CapDrop string `json:"capDrop,omitempty"`
+	// NoNewPrivileges sets no_new_privs for the container process.
+	NoNewPrivileges *bool `json:"noNewPrivileges,omitempty"`
+	// ReadOnly mounts the container rootfs read-only.
+	ReadOnly *bool `json:"readOnly,omitempty"`
+}
+
+// Merge returns the resources with the set values of
+// overrides replacing the values in r. Capability lists are
+// merged instead: the capabilities of overrides are added to
+// the lists of r, and a capability added by overrides is removed
+// from the dropped capabilities of r and the other way around.
+func (r Resources) Merge(overrides Resources) Resources {
+	if overrides.Memory != "" {
+		r.Memory = overrides.Memory
+	}
+	if overrides.CPUs != 0 {
+		r.CPUs = overrides.CPUs
+	}
+	if overrides.PidsLimit != 0 {
+		r.PidsLimit = overrides.PidsLimit
+	}
+	capAdd, capDrop := SplitList(overrides.CapAdd), SplitList(overrides.CapDrop)
+	r.CapAdd = mergeList(r.CapAdd, capAdd, capDrop)
+	r.CapDrop = mergeList(r.CapDrop, capDrop, capAdd)
+	if overrides.NoNewPrivileges != nil {
+		r.NoNewPrivileges = overrides.NoNewPrivileges
+	}
+	if overrides.ReadOnly != nil {
+		r.ReadOnly = overrides.ReadOnly
+	}
+	return r
+}
+
+// mergeList returns the comma separated list with the elements
+// of add appended and the elements of remove removed. Elements
+// are not repeated.
+func mergeList(list string, add, remove []string) string {
+	seen := make(map[string]bool)
+	for _, v := range remove {
+		seen[v] = true
+	}
+	var merged []string
+	for _, v := range append(SplitList(list), add...) {
+		if !seen[v] {
+			seen[v] = true
+			merged = append(merged, v)
+		}
+	}
+	return strings.Join(merged, ",")
+}
@@ -0,0 +1,80 @@
+package spec
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResourcesMerge(t *testing.T) {
+	yes, no := true, false
+	defaults := Resources{
+		Memory:          "512m",
+		CPUs:            1,
+		PidsLimit:       100,
+		CapAdd:          "CAP_NET_BIND_SERVICE,CAP_SYS_TIME",
+		CapDrop:         "CAP_CHOWN",
+		NoNewPrivileges: &yes,
+	}
+	tests := []struct {
+		name      string
+		overrides Resources
+		want      Resources
+	}{
+		{name: "no overrides", want: defaults},
+		{
+			name:      "limits",
+			overrides: Resources{Memory: "1g", CPUs: 0.5, PidsLimit: 10, NoNewPrivileges: &no, ReadOnly: &yes},
+			want: Resources{
+				Memory:          "1g",
+				CPUs:            0.5,
+				PidsLimit:       10,
+				CapAdd:          defaults.CapAdd,
+				CapDrop:         defaults.CapDrop,
+				NoNewPrivileges: &no,
+				ReadOnly:        &yes,
+			},
+		},
+		{
+			name:      "added capabilities",
+			overrides: Resources{CapAdd: "CAP_SYS_TIME, CAP_NET_ADMIN"},
+			want: Resources{
+				Memory:          defaults.Memory,
+				CPUs:            defaults.CPUs,
+				PidsLimit:       defaults.PidsLimit,
+				CapAdd:          "CAP_NET_BIND_SERVICE,CAP_SYS_TIME,CAP_NET_ADMIN",
+				CapDrop:         defaults.CapDrop,
+				NoNewPrivileges: &yes,
+			},
+		},
+		{
+			name:      "dropped capabilities",
+			overrides: Resources{CapDrop: "CAP_SYS_TIME,CAP_MKNOD"},
+			want: Resources{
+				Memory:          defaults.Memory,
+				CPUs:            defaults.CPUs,
+				PidsLimit:       defaults.PidsLimit,
+				CapAdd:          "CAP_NET_BIND_SERVICE",
+				CapDrop:         "CAP_CHOWN,CAP_SYS_TIME,CAP_MKNOD",
+				NoNewPrivileges: &yes,
+			},
+		},
+		{
+			name:      "added capability dropped by the defaults",
+			overrides: Resources{CapAdd: "CAP_CHOWN"},
+			want: Resources{
+				Memory:          defaults.Memory,
+				CPUs:            defaults.CPUs,
+				PidsLimit:       defaults.PidsLimit,
+				CapAdd:          "CAP_NET_BIND_SERVICE,CAP_SYS_TIME,CAP_CHOWN",
+				NoNewPrivileges: &yes,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := defaults.Merge(tt.overrides); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Merge() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,12 @@
+package spec
+
+// SchemaRuntime is the schema ID for container runtime requests.
+const SchemaRuntime = "rcl-runtime"
+
+// Runtime is a schema that allows a collection to request
+// the runtime used to run its containers.
+type Runtime struct {
+	// RuntimeClass is the name of the containerd runtime
+	// (e.g. io.containerd.runsc.v1).
+	RuntimeClass string `json:"runtimeClass,omitempty"`
+}
@@ -0,0 +1,33 @@
+package spec
+
+import (
+	"embed"
+	"path"
+	"strings"
+)
+
+// schemas are the JSON schemas of the attribute sets
+// interpreted by this client, named by schema ID.
+//
+//go:embed schemas/*.json
+var schemas embed.FS
+
+// JSONSchema returns the built-in JSON schema of the schema ID. It
+// returns false if the attribute set has no built-in schema.
+func JSONSchema(id string) ([]byte, bool) {
+	data, err := schemas.ReadFile(path.Join("schemas", id+".json"))
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// JSONSchemaIDs lists the schema IDs with a built-in JSON schema.
+func JSONSchemaIDs() []string {
+	entries, _ := schemas.ReadDir("schemas")
+	ids := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		ids = append(ids, strings.TrimSuffix(entry.Name(), ".json"))
+	}
+	return ids
+}
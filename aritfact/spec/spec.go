@@ -0,0 +1,45 @@
+// Package spec defines the attribute schemas understood by this client in
+// addition to the core schemas defined by the collection spec.
+//
+// Attribute sets outside the core schemas are parsed by uor-client-go as flat
+// key, value pairs, so every schema defined here only uses scalar values.
+// Lists are encoded as comma separated strings.
+package spec
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/uor-framework/uor-client-go/nodes/descriptor"
+)
+
+// Decode unmarshals the attribute set stored under the schema ID in the
+// descriptor annotations into v. It returns false if the annotations
+// do not contain the schema.
+func Decode(annotations map[string]string, id string, v interface{}) (bool, error) {
+	attrs, err := descriptor.AnnotationsToAttributes(annotations)
+	if err != nil {
+		return false, err
+	}
+	raw, ok := attrs[id]
+	if !ok {
+		return false, nil
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return false, fmt.Errorf("schema %s: %w", id, err)
+	}
+	return true, nil
+}
+
+// SplitList splits a comma separated attribute value, dropping empty
+// elements.
+func SplitList(value string) []string {
+	var list []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
@@ -0,0 +1,314 @@
+package aritfact
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/log"
+	"github.com/containerd/containerd/reference"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// SignatureMediaType is the media type of cosign simple signing payloads.
+	SignatureMediaType = "application/vnd.dev.cosign.simplesigning.v1+json"
+	// SignatureAnnotation is the annotation of a payload
+	// layer with the base64 encoded signature of the payload.
+	SignatureAnnotation = "dev.cosignproject.cosign/signature"
+	// signatureType is the type of cosign simple signing payloads.
+	signatureType = "cosign container image signature"
+)
+
+// TrustType is the type of a trust requirement.
+type TrustType string
+
+const (
+	// TrustReject rejects every collection.
+	TrustReject TrustType = "reject"
+	// TrustAccept accepts every collection without verification.
+	TrustAccept TrustType = "accept"
+	// TrustSignedBy requires a signature by one of the keys.
+	TrustSignedBy TrustType = "signedBy"
+)
+
+// TrustRequirement is the requirement collections must satisfy to run.
+type TrustRequirement struct {
+	Type TrustType `json:"type"`
+	// Keys are the paths of the PEM encoded public keys trusted to sign
+	// the collections, relative to the trust policy file.
+	Keys []string `json:"keys,omitempty"`
+
+	keys []crypto.PublicKey
+}
+
+// TrustPolicy sets the requirements collections must satisfy to run, by
+// registry (e.g. localhost:5001) or repository (e.g. localhost:5001/team)
+// scope. The most specific scope of a reference applies, and references
+// without a scope use the default requirement. The policy fails closed:
+// the default requirement rejects every collection unless set.
+type TrustPolicy struct {
+	Default TrustRequirement            `json:"default"`
+	Scopes  map[string]TrustRequirement `json:"scopes,omitempty"`
+}
+
+// LoadTrustPolicy loads a trust policy file, formatted as JSON
+// or YAML, and the public keys of its requirements.
+func LoadTrustPolicy(path string) (TrustPolicy, error) {
+	var policy TrustPolicy
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return policy, fmt.Errorf("failed to read trust policy: %w", err)
+	}
+	if err := yaml.UnmarshalStrict(data, &policy); err != nil {
+		return policy, fmt.Errorf("invalid trust policy %s: %w", path, err)
+	}
+
+	dir := filepath.Dir(path)
+	if err := policy.Default.load(dir); err != nil {
+		return policy, fmt.Errorf("invalid trust policy %s: default: %w", path, err)
+	}
+	for scope, requirement := range policy.Scopes {
+		if err := requirement.load(dir); err != nil {
+			return policy, fmt.Errorf("invalid trust policy %s: scope %s: %w", path, scope, err)
+		}
+		policy.Scopes[scope] = requirement
+	}
+	return policy, nil
+}
+
+// load validates the requirement and loads its public keys.
+func (r *TrustRequirement) load(dir string) error {
+	switch r.Type {
+	case "", TrustReject, TrustAccept:
+		if len(r.Keys) > 0 {
+			return fmt.Errorf("keys are only supported by %s requirements", TrustSignedBy)
+		}
+		return nil
+	case TrustSignedBy:
+		if len(r.Keys) == 0 {
+			return fmt.Errorf("%s requires keys", TrustSignedBy)
+		}
+	default:
+		return fmt.Errorf("unsupported type %q: must be one of %s, %s, %s", r.Type, TrustReject, TrustAccept, TrustSignedBy)
+	}
+
+	for _, path := range r.Keys {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		key, err := loadPublicKey(path)
+		if err != nil {
+			return err
+		}
+		r.keys = append(r.keys, key)
+	}
+	return nil
+}
+
+// loadPublicKey loads a PEM encoded ECDSA, RSA or Ed25519 public key.
+func loadPublicKey(path string) (crypto.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("public key %s: no PEM encoded public key", path)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("public key %s: %w", path, err)
+	}
+	switch key.(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey, ed25519.PublicKey:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("public key %s: unsupported key type %T", path, key)
+	}
+}
+
+// Requirement returns the requirement of the reference
+// and its scope, which is empty for the default.
+func (p TrustPolicy) Requirement(ref string) (TrustRequirement, string, error) {
+	spec, err := reference.Parse(ref)
+	if err != nil {
+		return TrustRequirement{}, "", err
+	}
+	for scope := spec.Locator; scope != ""; {
+		if requirement, ok := p.Scopes[scope]; ok {
+			return requirement, scope, nil
+		}
+		i := strings.LastIndex(scope, "/")
+		if i < 0 {
+			break
+		}
+		scope = scope[:i]
+	}
+	return p.Default, "", nil
+}
+
+// SignatureReference returns the reference of the cosign
+// signature image of the target in the repository of ref.
+func SignatureReference(ref string, target digest.Digest) (string, error) {
+	spec, err := reference.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s:%s-%s.sig", spec.Locator, target.Algorithm(), target.Encoded()), nil
+}
+
+// simpleSigning is a cosign simple signing payload.
+type simpleSigning struct {
+	Critical struct {
+		Identity struct {
+			DockerReference string `json:"docker-reference"`
+		} `json:"identity"`
+		Image struct {
+			DockerManifestDigest digest.Digest `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+}
+
+// VerifyImage verifies the image satisfies the trust policy. Signatures
+// are read from the cosign signature image of the image target, tagged
+// as SignatureReference, which must be in the image store. Signatures
+// attached as OCI referrers or in Sigstore bundles are not read. Images
+// failing verification are rejected with errdefs.ErrFailedPrecondition.
+func VerifyImage(ctx context.Context, store images.Store, provider content.Provider, img images.Image, policy TrustPolicy) error {
+	requirement, scope, err := policy.Requirement(img.Name)
+	if err != nil {
+		return fmt.Errorf("image %s is not trusted: %v: %w", img.Name, err, errdefs.ErrFailedPrecondition)
+	}
+	if scope == "" {
+		scope = "default"
+	}
+
+	switch requirement.Type {
+	case TrustAccept:
+		log.G(ctx).Debugf("image %s accepted by trust policy scope %s", img.Name, scope)
+		return nil
+	case TrustSignedBy:
+		if err := verifySignatures(ctx, store, provider, img, requirement.keys); err != nil {
+			return fmt.Errorf("image %s is not trusted by scope %s: %v: %w", img.Name, scope, err, errdefs.ErrFailedPrecondition)
+		}
+		log.G(ctx).Debugf("image %s signature verified by trust policy scope %s", img.Name, scope)
+		return nil
+	default:
+		return fmt.Errorf("image %s is rejected by trust policy scope %s: %w", img.Name, scope, errdefs.ErrFailedPrecondition)
+	}
+}
+
+// verifySignatures verifies the cosign signature image of the image
+// holds a payload for the image target signed by one of the keys.
+func verifySignatures(ctx context.Context, store images.Store, provider content.Provider, img images.Image, keys []crypto.PublicKey) error {
+	sigRef, err := SignatureReference(img.Name, img.Target.Digest)
+	if err != nil {
+		return err
+	}
+	sigImg, err := store.Get(ctx, sigRef)
+	if err != nil {
+		return fmt.Errorf("failed to get signature image %s: %w", sigRef, err)
+	}
+	data, err := content.ReadBlob(ctx, provider, sigImg.Target)
+	if err != nil {
+		return fmt.Errorf("failed to read signature manifest: %w", err)
+	}
+	var manifest ocispec.Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return fmt.Errorf("invalid signature manifest: %w", err)
+	}
+
+	locator, _ := reference.Parse(img.Name)
+	var errs []string
+	for _, layer := range manifest.Layers {
+		if layer.MediaType != SignatureMediaType {
+			continue
+		}
+		if err := verifySignature(ctx, provider, layer, img.Target.Digest, locator.Locator, keys); err != nil {
+			errs = append(errs, fmt.Sprintf("signature %s: %v", layer.Digest, err))
+			continue
+		}
+		return nil
+	}
+	if len(errs) == 0 {
+		return fmt.Errorf("no signatures in signature image %s", sigRef)
+	}
+	return errors.New(strings.Join(errs, "; "))
+}
+
+// verifySignature verifies a signature payload layer signs the target.
+func verifySignature(ctx context.Context, provider content.Provider, layer ocispec.Descriptor, target digest.Digest, locator string, keys []crypto.PublicKey) error {
+	encoded, ok := layer.Annotations[SignatureAnnotation]
+	if !ok {
+		return errors.New("no signature annotation")
+	}
+	sig, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %w", err)
+	}
+	payload, err := content.ReadBlob(ctx, provider, layer)
+	if err != nil {
+		return fmt.Errorf("failed to read payload: %w", err)
+	}
+	if !verifyPayload(payload, sig, keys) {
+		return errors.New("not signed by a trusted key")
+	}
+
+	// The payload is only trusted once its signature is verified.
+	var s simpleSigning
+	if err := json.Unmarshal(payload, &s); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+	if s.Critical.Type != signatureType {
+		return fmt.Errorf("unsupported payload type %q", s.Critical.Type)
+	}
+	if s.Critical.Image.DockerManifestDigest != target {
+		return fmt.Errorf("payload signs %s, not %s", s.Critical.Image.DockerManifestDigest, target)
+	}
+	if s.Critical.Identity.DockerReference != locator {
+		return fmt.Errorf("payload signs repository %s, not %s", s.Critical.Identity.DockerReference, locator)
+	}
+	return nil
+}
+
+// verifyPayload returns true if the signature of the payload
+// is verified by one of the keys.
+func verifyPayload(payload, sig []byte, keys []crypto.PublicKey) bool {
+	hash := sha256.Sum256(payload)
+	for _, key := range keys {
+		switch k := key.(type) {
+		case *ecdsa.PublicKey:
+			if ecdsa.VerifyASN1(k, hash[:], sig) {
+				return true
+			}
+		case *rsa.PublicKey:
+			if rsa.VerifyPKCS1v15(k, crypto.SHA256, hash[:], sig) == nil {
+				return true
+			}
+		case ed25519.PublicKey:
+			if ed25519.Verify(k, payload, sig) {
+				return true
+			}
+		}
+	}
+	return false
+}
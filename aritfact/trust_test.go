@@ -0,0 +1,210 @@
+package aritfact
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// imageStore is an image store holding images in memory.
+// Only Get is implemented.
+type imageStore struct {
+	images.Store
+	images map[string]images.Image
+}
+
+func (s imageStore) Get(_ context.Context, name string) (images.Image, error) {
+	img, ok := s.images[name]
+	if !ok {
+		return images.Image{}, fmt.Errorf("image %s: %w", name, errdefs.ErrNotFound)
+	}
+	return img, nil
+}
+
+// signingKey is a generated key pair and its signing function.
+type signingKey struct {
+	public crypto.PublicKey
+	sign   func(t *testing.T, payload []byte) []byte
+}
+
+func ecdsaKey(t *testing.T) signingKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signingKey{public: &key.PublicKey, sign: func(t *testing.T, payload []byte) []byte {
+		hash := sha256.Sum256(payload)
+		sig, err := ecdsa.SignASN1(rand.Reader, key, hash[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sig
+	}}
+}
+
+func ed25519Key(t *testing.T) signingKey {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signingKey{public: public, sign: func(t *testing.T, payload []byte) []byte {
+		return ed25519.Sign(private, payload)
+	}}
+}
+
+// writePublicKey writes the PEM encoded public key to the file.
+func writePublicKey(t *testing.T, path string, key crypto.PublicKey) {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// addSignature stores the cosign signature image of the target, signing
+// the payload of the repository and digest with the key.
+func addSignature(t *testing.T, store memoryStore, is imageStore, ref string, target ocispec.Descriptor, repository string, signed digest.Digest, key signingKey) {
+	t.Helper()
+	var payload simpleSigning
+	payload.Critical.Identity.DockerReference = repository
+	payload.Critical.Image.DockerManifestDigest = signed
+	payload.Critical.Type = signatureType
+	layer := store.add(t, SignatureMediaType, payload)
+	layer.Annotations = map[string]string{
+		SignatureAnnotation: base64.StdEncoding.EncodeToString(key.sign(t, store[layer.Digest])),
+	}
+	config := store.add(t, "application/vnd.oci.image.config.v1+json", map[string]string{})
+	manifest := store.add(t, ocispec.MediaTypeImageManifest, ocispec.Manifest{
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config:    config,
+		Layers:    []ocispec.Descriptor{layer},
+	})
+	sigRef, err := SignatureReference(ref, target.Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	is.images[sigRef] = images.Image{Name: sigRef, Target: manifest}
+}
+
+func TestVerifyImage(t *testing.T) {
+	const (
+		ref        = "localhost:5001/team/app:latest"
+		repository = "localhost:5001/team/app"
+	)
+	ecdsaTrusted, ed25519Trusted, untrusted := ecdsaKey(t), ed25519Key(t), ecdsaKey(t)
+
+	dir := t.TempDir()
+	writePublicKey(t, filepath.Join(dir, "ecdsa.pub"), ecdsaTrusted.public)
+	writePublicKey(t, filepath.Join(dir, "ed25519.pub"), ed25519Trusted.public)
+	policyPath := filepath.Join(dir, "policy.yaml")
+	policyFile := `
+default:
+  type: reject
+scopes:
+  localhost:5001:
+    type: accept
+  localhost:5001/team:
+    type: signedBy
+    keys: [ecdsa.pub, ed25519.pub]
+`
+	if err := os.WriteFile(policyPath, []byte(policyFile), 0644); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := LoadTrustPolicy(policyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := ocispec.Descriptor{MediaType: ocispec.MediaTypeImageManifest, Digest: digest.FromString("manifest"), Size: 8}
+	tests := []struct {
+		name       string
+		ref        string
+		key        *signingKey
+		repository string
+		signed     digest.Digest
+		wantErr    bool
+	}{
+		{name: "ecdsa signature", ref: ref, key: &ecdsaTrusted, repository: repository, signed: target.Digest},
+		{name: "ed25519 signature", ref: ref, key: &ed25519Trusted, repository: repository, signed: target.Digest},
+		{name: "untrusted key", ref: ref, key: &untrusted, repository: repository, signed: target.Digest, wantErr: true},
+		{name: "other digest", ref: ref, key: &ecdsaTrusted, repository: repository, signed: digest.FromString("other"), wantErr: true},
+		{name: "other repository", ref: ref, key: &ed25519Trusted, repository: "localhost:5001/team/other", signed: target.Digest, wantErr: true},
+		{name: "no signature image", ref: ref, wantErr: true},
+		{name: "accepted scope", ref: "localhost:5001/other/app:latest"},
+		{name: "default rejected", ref: "example.com/app:latest", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, is := memoryStore{}, imageStore{images: map[string]images.Image{}}
+			if tt.key != nil {
+				addSignature(t, store, is, tt.ref, target, tt.repository, tt.signed, *tt.key)
+			}
+
+			err := VerifyImage(context.Background(), is, store, images.Image{Name: tt.ref, Target: target}, policy)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("VerifyImage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, errdefs.ErrFailedPrecondition) {
+				t.Errorf("VerifyImage() error = %v, want a failed precondition", err)
+			}
+		})
+	}
+}
+
+func TestLoadTrustPolicyKeys(t *testing.T) {
+	dir := t.TempDir()
+	writePublicKey(t, filepath.Join(dir, "ecdsa.pub"), ecdsaKey(t).public)
+	writePublicKey(t, filepath.Join(dir, "ed25519.pub"), ed25519Key(t).public)
+	if err := os.WriteFile(filepath.Join(dir, "invalid.pub"), []byte("not a key"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		policy  string
+		wantErr bool
+	}{
+		{name: "ecdsa and ed25519 keys", policy: "default: {type: signedBy, keys: [ecdsa.pub, ed25519.pub]}"},
+		{name: "invalid key", policy: "default: {type: signedBy, keys: [invalid.pub]}", wantErr: true},
+		{name: "missing key", policy: "default: {type: signedBy, keys: [missing.pub]}", wantErr: true},
+		{name: "no keys", policy: "default: {type: signedBy}", wantErr: true},
+		{name: "keys without signature", policy: "default: {type: accept, keys: [ecdsa.pub]}", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "policy.yaml")
+			if err := os.WriteFile(path, []byte(tt.policy), 0644); err != nil {
+				t.Fatal(err)
+			}
+			policy, err := LoadTrustPolicy(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadTrustPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && len(policy.Default.keys) != 2 {
+				t.Errorf("loaded %d keys, want 2", len(policy.Default.keys))
+			}
+		})
+	}
+}
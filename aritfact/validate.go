@@ -0,0 +1,231 @@
+package aritfact
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/log"
+	"github.com/containerd/containerd/platforms"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	uorspec "github.com/uor-framework/collection-spec/specs-go/v1alpha1"
+	"github.com/uor-framework/uor-client-go/attributes"
+	"github.com/uor-framework/uor-client-go/nodes/descriptor"
+	"github.com/uor-framework/uor-client-go/schema"
+
+	"github.com/jpower432/runc-attribute-wrapper/aritfact/spec"
+)
+
+// SchemaPolicy sets how attribute sets failing
+// schema validation are handled before unpacking.
+type SchemaPolicy string
+
+const (
+	// SchemaPolicyIgnore skips schema validation.
+	SchemaPolicyIgnore SchemaPolicy = "ignore"
+	// SchemaPolicyWarn logs the invalid attribute sets.
+	SchemaPolicyWarn SchemaPolicy = "warn"
+	// SchemaPolicyFail fails the unpack on invalid attribute sets.
+	SchemaPolicyFail SchemaPolicy = "fail"
+)
+
+// ParseSchemaPolicy parses a schema policy.
+func ParseSchemaPolicy(policy string) (SchemaPolicy, error) {
+	switch p := SchemaPolicy(policy); p {
+	case SchemaPolicyIgnore, SchemaPolicyWarn, SchemaPolicyFail:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unsupported schema policy %q: must be one of %s, %s, %s", policy, SchemaPolicyIgnore, SchemaPolicyWarn, SchemaPolicyFail)
+	}
+}
+
+// WithSchemaPolicy validates the attribute sets of the collection against
+// their JSON schemas before unpacking. Schemas are loaded from the built-in
+// schemas, the schema collections and the schema blobs of the collection, in
+// this order. Schemas loaded first cannot be replaced.
+func WithSchemaPolicy(policy SchemaPolicy, schemaCollections ...string) ImageOpt {
+	return func(i *image) {
+		i.schemaPolicy = policy
+		i.schemaCollections = schemaCollections
+	}
+}
+
+// validateAttributes validates the attribute sets of the manifest and
+// its blobs following the schema policy of the image.
+func (i *image) validateAttributes(ctx context.Context, manifest ocispec.Manifest) error {
+	if i.schemaPolicy == "" || i.schemaPolicy == SchemaPolicyIgnore {
+		return nil
+	}
+
+	schemas, err := loadSchemas(ctx, i.client.ImageService(), i.ContentStore(), i.schemaCollections, manifest)
+	if err != nil {
+		return err
+	}
+	return applySchemaPolicy(ctx, i.Name(), i.schemaPolicy, schemas, manifest)
+}
+
+// applySchemaPolicy validates the attribute sets of the manifest
+// and its blobs against the schemas following the schema policy.
+func applySchemaPolicy(ctx context.Context, name string, policy SchemaPolicy, schemas map[string]schema.Schema, manifest ocispec.Manifest) error {
+	if policy == "" || policy == SchemaPolicyIgnore {
+		return nil
+	}
+
+	var errs []string
+	if err := validateNode(schemas, "manifest", manifest.Annotations); err != nil {
+		errs = append(errs, err.Error())
+	}
+	for _, layer := range manifest.Layers {
+		if err := validateNode(schemas, fmt.Sprintf("blob %s", layer.Digest), layer.Annotations); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+
+	if policy == SchemaPolicyWarn {
+		for _, e := range errs {
+			log.G(ctx).Warnf("image %s: %s", name, e)
+		}
+		return nil
+	}
+	return fmt.Errorf("image %s failed schema validation: %s: %w", name, strings.Join(errs, "; "), errdefs.ErrFailedPrecondition)
+}
+
+// validateNode validates the attribute sets in the annotations
+// against the schemas. Attribute sets without a schema are valid.
+func validateNode(schemas map[string]schema.Schema, name string, annotations map[string]string) error {
+	sets, err := descriptor.AnnotationsToAttributes(annotations)
+	if err != nil {
+		return fmt.Errorf("%s: invalid attributes: %w", name, err)
+	}
+
+	ids := make([]string, 0, len(sets))
+	for id := range sets {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var errs []string
+	for _, id := range ids {
+		s, ok := schemas[id]
+		if !ok {
+			continue
+		}
+		valid, err := s.Validate(rawAttributeSet{raw: sets[id]})
+		if !valid || err != nil {
+			errs = append(errs, fmt.Sprintf("schema %s: %v", id, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s: %s", name, strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// rawAttributeSet is an attribute set validated as its raw JSON,
+// so nested values of the core schemas are validated too.
+type rawAttributeSet struct {
+	attributes.Attributes
+	raw json.RawMessage
+}
+
+func (s rawAttributeSet) MarshalJSON() ([]byte, error) {
+	return s.raw, nil
+}
+
+// loadSchemas loads the JSON schemas by schema ID from the built-in
+// schemas, the schema collections and the manifest, in this order.
+func loadSchemas(ctx context.Context, store images.Store, provider content.Provider, collections []string, manifest ocispec.Manifest) (map[string]schema.Schema, error) {
+	schemas := map[string]schema.Schema{}
+	for _, id := range spec.JSONSchemaIDs() {
+		data, _ := spec.JSONSchema(id)
+		if err := addSchema(schemas, id, data); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, ref := range collections {
+		img, err := store.Get(ctx, ref)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get schema collection %s: %w", ref, err)
+		}
+		m, err := images.Manifest(ctx, provider, img.Target, platforms.All)
+		if err != nil {
+			return nil, fmt.Errorf("schema collection %s: %w", ref, err)
+		}
+		if err := loadSchemaBlobs(ctx, provider, m, schemas); err != nil {
+			return nil, fmt.Errorf("schema collection %s: %w", ref, err)
+		}
+	}
+	if err := loadSchemaBlobs(ctx, provider, manifest, schemas); err != nil {
+		return nil, err
+	}
+	return schemas, nil
+}
+
+// loadSchemaBlobs loads the schema blobs of the manifest, identified by
+// their core-schema attributes or the core-schema attributes of the manifest.
+// Loaded schemas are not replaced.
+func loadSchemaBlobs(ctx context.Context, provider content.Provider, manifest ocispec.Manifest, schemas map[string]schema.Schema) error {
+	manifestID, err := schemaID(manifest.Annotations)
+	if err != nil {
+		return err
+	}
+	for _, layer := range manifest.Layers {
+		if layer.MediaType != uorspec.MediaTypeSchemaDescriptor {
+			continue
+		}
+		id, err := schemaID(layer.Annotations)
+		if err != nil {
+			return fmt.Errorf("blob %s: %w", layer.Digest, err)
+		}
+		if id == "" {
+			id = manifestID
+		}
+		if id == "" {
+			return fmt.Errorf("schema blob %s does not set a schema id", layer.Digest)
+		}
+		if _, exists := schemas[id]; exists {
+			log.G(ctx).Debugf("schema %s already loaded, skipping blob %s", id, layer.Digest)
+			continue
+		}
+		data, err := content.ReadBlob(ctx, provider, layer)
+		if err != nil {
+			return fmt.Errorf("failed to read schema blob %s: %w", layer.Digest, err)
+		}
+		if err := addSchema(schemas, id, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// schemaID returns the schema ID set by the core-schema attributes.
+func schemaID(annotations map[string]string) (string, error) {
+	var attrs uorspec.SchemaAttributes
+	if _, err := spec.Decode(annotations, descriptor.TypeSchema, &attrs); err != nil {
+		return "", err
+	}
+	return attrs.ID, nil
+}
+
+// addSchema compiles the JSON schema of the schema ID.
+func addSchema(schemas map[string]schema.Schema, id string, data []byte) error {
+	loader, err := schema.FromBytes(data)
+	if err != nil {
+		return fmt.Errorf("schema %s: %w", id, err)
+	}
+	s, err := schema.New(loader)
+	if err != nil {
+		return fmt.Errorf("schema %s: %w", id, err)
+	}
+	schemas[id] = s
+	return nil
+}
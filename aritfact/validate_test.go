@@ -0,0 +1,259 @@
+package aritfact
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/log"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
+	uorspec "github.com/uor-framework/collection-spec/specs-go/v1alpha1"
+	"github.com/uor-framework/uor-client-go/nodes/descriptor"
+	"github.com/uor-framework/uor-client-go/schema"
+)
+
+// platformSchema accepts any platform attributes.
+const platformSchema = `{"type": "object"}`
+
+// exampleSchema requires an integer size.
+const exampleSchema = `{
+	"type": "object",
+	"properties": {"size": {"type": "integer"}},
+	"required": ["size"]
+}`
+
+// schemaBlob stores the JSON schema and returns its descriptor,
+// setting the schema ID in the core-schema attributes if not empty.
+func schemaBlob(t *testing.T, store memoryStore, id, data string) ocispec.Descriptor {
+	t.Helper()
+	desc := store.add(t, uorspec.MediaTypeSchemaDescriptor, json.RawMessage(data))
+	if id != "" {
+		desc.Annotations = attributeAnnotations(t, map[string]interface{}{
+			descriptor.TypeSchema: uorspec.SchemaAttributes{ID: id},
+		})
+	}
+	return desc
+}
+
+// builtinSchemas returns the compiled built-in schemas.
+func builtinSchemas(t *testing.T) map[string]schema.Schema {
+	t.Helper()
+	schemas, err := loadSchemas(context.Background(), imageStore{}, memoryStore{}, nil, ocispec.Manifest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schemas
+}
+
+func TestValidateNode(t *testing.T) {
+	schemas := builtinSchemas(t)
+	if err := addSchema(schemas, "example", []byte(exampleSchema)); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name        string
+		sets        map[string]interface{}
+		annotations map[string]string
+		wantErr     string
+	}{
+		{name: "no attributes"},
+		{
+			name: "valid",
+			sets: map[string]interface{}{
+				"rcl-platform": map[string]string{"os": "linux", "architecture": "amd64"},
+				"example":      map[string]int{"size": 3},
+			},
+		},
+		{name: "without schema", sets: map[string]interface{}{"unknown": map[string]bool{"debug": true}}},
+		{
+			name:    "missing attribute",
+			sets:    map[string]interface{}{"rcl-platform": map[string]string{"os": "linux"}},
+			wantErr: "schema rcl-platform",
+		},
+		{
+			name:    "unknown attribute",
+			sets:    map[string]interface{}{"rcl-runtime": map[string]string{"runtime": "runc"}},
+			wantErr: "schema rcl-runtime",
+		},
+		{
+			name:    "invalid value",
+			sets:    map[string]interface{}{"example": map[string]string{"size": "3"}},
+			wantErr: "schema example",
+		},
+		{name: "malformed attributes", annotations: map[string]string{"uor.attributes": "{"}, wantErr: "invalid attributes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			annotations := tt.annotations
+			if tt.sets != nil {
+				annotations = attributeAnnotations(t, tt.sets)
+			}
+			err := validateNode(schemas, "blob", annotations)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("validateNode() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateNode() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadSchemaBlobs(t *testing.T) {
+	store := memoryStore{}
+	tests := []struct {
+		name       string
+		manifestID string
+		layers     []ocispec.Descriptor
+		want       []string
+		wantErr    bool
+	}{
+		{name: "no schemas"},
+		{name: "blob schema id", layers: []ocispec.Descriptor{schemaBlob(t, store, "example", exampleSchema)}, want: []string{"example"}},
+		{name: "manifest schema id", manifestID: "example", layers: []ocispec.Descriptor{schemaBlob(t, store, "", exampleSchema)}, want: []string{"example"}},
+		{
+			name:       "blob schema id over manifest schema id",
+			manifestID: "example",
+			layers:     []ocispec.Descriptor{schemaBlob(t, store, "other", platformSchema)},
+			want:       []string{"other"},
+		},
+		{name: "other blobs", layers: []ocispec.Descriptor{componentBlob(t, "tool", "tool", "tool")}},
+		{name: "missing schema id", layers: []ocispec.Descriptor{schemaBlob(t, store, "", exampleSchema)}, wantErr: true},
+		{name: "invalid schema", layers: []ocispec.Descriptor{schemaBlob(t, store, "example", `{"type": 1}`)}, wantErr: true},
+		{
+			name:    "missing blob",
+			layers:  []ocispec.Descriptor{{MediaType: uorspec.MediaTypeSchemaDescriptor, Annotations: schemaBlob(t, store, "example", exampleSchema).Annotations}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manifest := ocispec.Manifest{Layers: tt.layers}
+			if tt.manifestID != "" {
+				manifest.Annotations = attributeAnnotations(t, map[string]interface{}{
+					descriptor.TypeSchema: uorspec.SchemaAttributes{ID: tt.manifestID},
+				})
+			}
+			schemas := map[string]schema.Schema{}
+			err := loadSchemaBlobs(context.Background(), store, manifest, schemas)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadSchemaBlobs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(schemas) != len(tt.want) {
+				t.Errorf("loaded %d schemas, want %v", len(schemas), tt.want)
+			}
+			for _, id := range tt.want {
+				if _, ok := schemas[id]; !ok {
+					t.Errorf("schema %s not loaded", id)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadSchemasPrecedence(t *testing.T) {
+	store := memoryStore{}
+	is := imageStore{images: map[string]images.Image{}}
+	addCollection := func(ref string, layers ...ocispec.Descriptor) {
+		config := store.add(t, "application/vnd.uor.config.v1+json", map[string]string{})
+		target := store.add(t, ocispec.MediaTypeImageManifest, ocispec.Manifest{
+			MediaType: ocispec.MediaTypeImageManifest,
+			Config:    config,
+			Layers:    layers,
+		})
+		is.images[ref] = images.Image{Name: ref, Target: target}
+	}
+	// The schema collections try to replace the built-in rcl-platform schema.
+	addCollection("localhost:5001/schemas:v1", schemaBlob(t, store, "rcl-platform", platformSchema), schemaBlob(t, store, "example", exampleSchema))
+	addCollection("localhost:5001/schemas:v2", schemaBlob(t, store, "example", platformSchema))
+	manifest := ocispec.Manifest{Layers: []ocispec.Descriptor{schemaBlob(t, store, "example", platformSchema)}}
+
+	schemas, err := loadSchemas(context.Background(), is, store, []string{"localhost:5001/schemas:v1", "localhost:5001/schemas:v2"}, manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		sets    map[string]interface{}
+		wantErr bool
+	}{
+		{name: "built-in schema kept", sets: map[string]interface{}{"rcl-platform": map[string]string{"os": "linux"}}, wantErr: true},
+		{name: "first collection schema kept", sets: map[string]interface{}{"example": map[string]string{"size": "3"}}, wantErr: true},
+		{name: "first collection schema", sets: map[string]interface{}{"example": map[string]int{"size": 3}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateNode(schemas, "blob", attributeAnnotations(t, tt.sets))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateNode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := loadSchemas(context.Background(), is, store, []string{"localhost:5001/missing:v1"}, manifest); !errors.Is(err, errdefs.ErrNotFound) {
+		t.Errorf("loadSchemas() error = %v, want not found", err)
+	}
+}
+
+func TestApplySchemaPolicy(t *testing.T) {
+	schemas := builtinSchemas(t)
+	valid := ocispec.Manifest{Layers: []ocispec.Descriptor{{
+		MediaType:   "application/octet-stream",
+		Annotations: attributeAnnotations(t, map[string]interface{}{"rcl-platform": map[string]string{"os": "linux", "architecture": "amd64"}}),
+	}}}
+	invalid := ocispec.Manifest{
+		Annotations: attributeAnnotations(t, map[string]interface{}{"rcl-runtime": map[string]int{"runtimeClass": 1}}),
+	}
+	tests := []struct {
+		name     string
+		policy   SchemaPolicy
+		manifest ocispec.Manifest
+		wantErr  bool
+		wantWarn bool
+	}{
+		{name: "no policy", manifest: invalid},
+		{name: "ignore valid", policy: SchemaPolicyIgnore, manifest: valid},
+		{name: "ignore invalid", policy: SchemaPolicyIgnore, manifest: invalid},
+		{name: "warn valid", policy: SchemaPolicyWarn, manifest: valid},
+		{name: "warn invalid", policy: SchemaPolicyWarn, manifest: invalid, wantWarn: true},
+		{name: "fail valid", policy: SchemaPolicyFail, manifest: valid},
+		{name: "fail invalid", policy: SchemaPolicyFail, manifest: invalid, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			logger := logrus.New()
+			logger.SetOutput(&logs)
+			ctx := log.WithLogger(context.Background(), logrus.NewEntry(logger))
+
+			err := applySchemaPolicy(ctx, "localhost:5001/app:v1", tt.policy, schemas, tt.manifest)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applySchemaPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, errdefs.ErrFailedPrecondition) {
+				t.Errorf("applySchemaPolicy() error = %v, want failed precondition", err)
+			}
+			if warned := strings.Contains(logs.String(), "schema rcl-runtime"); warned != tt.wantWarn {
+				t.Errorf("warned = %v, want %v: %s", warned, tt.wantWarn, logs.String())
+			}
+		})
+	}
+
+	// The ignore policy does not load any schema.
+	i := &image{schemaPolicy: SchemaPolicyIgnore}
+	if err := i.validateAttributes(context.Background(), invalid); err != nil {
+		t.Errorf("validateAttributes() error = %v", err)
+	}
+}
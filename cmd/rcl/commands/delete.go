@@ -48,7 +48,7 @@ func (o *DeleteOptions) Validate() error {
 }
 
 func (o *DeleteOptions) Run(ctx context.Context) error {
-	ctx = namespaces.WithNamespace(ctx, "default")
+	ctx = namespaces.WithNamespace(ctx, o.Namespace)
 	var exitErr error
 	client, ctx, cancel, err := NewClient(ctx, o.Address)
 	if err != nil {
@@ -72,7 +72,7 @@ func deleteContainer(ctx context.Context, client *containerd.Client, id string,
 	}
 	task, err := container.Task(ctx, cio.Load)
 	if err != nil {
-		return container.Delete(ctx, opts...)
+		return removeContainer(ctx, container, opts...)
 	}
 	status, err := task.Status(ctx)
 	if err != nil {
@@ -82,11 +82,24 @@ func deleteContainer(ctx context.Context, client *containerd.Client, id string,
 		if _, err := task.Delete(ctx); err != nil {
 			return err
 		}
-		return container.Delete(ctx, opts...)
+		return removeContainer(ctx, container, opts...)
 	}
 	return fmt.Errorf("cannot delete a non stopped container: %v", status)
 }
 
+// removeContainer deletes the container and releases
+// its network resources.
+func removeContainer(ctx context.Context, container containerd.Container, opts ...containerd.DeleteOpts) error {
+	labels, err := container.Labels(ctx)
+	if err != nil {
+		return err
+	}
+	if err := container.Delete(ctx, opts...); err != nil {
+		return err
+	}
+	return teardownNetwork(ctx, container.ID(), labels)
+}
+
 // NewClient returns a new containerd client
 func NewClient(ctx context.Context, address string, opts ...containerd.ClientOpt) (*containerd.Client, context.Context, context.CancelFunc, error) {
 	client, err := containerd.New(address, opts...)
@@ -0,0 +1,194 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images/archive"
+	"github.com/containerd/containerd/log"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/containerd/containerd/platforms"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/spf13/cobra"
+
+	"github.com/jpower432/runc-attribute-wrapper/aritfact"
+)
+
+// ExportOptions configures options for exporting a snapshot
+// as an OCI image or a collection.
+type ExportOptions struct {
+	*RootOptions
+	Name string
+	// Snapshot is the key of the exported snapshot, and
+	// Container the container whose snapshot is exported.
+	Snapshot    string
+	Container   string
+	Snapshotter string
+	Format      string
+	Platform    string
+	// Output is the OCI image layout tarball the
+	// exported image is also written to.
+	Output   string
+	format   aritfact.ExportFormat
+	platform ocispec.Platform
+}
+
+// NewExportCmd creates a new cobra.Command for the export subcommand.
+func NewExportCmd(options *RootOptions) *cobra.Command {
+	o := ExportOptions{
+		RootOptions: options,
+	}
+
+	cmd := &cobra.Command{
+		Use:           "export (--snapshot KEY | --container ID) IMG",
+		Short:         "Export a snapshot as an OCI image or a collection",
+		SilenceErrors: false,
+		SilenceUsage:  false,
+		Args:          cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			cobra.CheckErr(o.Complete(args))
+			cobra.CheckErr(o.Validate())
+			cobra.CheckErr(o.Run(cmd.Context()))
+		},
+	}
+
+	cmd.Flags().StringVar(&o.Snapshot, "snapshot", o.Snapshot, "key of the snapshot to export (e.g. the chain ID of an unpacked collection)")
+	cmd.Flags().StringVar(&o.Container, "container", o.Container, "export the snapshot of the container")
+	cmd.Flags().StringVar(&o.Snapshotter, "snapshotter", o.Snapshotter, "snapshotter of the snapshot (defaults to the snapshotter of the namespace)")
+	cmd.Flags().StringVar(&o.Format, "format", string(aritfact.ExportFormatImage), "export format (image or collection)")
+	cmd.Flags().StringVar(&o.Platform, "platform", o.Platform, "platform of the exported image (e.g. linux/arm64)")
+	cmd.Flags().StringVarP(&o.Output, "output", "o", o.Output, "also write the exported image to an OCI image layout tarball")
+
+	return cmd
+}
+
+func (o *ExportOptions) Complete(args []string) error {
+	o.Name = args[0]
+	return nil
+}
+
+func (o *ExportOptions) Validate() error {
+	if (o.Snapshot == "") == (o.Container == "") {
+		return errors.New("exactly one of --snapshot or --container must be set")
+	}
+	format, err := aritfact.ParseExportFormat(o.Format)
+	if err != nil {
+		return err
+	}
+	o.format = format
+	o.platform = platforms.DefaultSpec()
+	if o.Platform != "" {
+		if o.platform, err = platforms.Parse(o.Platform); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *ExportOptions) Run(ctx context.Context) error {
+	ctx = namespaces.WithNamespace(ctx, o.Namespace)
+	client, ctx, cancel, err := NewClient(ctx, o.Address)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	created, err := sourceDateEpoch()
+	if err != nil {
+		return err
+	}
+	key := o.Snapshot
+	exportOpts := []aritfact.ExportOpt{
+		aritfact.WithExportSnapshotter(o.Snapshotter),
+		aritfact.WithExportFormat(o.format),
+		aritfact.WithExportPlatform(o.platform),
+		aritfact.WithExportCreated(created),
+	}
+	if o.Container != "" {
+		var opts []aritfact.ExportOpt
+		key, opts, err = containerExportOpts(ctx, client, o.Container, o.platform)
+		if err != nil {
+			return err
+		}
+		exportOpts = append(exportOpts, opts...)
+	}
+
+	img, err := aritfact.Export(ctx, client, o.Name, key, exportOpts...)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(o.Out, "%s\t%s\n", img.Name, img.Target.Digest)
+
+	if o.Output == "" {
+		return nil
+	}
+	f, err := os.Create(o.Output)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := client.Export(ctx, f, archive.WithImage(client.ImageService(), img.Name)); err != nil {
+		return fmt.Errorf("failed to write %s: %w", o.Output, err)
+	}
+	return f.Close()
+}
+
+// containerExportOpts returns the snapshot key of the container and the
+// options exporting it with its snapshotter and the runtime configuration
+// of its image. The snapshot is mounted again to be exported, so containers
+// with a task which is not stopped are refused.
+func containerExportOpts(ctx context.Context, client *containerd.Client, id string, platform ocispec.Platform) (string, []aritfact.ExportOpt, error) {
+	container, err := client.LoadContainer(ctx, id)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := checkStopped(ctx, container); err != nil {
+		return "", nil, err
+	}
+	info, err := container.Info(ctx, containerd.WithoutRefreshedMetadata)
+	if err != nil {
+		return "", nil, err
+	}
+	if info.SnapshotKey == "" {
+		return "", nil, fmt.Errorf("container %s has no snapshot", id)
+	}
+
+	opts := []aritfact.ExportOpt{aritfact.WithExportSnapshotter(info.Snapshotter)}
+	if info.Image == "" {
+		return info.SnapshotKey, opts, nil
+	}
+	img, err := client.ImageService().Get(ctx, info.Image)
+	if err != nil {
+		log.G(ctx).WithError(err).Warnf("exporting container %s without the runtime configuration of image %s", id, info.Image)
+		return info.SnapshotKey, opts, nil
+	}
+	config, err := aritfact.ConfigFromAttributes(ctx, client.ContentStore(), img.Target, platforms.Only(platform))
+	if err != nil {
+		return "", nil, err
+	}
+	return info.SnapshotKey, append(opts, aritfact.WithExportConfig(config)), nil
+}
+
+// checkStopped returns an error if the container has a task which is not
+// stopped, since its snapshot may be modified while it is exported.
+func checkStopped(ctx context.Context, container containerd.Container) error {
+	task, err := container.Task(ctx, nil)
+	if errdefs.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load task of container %s: %w", container.ID(), err)
+	}
+	status, err := task.Status(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get task status of container %s: %w", container.ID(), err)
+	}
+	if status.Status != containerd.Stopped {
+		return fmt.Errorf("container %s task is %s: stop it before exporting: %w", container.ID(), status.Status, errdefs.ErrFailedPrecondition)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/cio"
+	"github.com/containerd/containerd/errdefs"
+)
+
+// taskContainer is a container with a task in the status, or
+// without a task if the status is empty. Only ID and Task are implemented.
+type taskContainer struct {
+	containerd.Container
+	status containerd.ProcessStatus
+}
+
+func (c taskContainer) ID() string {
+	return "test"
+}
+
+func (c taskContainer) Task(context.Context, cio.Attach) (containerd.Task, error) {
+	if c.status == "" {
+		return nil, fmt.Errorf("no running task: %w", errdefs.ErrNotFound)
+	}
+	return fakeTask{status: c.status}, nil
+}
+
+// fakeTask is a task in the status. Only Status is implemented.
+type fakeTask struct {
+	containerd.Task
+	status containerd.ProcessStatus
+}
+
+func (t fakeTask) Status(context.Context) (containerd.Status, error) {
+	return containerd.Status{Status: t.status}, nil
+}
+
+func TestCheckStopped(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  containerd.ProcessStatus
+		wantErr bool
+	}{
+		{name: "no task"},
+		{name: "stopped", status: containerd.Stopped},
+		{name: "running", status: containerd.Running, wantErr: true},
+		{name: "paused", status: containerd.Paused, wantErr: true},
+		{name: "created", status: containerd.Created, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkStopped(context.Background(), taskContainer{status: tt.status})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkStopped() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, errdefs.ErrFailedPrecondition) {
+				t.Errorf("checkStopped() error = %v, want a failed precondition", err)
+			}
+		})
+	}
+}
@@ -3,17 +3,21 @@ package commands
 import (
 	"context"
 	"crypto/tls"
+	"fmt"
 	"net/http/httptrace"
 	"os"
 
 	"github.com/containerd/containerd"
 	"github.com/containerd/containerd/cmd/ctr/commands"
 	"github.com/containerd/containerd/cmd/ctr/commands/content"
+	"github.com/containerd/containerd/errdefs"
 	"github.com/containerd/containerd/images"
 	"github.com/containerd/containerd/remotes"
 	"github.com/containerd/containerd/remotes/docker"
 	"github.com/containerd/containerd/remotes/docker/config"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/jpower432/runc-attribute-wrapper/aritfact"
 )
 
 // GetResolver prepares the resolver from the environment and options
@@ -51,6 +55,9 @@ func NewFetchConfig(ctx context.Context, runOpts RunOptions) (*content.FetchConf
 	if !runOpts.Debug {
 		config.ProgressOutput = os.Stdout
 	}
+	if runOpts.Platform != "" {
+		config.Platforms = []string{runOpts.Platform}
+	}
 
 	return config, nil
 }
@@ -109,4 +116,22 @@ func Fetch(ctx context.Context, client *containerd.Client, ref string, config *c
 
 	<-progress
 	return img, nil
-}
\ No newline at end of file
+}
+
+// fetchSignature fetches the cosign signature image of the image with
+// the fetch function when the trust policy requires a signature of the
+// image. Rejected images are reported by the trust policy verification.
+func fetchSignature(ctx context.Context, fetch func(ctx context.Context, ref string) error, img images.Image, policy aritfact.TrustPolicy) error {
+	requirement, _, err := policy.Requirement(img.Name)
+	if err != nil || requirement.Type != aritfact.TrustSignedBy {
+		return nil
+	}
+	sigRef, err := aritfact.SignatureReference(img.Name, img.Target.Digest)
+	if err != nil {
+		return fmt.Errorf("image %s is not trusted: failed to resolve signature reference: %v: %w", img.Name, err, errdefs.ErrFailedPrecondition)
+	}
+	if err := fetch(ctx, sigRef); err != nil {
+		return fmt.Errorf("failed to fetch signature %s of image %s: %w", sigRef, img.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/containerd/containerd/images"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/jpower432/runc-attribute-wrapper/aritfact"
+)
+
+func TestFetchSignature(t *testing.T) {
+	target := ocispec.Descriptor{MediaType: ocispec.MediaTypeImageManifest, Digest: digest.FromString("manifest")}
+	signed := aritfact.TrustPolicy{
+		Default: aritfact.TrustRequirement{Type: aritfact.TrustReject},
+		Scopes: map[string]aritfact.TrustRequirement{
+			"localhost:5001/signed":   {Type: aritfact.TrustSignedBy},
+			"localhost:5001/accepted": {Type: aritfact.TrustAccept},
+		},
+	}
+	fetchErr := errors.New("connection refused")
+	tests := []struct {
+		name      string
+		ref       string
+		fetchErr  error
+		wantFetch bool
+		wantErr   error
+	}{
+		{name: "signed", ref: "localhost:5001/signed/app:v1", wantFetch: true},
+		{name: "signature fetch failure", ref: "localhost:5001/signed/app:v1", fetchErr: fetchErr, wantFetch: true, wantErr: fetchErr},
+		{name: "accepted", ref: "localhost:5001/accepted/app:v1", fetchErr: fetchErr},
+		{name: "rejected", ref: "localhost:5001/other/app:v1", fetchErr: fetchErr},
+		{name: "invalid reference", ref: "app", fetchErr: fetchErr},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fetched string
+			fetch := func(_ context.Context, ref string) error {
+				fetched = ref
+				return tt.fetchErr
+			}
+			err := fetchSignature(context.Background(), fetch, images.Image{Name: tt.ref, Target: target}, signed)
+			if !errors.Is(err, tt.wantErr) || (err == nil) != (tt.wantErr == nil) {
+				t.Errorf("fetchSignature() error = %v, want %v", err, tt.wantErr)
+			}
+			if !tt.wantFetch {
+				if fetched != "" {
+					t.Errorf("fetched %s, want no fetch", fetched)
+				}
+				return
+			}
+			want, err := aritfact.SignatureReference(tt.ref, target.Digest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fetched != want {
+				t.Errorf("fetched %q, want %q", fetched, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,277 @@
+package commands
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/archive/compression"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/images/archive"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/containerd/containerd/platforms"
+	"github.com/containerd/containerd/reference"
+	"github.com/containerd/containerd/reference/docker"
+	"github.com/spf13/cobra"
+)
+
+// Source types of imported collections.
+const (
+	// sourceOCILayout is an OCI image layout directory.
+	sourceOCILayout = "oci-layout"
+	// sourceOCIArchive is an OCI image layout tarball,
+	// optionally compressed with gzip or zstd.
+	sourceOCIArchive = "oci-archive"
+)
+
+// errNoImageNames is returned when no
+// imported collection is named.
+var errNoImageNames = errors.New("no image names")
+
+// ImportOptions configures options for importing collections
+// from an OCI image layout or tarball.
+type ImportOptions struct {
+	*RootOptions
+	Source   string
+	Name     string
+	BaseName string
+	Platform string
+}
+
+// NewImportCmd creates a new cobra.Command for the import subcommand.
+func NewImportCmd(options *RootOptions) *cobra.Command {
+	o := ImportOptions{
+		RootOptions: options,
+	}
+
+	cmd := &cobra.Command{
+		Use:           "import [oci-layout:|oci-archive:]PATH",
+		Short:         "Import collections from an OCI image layout directory or tarball",
+		SilenceErrors: false,
+		SilenceUsage:  false,
+		Args:          cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			cobra.CheckErr(o.Complete(args))
+			cobra.CheckErr(o.Validate())
+			cobra.CheckErr(o.Run(cmd.Context()))
+		},
+	}
+
+	cmd.Flags().StringVar(&o.Name, "name", o.Name, "image name of the index of the layout, in addition to the image names of its manifests")
+	cmd.Flags().StringVar(&o.BaseName, "base-name", o.BaseName, "base image name of the manifests annotated with a tag only (e.g. localhost:5001/test names the tag latest localhost:5001/test:latest)")
+	cmd.Flags().StringVar(&o.Platform, "platform", o.Platform, "import content for a specific platform (e.g. linux/arm64)")
+
+	return cmd
+}
+
+func (o *ImportOptions) Complete(args []string) error {
+	o.Source = args[0]
+	return nil
+}
+
+func (o *ImportOptions) Validate() error {
+	if o.Platform != "" {
+		if _, err := platforms.Parse(o.Platform); err != nil {
+			return err
+		}
+	}
+	if o.BaseName != "" {
+		if err := validateBaseName(o.BaseName); err != nil {
+			return err
+		}
+	}
+	_, _, err := parseImportSource(o.Source)
+	return err
+}
+
+// validateBaseName checks that the base name
+// is an image name without a tag or digest.
+func validateBaseName(baseName string) error {
+	ref, err := docker.Parse(baseName)
+	if err != nil {
+		return fmt.Errorf("invalid base name %s: %w", baseName, err)
+	}
+	if _, ok := ref.(docker.Named); !ok {
+		return fmt.Errorf("invalid base name %s: must be an image name", baseName)
+	}
+	_, tagged := ref.(docker.Tagged)
+	_, digested := ref.(docker.Digested)
+	if tagged || digested {
+		return fmt.Errorf("invalid base name %s: must not have a tag or digest", baseName)
+	}
+	return nil
+}
+
+func (o *ImportOptions) Run(ctx context.Context) error {
+	ctx = namespaces.WithNamespace(ctx, o.Namespace)
+	client, ctx, cancel, err := NewClient(ctx, o.Address)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	imgs, err := Import(ctx, client, o.Source, o.Name, o.BaseName, o.Platform)
+	if err != nil {
+		return err
+	}
+	for _, img := range imgs {
+		fmt.Fprintf(o.Out, "%s\t%s\n", img.Name, img.Target.Digest)
+	}
+	return nil
+}
+
+// Import imports the collections of an OCI image layout directory or
+// tarball into the content store. Blobs are imported as is, so their
+// attributes are preserved. The index is named name if set, and the
+// manifests are named by their image name annotations. Manifests
+// annotated with a tag only are named baseName:tag if baseName is set.
+func Import(ctx context.Context, client *containerd.Client, source, name, baseName, platform string) ([]images.Image, error) {
+	kind, path, err := parseImportSource(source)
+	if err != nil {
+		return nil, err
+	}
+
+	var r io.ReadCloser
+	switch kind {
+	case sourceOCILayout:
+		r = tarLayout(path)
+	default:
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		if r, err = compression.DecompressStream(f); err != nil {
+			f.Close()
+			return nil, err
+		}
+		defer f.Close()
+	}
+	defer r.Close()
+
+	var opts []containerd.ImportOpt
+	if name != "" {
+		opts = append(opts, containerd.WithIndexName(name))
+	}
+	if baseName != "" {
+		opts = append(opts, containerd.WithImageRefTranslator(archive.AddRefPrefix(baseName)))
+	}
+	if platform != "" {
+		p, err := platforms.Parse(platform)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, containerd.WithImportPlatform(platforms.Only(p)))
+	} else {
+		opts = append(opts, containerd.WithAllPlatforms(true))
+	}
+
+	imgs, err := client.Import(ctx, r, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to import %s: %w", source, err)
+	}
+	if len(imgs) == 0 {
+		return nil, fmt.Errorf("%w in %s: set a name for the imported index or a base name", errNoImageNames, source)
+	}
+	return imgs, nil
+}
+
+// importFunc imports the collections of an import source as Import
+// does, naming the index name and the tags of the layout in baseName.
+type importFunc func(ctx context.Context, source, name, baseName string) ([]images.Image, error)
+
+// importReference imports the collections of an OCI image layout directory
+// or tarball for ref. The manifests annotated with a tag only are named in
+// the repository of ref, so the manifest tagged as ref and its cosign
+// signature images tagged sha256-<digest>.sig are imported under the names
+// SignatureReference expects. If the layout does not tag ref, the index of
+// the layout is named ref instead.
+func importReference(ctx context.Context, imp importFunc, source, ref string) ([]images.Image, error) {
+	spec, err := reference.Parse(ref)
+	if err != nil {
+		return nil, err
+	}
+	imgs, err := imp(ctx, source, "", spec.Locator)
+	if err != nil && !errors.Is(err, errNoImageNames) {
+		return nil, err
+	}
+	for _, img := range imgs {
+		if img.Name == ref {
+			return imgs, nil
+		}
+	}
+	return imp(ctx, source, ref, spec.Locator)
+}
+
+// parseImportSource returns the type and the path of an import
+// source. Sources without a type are detected from the path.
+func parseImportSource(source string) (string, string, error) {
+	kind, path, ok := strings.Cut(source, ":")
+	if !ok || (kind != sourceOCILayout && kind != sourceOCIArchive) {
+		kind, path = "", source
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", "", fmt.Errorf("import source: %w", err)
+	}
+	switch {
+	case kind == "" && info.IsDir():
+		kind = sourceOCILayout
+	case kind == "":
+		kind = sourceOCIArchive
+	case kind == sourceOCILayout && !info.IsDir():
+		return "", "", fmt.Errorf("%s source %s is not a directory", kind, path)
+	case kind == sourceOCIArchive && info.IsDir():
+		return "", "", fmt.Errorf("%s source %s is a directory", kind, path)
+	}
+	return kind, path, nil
+}
+
+// tarLayout streams the regular files of an OCI image
+// layout directory as the tarball of the layout.
+func tarLayout(dir string) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		tw := tar.NewWriter(pw)
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || !d.Type().IsRegular() {
+				return err
+			}
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			if err := tw.WriteHeader(&tar.Header{
+				Typeflag: tar.TypeReg,
+				Name:     filepath.ToSlash(rel),
+				Mode:     0644,
+				Size:     info.Size(),
+			}); err != nil {
+				return err
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			_, err = io.Copy(tw, f)
+			return err
+		})
+		if err == nil {
+			err = tw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
@@ -0,0 +1,238 @@
+package commands
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/containerd/containerd/images"
+)
+
+func TestValidateBaseName(t *testing.T) {
+	tests := []struct {
+		baseName string
+		wantErr  bool
+	}{
+		{baseName: "localhost:5001/test"},
+		{baseName: "docker.io/library/alpine"},
+		{baseName: "localhost:5001/test:latest", wantErr: true},
+		{baseName: "localhost:5001/test@sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", wantErr: true},
+		{baseName: "localhost:5001/Test Name", wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := validateBaseName(tt.baseName); (err != nil) != tt.wantErr {
+			t.Errorf("validateBaseName(%q) error = %v, wantErr %v", tt.baseName, err, tt.wantErr)
+		}
+	}
+}
+
+func TestParseImportSource(t *testing.T) {
+	dir := t.TempDir()
+	layout := filepath.Join(dir, "layout")
+	if err := os.Mkdir(layout, 0755); err != nil {
+		t.Fatal(err)
+	}
+	archive := filepath.Join(dir, "layout.tar")
+	if err := os.WriteFile(archive, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		source   string
+		wantKind string
+		wantPath string
+		wantErr  bool
+	}{
+		{name: "directory", source: layout, wantKind: sourceOCILayout, wantPath: layout},
+		{name: "file", source: archive, wantKind: sourceOCIArchive, wantPath: archive},
+		{name: "layout prefix", source: "oci-layout:" + layout, wantKind: sourceOCILayout, wantPath: layout},
+		{name: "archive prefix", source: "oci-archive:" + archive, wantKind: sourceOCIArchive, wantPath: archive},
+		{name: "layout prefix of a file", source: "oci-layout:" + archive, wantErr: true},
+		{name: "archive prefix of a directory", source: "oci-archive:" + layout, wantErr: true},
+		// Other prefixes are part of the path.
+		{name: "unknown prefix", source: "docker-archive:" + archive, wantErr: true},
+		{name: "missing path", source: filepath.Join(dir, "missing"), wantErr: true},
+		{name: "missing prefixed path", source: "oci-layout:" + filepath.Join(dir, "missing"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kind, path, err := parseImportSource(tt.source)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseImportSource() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if kind != tt.wantKind || path != tt.wantPath {
+				t.Errorf("parseImportSource() = %s, %s, want %s, %s", kind, path, tt.wantKind, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestTarLayout(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"oci-layout":       `{"imageLayoutVersion":"1.0.0"}`,
+		"index.json":       `{"schemaVersion":2,"manifests":[]}`,
+		"blobs/sha256/abc": "blob",
+		"blobs/sha256/def": "",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Only regular files are streamed.
+	if err := os.Symlink("abc", filepath.Join(dir, "blobs", "sha256", "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	r := tarLayout(dir)
+	defer r.Close()
+	got := map[string]string{}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Typeflag != tar.TypeReg || hdr.Mode != 0644 {
+			t.Errorf("%s: type %c mode %o, want a regular file with mode 644", hdr.Name, hdr.Typeflag, hdr.Mode)
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[hdr.Name] = string(content)
+	}
+	if !reflect.DeepEqual(got, files) {
+		t.Errorf("tarball = %v, want %v", got, files)
+	}
+}
+
+func TestTarLayoutError(t *testing.T) {
+	r := tarLayout(filepath.Join(t.TempDir(), "missing"))
+	defer r.Close()
+	if _, err := io.ReadAll(r); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("reading the tarball error = %v, want not exist", err)
+	}
+
+	// Closing the reader stops the stream.
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "index.json"), make([]byte, 1<<20), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r = tarLayout(dir)
+	if _, err := r.Read(make([]byte, 512)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Read(make([]byte, 512)); !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("read after close error = %v, want closed pipe", err)
+	}
+}
+
+func TestImportReference(t *testing.T) {
+	const ref = "localhost:5001/team/app:latest"
+	errImport := errors.New("invalid layout")
+	image := func(name string) images.Image { return images.Image{Name: name} }
+
+	// importCall is an import call, with its result.
+	type importCall struct {
+		name, baseName string
+		imgs           []images.Image
+		err            error
+	}
+	tests := []struct {
+		name    string
+		ref     string
+		calls   []importCall
+		want    []images.Image
+		wantErr bool
+	}{
+		{
+			name:  "tagged reference",
+			ref:   ref,
+			calls: []importCall{{baseName: "localhost:5001/team/app", imgs: []images.Image{image(ref), image("localhost:5001/team/app:sha256-abc.sig")}}},
+			want:  []images.Image{image(ref), image("localhost:5001/team/app:sha256-abc.sig")},
+		},
+		{
+			name: "other tags",
+			ref:  ref,
+			calls: []importCall{
+				{baseName: "localhost:5001/team/app", imgs: []images.Image{image("localhost:5001/team/app:v1")}},
+				{name: ref, baseName: "localhost:5001/team/app", imgs: []images.Image{image(ref), image("localhost:5001/team/app:v1")}},
+			},
+			want: []images.Image{image(ref), image("localhost:5001/team/app:v1")},
+		},
+		{
+			name: "no tags",
+			ref:  ref,
+			calls: []importCall{
+				{baseName: "localhost:5001/team/app", err: errNoImageNames},
+				{name: ref, baseName: "localhost:5001/team/app", imgs: []images.Image{image(ref)}},
+			},
+			want: []images.Image{image(ref)},
+		},
+		{
+			name:    "import failure",
+			ref:     ref,
+			calls:   []importCall{{baseName: "localhost:5001/team/app", err: errImport}},
+			wantErr: true,
+		},
+		{
+			name: "named import failure",
+			ref:  ref,
+			calls: []importCall{
+				{baseName: "localhost:5001/team/app", err: errNoImageNames},
+				{name: ref, baseName: "localhost:5001/team/app", err: errImport},
+			},
+			wantErr: true,
+		},
+		{name: "invalid reference", ref: "app", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int
+			imp := func(_ context.Context, source, name, baseName string) ([]images.Image, error) {
+				if calls >= len(tt.calls) {
+					return nil, fmt.Errorf("unexpected import %d of %s", calls+1, source)
+				}
+				call := tt.calls[calls]
+				calls++
+				if source != "layout" || name != call.name || baseName != call.baseName {
+					t.Errorf("import %d = %s, %q, %q, want layout, %q, %q", calls, source, name, baseName, call.name, call.baseName)
+				}
+				return call.imgs, call.err
+			}
+			got, err := importReference(context.Background(), imp, "layout", tt.ref)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("importReference() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			// Import failures are returned as is.
+			if n := len(tt.calls); n > 0 && tt.calls[n-1].err == errImport && !errors.Is(err, errImport) {
+				t.Errorf("importReference() error = %v, want %v", err, errImport)
+			}
+			if calls != len(tt.calls) {
+				t.Errorf("imported %d times, want %d", calls, len(tt.calls))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("importReference() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
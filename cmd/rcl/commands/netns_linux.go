@@ -0,0 +1,67 @@
+package commands
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// newNetNS creates a network namespace bind mounted in the
+// directory, so it persists without processes, and returns its path.
+func newNetNS(dir string) (_ string, err error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate network namespace name: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("rcl-%x", b))
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return "", err
+	}
+	f.Close()
+	defer func() {
+		if err != nil {
+			os.Remove(path)
+		}
+	}()
+
+	// The namespace is created by a dedicated thread, which is not
+	// unlocked so it exits with the goroutine instead of being reused.
+	errCh := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		if err := unix.Unshare(unix.CLONE_NEWNET); err != nil {
+			errCh <- fmt.Errorf("failed to unshare network namespace: %w", err)
+			return
+		}
+		current := fmt.Sprintf("/proc/%d/task/%d/ns/net", os.Getpid(), unix.Gettid())
+		if err := unix.Mount(current, path, "none", unix.MS_BIND, ""); err != nil {
+			errCh <- fmt.Errorf("failed to bind mount network namespace at %s: %w", path, err)
+			return
+		}
+		errCh <- nil
+	}()
+	if err := <-errCh; err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// removeNetNS unmounts and removes the network namespace
+// at the path. Namespaces which do not exist are ignored.
+func removeNetNS(path string) error {
+	if err := unix.Unmount(path, unix.MNT_DETACH); err != nil && err != unix.EINVAL && err != unix.ENOENT {
+		return fmt.Errorf("failed to unmount network namespace %s: %w", path, err)
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove network namespace %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+
+package commands
+
+import (
+	"errors"
+)
+
+var errNetNSNotSupported = errors.New("network namespaces are not supported on this platform")
+
+// newNetNS creates a network namespace bind mounted in the
+// directory, so it persists without processes, and returns its path.
+func newNetNS(dir string) (string, error) {
+	return "", errNetNSNotSupported
+}
+
+// removeNetNS unmounts and removes the network namespace
+// at the path. Namespaces which do not exist are ignored.
+func removeNetNS(path string) error {
+	return errNetNSNotSupported
+}
@@ -0,0 +1,343 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/containerd/containerd/log"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/containerd/containerd/oci"
+	gocni "github.com/containerd/go-cni"
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// Network modes supported by the run command.
+const (
+	// NetworkNone creates a network namespace with only a loopback interface.
+	NetworkNone = "none"
+	// NetworkHost shares the host network namespace.
+	NetworkHost = "host"
+	// NetworkCNI creates a network namespace configured by CNI plugins.
+	NetworkCNI = "cni"
+)
+
+const (
+	defaultCNIConfDir = "/etc/cni/net.d"
+	defaultCNIBinDir  = "/opt/cni/bin"
+	// cniInterfacePrefix is the name prefix for
+	// container interfaces created by CNI.
+	cniInterfacePrefix = "eth"
+)
+
+var (
+	// netNSDir is the directory where network namespaces are
+	// bind mounted. This is the same directory used by `ip netns`.
+	netNSDir = "/var/run/netns"
+	// stateDir stores the generated network files for containers.
+	stateDir = "/run/rcl"
+)
+
+// Container labels used to tear down the container network.
+const (
+	labelNetworkMode = "rcl.network.mode"
+	labelNetNS       = "rcl.network.netns"
+	labelCNIConfDir  = "rcl.network.cni-conf-dir"
+	labelCNIBinDir   = "rcl.network.cni-bin-dir"
+)
+
+// containerNetwork describes the network
+// prepared for a container.
+type containerNetwork struct {
+	specOpts []oci.SpecOpts
+	labels   map[string]string
+}
+
+// networkMode resolves the network mode from the run options.
+func (o *RunOptions) networkMode() (string, error) {
+	switch o.Network {
+	case "":
+		if o.CNI {
+			return NetworkCNI, nil
+		}
+		return NetworkNone, nil
+	case NetworkNone, NetworkHost, NetworkCNI:
+		if o.CNI && o.Network != NetworkCNI {
+			return "", fmt.Errorf("--cni conflicts with --network %s", o.Network)
+		}
+		return o.Network, nil
+	default:
+		return "", fmt.Errorf("unsupported network mode %q: must be one of %s, %s, %s", o.Network, NetworkNone, NetworkHost, NetworkCNI)
+	}
+}
+
+// setupNetwork prepares the network for the container with the given id.
+// For CNI networking a new network namespace is created and configured before
+// the container is created. The returned labels must be stored on the container
+// so the network can be released with teardownNetwork.
+func setupNetwork(ctx context.Context, runOpts RunOptions) (*containerNetwork, error) {
+	mode, err := runOpts.networkMode()
+	if err != nil {
+		return nil, err
+	}
+
+	switch mode {
+	case NetworkHost:
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("get hostname: %w", err)
+		}
+		return &containerNetwork{
+			specOpts: []oci.SpecOpts{
+				oci.WithHostNamespace(specs.NetworkNamespace),
+				oci.WithHostHostsFile,
+				oci.WithHostResolvconf,
+				oci.WithEnv([]string{fmt.Sprintf("HOSTNAME=%s", hostname)}),
+			},
+			labels: map[string]string{labelNetworkMode: mode},
+		}, nil
+	case NetworkCNI:
+		return setupCNI(ctx, runOpts)
+	default:
+		return &containerNetwork{}, nil
+	}
+}
+
+func setupCNI(ctx context.Context, runOpts RunOptions) (_ *containerNetwork, err error) {
+	labels := map[string]string{
+		labelNetworkMode: NetworkCNI,
+		labelCNIConfDir:  runOpts.CNIConfDir,
+		labelCNIBinDir:   runOpts.CNIBinDir,
+	}
+
+	nsPath, err := newNetNS(netNSDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create network namespace: %w", err)
+	}
+	labels[labelNetNS] = nsPath
+	defer func() {
+		if err != nil {
+			if terr := teardownNetwork(ctx, runOpts.ID, labels); terr != nil {
+				log.G(ctx).WithError(terr).Warnf("failed to tear down network for %q", runOpts.ID)
+			}
+		}
+	}()
+
+	network, err := newCNI(runOpts.CNIConfDir, runOpts.CNIBinDir)
+	if err != nil {
+		return nil, err
+	}
+	cniID, err := cniContainerID(ctx, runOpts.ID)
+	if err != nil {
+		return nil, err
+	}
+	result, err := network.Setup(ctx, cniID, nsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to setup network for %q: %w", runOpts.ID, err)
+	}
+
+	dir, err := networkStateDir(ctx, runOpts.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0711); err != nil {
+		return nil, err
+	}
+	hostsPath := filepath.Join(dir, "hosts")
+	if err := os.WriteFile(hostsPath, hostsFile(runOpts.ID, result), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write hosts file: %w", err)
+	}
+	resolvPath := filepath.Join(dir, "resolv.conf")
+	resolv, err := resolvConf(result)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(resolvPath, resolv, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write resolv.conf: %w", err)
+	}
+
+	return &containerNetwork{
+		specOpts: []oci.SpecOpts{
+			oci.WithLinuxNamespace(specs.LinuxNamespace{
+				Type: specs.NetworkNamespace,
+				Path: nsPath,
+			}),
+			oci.WithHostname(runOpts.ID),
+			oci.WithMounts([]specs.Mount{
+				{
+					Destination: "/etc/hosts",
+					Type:        "bind",
+					Source:      hostsPath,
+					Options:     []string{"rbind", "ro"},
+				},
+				{
+					Destination: "/etc/resolv.conf",
+					Type:        "bind",
+					Source:      resolvPath,
+					Options:     []string{"rbind", "ro"},
+				},
+			}),
+		},
+		labels: labels,
+	}, nil
+}
+
+// teardownNetwork releases the network resources described by the
+// container labels. All resources are released on a best-effort basis
+// and the first error encountered is returned.
+func teardownNetwork(ctx context.Context, id string, labels map[string]string) error {
+	if labels[labelNetworkMode] != NetworkCNI {
+		return nil
+	}
+
+	var errs []error
+	if path := labels[labelNetNS]; path != "" {
+		if err := removeCNI(ctx, id, path, labels); err != nil {
+			errs = append(errs, err)
+		}
+		if err := removeNetNS(path); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	dir, err := networkStateDir(ctx, id)
+	if err != nil {
+		errs = append(errs, err)
+	} else if err := os.RemoveAll(dir); err != nil {
+		errs = append(errs, err)
+	}
+
+	for _, err := range errs {
+		log.G(ctx).WithError(err).Debugf("network teardown for %q", id)
+	}
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// removeCNI invokes the CNI plugins to release the
+// network attachments in the network namespace.
+func removeCNI(ctx context.Context, id, path string, labels map[string]string) error {
+	network, err := newCNI(labels[labelCNIConfDir], labels[labelCNIBinDir])
+	if err != nil {
+		return err
+	}
+	cniID, err := cniContainerID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := network.Remove(ctx, cniID, path); err != nil {
+		return fmt.Errorf("failed to remove network for %q: %w", id, err)
+	}
+	return nil
+}
+
+// newCNI loads the CNI network configuration from the
+// configuration directory with a loopback network.
+func newCNI(confDir, binDir string) (gocni.CNI, error) {
+	if confDir == "" {
+		confDir = defaultCNIConfDir
+	}
+	if binDir == "" {
+		binDir = defaultCNIBinDir
+	}
+	network, err := gocni.New(
+		gocni.WithPluginConfDir(confDir),
+		gocni.WithPluginDir([]string{binDir}),
+		gocni.WithInterfacePrefix(cniInterfacePrefix),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize cni: %w", err)
+	}
+	if err := network.Load(gocni.WithLoNetwork, gocni.WithDefaultConf); err != nil {
+		return nil, fmt.Errorf("failed to load cni configuration from %s: %w", confDir, err)
+	}
+	return network, nil
+}
+
+// cniContainerID scopes the container id to the containerd namespace, so
+// IPAM allocations do not collide between namespaces.
+func cniContainerID(ctx context.Context, id string) (string, error) {
+	ns, err := namespaces.NamespaceRequired(ctx)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s-%s", ns, id), nil
+}
+
+// networkStateDir returns the directory storing the
+// generated network files for a container.
+func networkStateDir(ctx context.Context, id string) (string, error) {
+	ns, err := namespaces.NamespaceRequired(ctx)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(stateDir, ns, id), nil
+}
+
+// hostsFile generates the /etc/hosts content for the container.
+func hostsFile(hostname string, result *gocni.Result) []byte {
+	var b bytes.Buffer
+	b.WriteString("127.0.0.1\tlocalhost\n")
+	b.WriteString("::1\tlocalhost ip6-localhost ip6-loopback\n")
+	if result != nil {
+		// Interfaces are sorted by name, so the
+		// file is the same for the same result.
+		var names []string
+		for name := range result.Interfaces {
+			// Only the container interfaces created with the
+			// interface prefix are addressable by hostname.
+			if strings.HasPrefix(name, cniInterfacePrefix) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			for _, ip := range result.Interfaces[name].IPConfigs {
+				fmt.Fprintf(&b, "%s\t%s\n", ip.IP, hostname)
+			}
+		}
+	}
+	return b.Bytes()
+}
+
+// resolvConf generates the /etc/resolv.conf content for the container. The DNS
+// configuration from the CNI result is preferred, otherwise the host configuration
+// is used.
+func resolvConf(result *gocni.Result) ([]byte, error) {
+	var b bytes.Buffer
+	if result != nil {
+		for _, dns := range result.DNS {
+			for _, ns := range dns.Nameservers {
+				fmt.Fprintf(&b, "nameserver %s\n", ns)
+			}
+			if len(dns.Search) > 0 {
+				fmt.Fprintf(&b, "search %s\n", strings.Join(dns.Search, " "))
+			}
+			if len(dns.Options) > 0 {
+				fmt.Fprintf(&b, "options %s\n", strings.Join(dns.Options, " "))
+			}
+		}
+	}
+	if b.Len() > 0 {
+		return b.Bytes(), nil
+	}
+
+	host, err := os.ReadFile("/etc/resolv.conf")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read host resolv.conf: %w", err)
+	}
+	// A local stub resolver (e.g. systemd-resolved) is not
+	// reachable from the container network namespace.
+	if bytes.Contains(host, []byte("nameserver 127.")) {
+		if upstream, err := os.ReadFile("/run/systemd/resolve/resolv.conf"); err == nil {
+			return upstream, nil
+		}
+	}
+	return host, nil
+}
@@ -0,0 +1,256 @@
+//go:build linux
+
+package commands
+
+import (
+	"context"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/namespaces"
+	gocni "github.com/containerd/go-cni"
+	"github.com/containernetworking/cni/pkg/types"
+	"golang.org/x/sys/unix"
+)
+
+func TestNetworkMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		network string
+		cni     bool
+		want    string
+		wantErr bool
+	}{
+		{name: "default", want: NetworkNone},
+		{name: "cni flag", cni: true, want: NetworkCNI},
+		{name: "host", network: NetworkHost, want: NetworkHost},
+		{name: "cni mode with flag", network: NetworkCNI, cni: true, want: NetworkCNI},
+		{name: "cni flag conflict", network: NetworkHost, cni: true, wantErr: true},
+		{name: "unsupported", network: "bridge", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := RunOptions{Network: tt.network, CNI: tt.cni}
+			got, err := o.networkMode()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("networkMode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("networkMode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHostsFile(t *testing.T) {
+	result := &gocni.Result{
+		Interfaces: map[string]*gocni.Config{
+			"eth1": {IPConfigs: []*gocni.IPConfig{{IP: net.ParseIP("10.89.0.2")}}},
+			"eth0": {IPConfigs: []*gocni.IPConfig{{IP: net.ParseIP("10.88.0.2")}, {IP: net.ParseIP("fd00::2")}}},
+			// Host side interfaces are not addressable by hostname.
+			"cni0": {IPConfigs: []*gocni.IPConfig{{IP: net.ParseIP("10.88.0.1")}}},
+		},
+	}
+	want := "127.0.0.1\tlocalhost\n" +
+		"::1\tlocalhost ip6-localhost ip6-loopback\n" +
+		"10.88.0.2\tapp\n" +
+		"fd00::2\tapp\n" +
+		"10.89.0.2\tapp\n"
+	// The interfaces are written in the same order on every run.
+	for i := 0; i < 10; i++ {
+		if got := string(hostsFile("app", result)); got != want {
+			t.Fatalf("hosts file =\n%s\nwant\n%s", got, want)
+		}
+	}
+}
+
+func TestResolvConf(t *testing.T) {
+	result := &gocni.Result{
+		DNS: []types.DNS{{
+			Nameservers: []string{"10.0.0.53"},
+			Search:      []string{"svc.local", "local"},
+			Options:     []string{"ndots:2"},
+		}},
+	}
+	got, err := resolvConf(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "nameserver 10.0.0.53\nsearch svc.local local\noptions ndots:2\n"
+	if string(got) != want {
+		t.Errorf("resolvConf() = %q, want %q", got, want)
+	}
+}
+
+// fakeContainer is a container recording its deletion.
+type fakeContainer struct {
+	containerd.Container
+	id      string
+	labels  map[string]string
+	deleted bool
+}
+
+func (c *fakeContainer) ID() string {
+	return c.id
+}
+
+func (c *fakeContainer) Labels(context.Context) (map[string]string, error) {
+	return c.labels, nil
+}
+
+func (c *fakeContainer) Delete(context.Context, ...containerd.DeleteOpts) error {
+	c.deleted = true
+	return nil
+}
+
+// withNetworkDirs sets the network namespace and
+// state directories to temporary directories.
+func withNetworkDirs(t *testing.T) {
+	t.Helper()
+	oldNetNSDir, oldStateDir := netNSDir, stateDir
+	netNSDir, stateDir = t.TempDir(), t.TempDir()
+	t.Cleanup(func() {
+		netNSDir, stateDir = oldNetNSDir, oldStateDir
+	})
+}
+
+// requireNetNS skips the test unless network namespaces can be created.
+func requireNetNS(t *testing.T) {
+	t.Helper()
+	path, err := newNetNS(t.TempDir())
+	if err != nil {
+		t.Skipf("network namespaces are not available: %v", err)
+	}
+	if err := removeNetNS(path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNetNS(t *testing.T) {
+	requireNetNS(t)
+
+	path, err := newNetNS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ns, host unix.Stat_t
+	if err := unix.Stat(path, &ns); err != nil {
+		t.Fatal(err)
+	}
+	if err := unix.Stat("/proc/self/ns/net", &host); err != nil {
+		t.Fatal(err)
+	}
+	if ns.Ino == host.Ino {
+		t.Error("network namespace is the host network namespace")
+	}
+
+	if err := removeNetNS(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("network namespace %s not removed: %v", path, err)
+	}
+	// Removal is idempotent.
+	if err := removeNetNS(path); err != nil {
+		t.Errorf("second removal failed: %v", err)
+	}
+}
+
+func TestRemoveContainerWithoutNetwork(t *testing.T) {
+	withNetworkDirs(t)
+	ctx := namespaces.WithNamespace(context.Background(), "test")
+
+	c := &fakeContainer{id: "app", labels: map[string]string{labelNetworkMode: NetworkHost}}
+	if err := removeContainer(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+	if !c.deleted {
+		t.Error("container not deleted")
+	}
+}
+
+// cniBinDir returns the directory of the CNI plugins used by the tests,
+// set with RCL_TEST_CNI_BIN_DIR, and skips the test if the loopback,
+// bridge or host-local plugins are missing.
+func cniBinDir(t *testing.T) string {
+	t.Helper()
+	dir := os.Getenv("RCL_TEST_CNI_BIN_DIR")
+	if dir == "" {
+		dir = defaultCNIBinDir
+	}
+	for _, plugin := range []string{"loopback", "bridge", "host-local"} {
+		if _, err := os.Stat(filepath.Join(dir, plugin)); err != nil {
+			t.Skipf("CNI plugin %s is not available: %v", plugin, err)
+		}
+	}
+	return dir
+}
+
+const bridgeConf = `{
+  "cniVersion": "1.0.0",
+  "name": "rcl-test",
+  "type": "bridge",
+  "bridge": "rcltest0",
+  "isGateway": true,
+  "ipMasq": false,
+  "ipam": {
+    "type": "host-local",
+    "ranges": [[{"subnet": "10.199.0.0/24"}]],
+    "dataDir": "%s"
+  }
+}`
+
+func TestSetupAndTeardownCNI(t *testing.T) {
+	binDir := cniBinDir(t)
+	requireNetNS(t)
+	withNetworkDirs(t)
+	ctx := namespaces.WithNamespace(context.Background(), "test")
+	// The bridge plugin does not remove the bridge on teardown.
+	t.Cleanup(func() {
+		exec.Command("ip", "link", "delete", "rcltest0").Run() //nolint:errcheck
+	})
+
+	confDir := t.TempDir()
+	conf := strings.Replace(bridgeConf, "%s", t.TempDir(), 1)
+	if err := os.WriteFile(filepath.Join(confDir, "10-rcl-test.conf"), []byte(conf), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	o := RunOptions{ID: "app", Network: NetworkCNI, CNIConfDir: confDir, CNIBinDir: binDir}
+	network, err := setupNetwork(ctx, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nsPath := network.labels[labelNetNS]
+	if _, err := os.Stat(nsPath); err != nil {
+		t.Fatalf("network namespace not created: %v", err)
+	}
+	dir, err := networkStateDir(ctx, o.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts, err := os.ReadFile(filepath.Join(dir, "hosts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(hosts), "10.199.0.") {
+		t.Errorf("hosts file has no bridge address:\n%s", hosts)
+	}
+
+	// The network is released from the container labels.
+	c := &fakeContainer{id: o.ID, labels: network.labels}
+	if err := removeContainer(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(nsPath); !os.IsNotExist(err) {
+		t.Errorf("network namespace %s not removed: %v", nsPath, err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("network state %s not removed: %v", dir, err)
+	}
+}
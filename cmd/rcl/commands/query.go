@@ -0,0 +1,198 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/spf13/cobra"
+	v2 "github.com/uor-framework/uor-client-go/nodes/descriptor/v2"
+	"sigs.k8s.io/yaml"
+
+	"github.com/jpower432/runc-attribute-wrapper/aritfact"
+)
+
+// Output formats of the query command.
+const (
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+	outputTable = "table"
+)
+
+// QueryOptions configures options for querying
+// the attributes of a local collection.
+type QueryOptions struct {
+	*RootOptions
+	Reference string
+	// Select are the attribute queries
+	// filtering the listed nodes.
+	Select []string
+	Output string
+	// selector is parsed from the
+	// attribute queries.
+	selector aritfact.Selector
+}
+
+// NewQueryCmd creates a new cobra.Command for the inspect-attributes subcommand.
+func NewQueryCmd(options *RootOptions) *cobra.Command {
+	o := QueryOptions{
+		RootOptions: options,
+	}
+
+	cmd := &cobra.Command{
+		Use:           "inspect-attributes IMG",
+		Aliases:       []string{"query"},
+		Short:         "Print the attributes of a collection in the content store",
+		SilenceErrors: false,
+		SilenceUsage:  false,
+		Args:          cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			cobra.CheckErr(o.Complete(args))
+			cobra.CheckErr(o.Validate())
+			cobra.CheckErr(o.Run(cmd.Context()))
+		},
+	}
+
+	cmd.Flags().StringArrayVar(&o.Select, "select", o.Select, "only list nodes setting the attributes, as JSON (e.g. '{\"core-descriptor\":{\"type\":\"binary\"}}') or [schema:]key=value pairs")
+	cmd.Flags().StringVarP(&o.Output, "output", "o", outputTable, "output format (json, yaml or table)")
+
+	return cmd
+}
+
+func (o *QueryOptions) Complete(args []string) error {
+	o.Reference = args[0]
+	selector, err := aritfact.ParseSelector(o.Select...)
+	if err != nil {
+		return err
+	}
+	o.selector = selector
+	return nil
+}
+
+func (o *QueryOptions) Validate() error {
+	switch o.Output {
+	case outputJSON, outputYAML, outputTable:
+		return nil
+	default:
+		return fmt.Errorf("unsupported output format %q: must be one of %s, %s, %s", o.Output, outputJSON, outputYAML, outputTable)
+	}
+}
+
+func (o *QueryOptions) Run(ctx context.Context) error {
+	ctx = namespaces.WithNamespace(ctx, o.Namespace)
+	client, ctx, cancel, err := NewClient(ctx, o.Address)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	results, err := queryAttributes(ctx, client.ImageService(), client.ContentStore(), o.Reference, o.selector)
+	if err != nil {
+		return err
+	}
+	return printNodeAttributes(o.Out, o.Output, results)
+}
+
+// queryAttributes returns the attributes of the nodes of the image
+// satisfying the selector. Blobs have an entry per layer descriptor,
+// so a blob listed under several titles has an entry per title.
+func queryAttributes(ctx context.Context, store images.Store, provider content.Provider, ref string, selector aritfact.Selector) ([]nodeAttributes, error) {
+	img, err := store.Get(ctx, ref)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get image %s: %w", ref, err)
+	}
+	graph, err := aritfact.LoadGraph(ctx, provider, img.Target)
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := graph.Find(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]nodeAttributes, 0, len(nodes))
+	for _, node := range nodes {
+		result, err := newNodeAttributes(node)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// nodeAttributes are the attributes of a collection node.
+type nodeAttributes struct {
+	Digest    digest.Digest `json:"digest"`
+	MediaType string        `json:"mediaType"`
+	Size      int64         `json:"size"`
+	// Path is the target path of the blob in the rootfs.
+	Path string `json:"path,omitempty"`
+	// Attributes are the attribute sets by schema ID.
+	Attributes map[string]json.RawMessage `json:"attributes,omitempty"`
+}
+
+// newNodeAttributes returns the attributes of the node properties,
+// with the path of its descriptor.
+func newNodeAttributes(node *v2.Node) (nodeAttributes, error) {
+	desc := node.Descriptor()
+	result := nodeAttributes{
+		Digest:    desc.Digest,
+		MediaType: desc.MediaType,
+		Size:      desc.Size,
+		Path:      desc.Annotations[ocispec.AnnotationTitle],
+	}
+	if node.Properties == nil {
+		return result, nil
+	}
+	data, err := node.Properties.MarshalJSON()
+	if err != nil {
+		return result, fmt.Errorf("node %s: %w", desc.Digest, err)
+	}
+	if err := json.Unmarshal(data, &result.Attributes); err != nil {
+		return result, fmt.Errorf("node %s: %w", desc.Digest, err)
+	}
+	return result, nil
+}
+
+// printNodeAttributes prints the node attributes in the output format.
+func printNodeAttributes(w io.Writer, output string, results []nodeAttributes) error {
+	switch output {
+	case outputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	case outputYAML:
+		data, err := yaml.Marshal(results)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "DIGEST\tMEDIA TYPE\tPATH\tSCHEMA\tATTRIBUTES")
+	for _, result := range results {
+		ids := make([]string, 0, len(result.Attributes))
+		for id := range result.Attributes {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		if len(ids) == 0 {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t\t\n", result.Digest, result.MediaType, result.Path)
+		}
+		for _, id := range ids {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", result.Digest, result.MediaType, result.Path, id, result.Attributes[id])
+		}
+	}
+	return tw.Flush()
+}
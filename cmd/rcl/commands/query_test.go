@@ -0,0 +1,260 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/uor-framework/uor-client-go/nodes/descriptor"
+
+	"github.com/jpower432/runc-attribute-wrapper/aritfact"
+)
+
+// memoryStore is a content provider and image store holding
+// blobs and images in memory. Only ReaderAt and Get are implemented.
+type memoryStore struct {
+	images.Store
+	blobs  map[digest.Digest][]byte
+	images map[string]images.Image
+}
+
+func (m memoryStore) ReaderAt(_ context.Context, desc ocispec.Descriptor) (content.ReaderAt, error) {
+	b, ok := m.blobs[desc.Digest]
+	if !ok {
+		return nil, fmt.Errorf("content %s: %w", desc.Digest, errdefs.ErrNotFound)
+	}
+	return memoryReaderAt{bytes.NewReader(b)}, nil
+}
+
+func (m memoryStore) Get(_ context.Context, name string) (images.Image, error) {
+	img, ok := m.images[name]
+	if !ok {
+		return images.Image{}, fmt.Errorf("image %s: %w", name, errdefs.ErrNotFound)
+	}
+	return img, nil
+}
+
+type memoryReaderAt struct {
+	*bytes.Reader
+}
+
+func (memoryReaderAt) Close() error { return nil }
+
+// add stores the JSON encoding of v and returns its descriptor.
+func (m memoryStore) add(t *testing.T, mediaType string, v interface{}) ocispec.Descriptor {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dgst := digest.FromBytes(b)
+	m.blobs[dgst] = b
+	return ocispec.Descriptor{MediaType: mediaType, Digest: dgst, Size: int64(len(b))}
+}
+
+// blob returns the descriptor of a blob titled title, setting
+// the core-descriptor attributes if attrs is not empty.
+func blob(t *testing.T, title, content, attrs string) ocispec.Descriptor {
+	t.Helper()
+	annotations := map[string]string{}
+	if attrs != "" {
+		var err error
+		annotations, err = descriptor.AnnotationsFromAttributes(map[string]json.RawMessage{descriptor.TypeDescriptor: json.RawMessage(attrs)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	annotations[ocispec.AnnotationTitle] = title
+	return ocispec.Descriptor{
+		MediaType:   "application/octet-stream",
+		Digest:      digest.FromString(content),
+		Size:        int64(len(content)),
+		Annotations: annotations,
+	}
+}
+
+func TestQueryOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    QueryOptions
+		wantErr bool
+	}{
+		{name: "default", opts: QueryOptions{Output: outputTable}},
+		{name: "json", opts: QueryOptions{Output: outputJSON, Select: []string{"core-descriptor:type=binary"}}},
+		{name: "yaml", opts: QueryOptions{Output: outputYAML, Select: []string{`{"core-descriptor":{"type":"binary"}}`}}},
+		{name: "invalid selector", opts: QueryOptions{Output: outputTable, Select: []string{"type"}}, wantErr: true},
+		{name: "unsupported output", opts: QueryOptions{Output: "xml"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := tt.opts
+			err := o.Complete([]string{"localhost:5001/app:v1"})
+			if err == nil {
+				err = o.Validate()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && o.Reference != "localhost:5001/app:v1" {
+				t.Errorf("Reference = %s", o.Reference)
+			}
+		})
+	}
+}
+
+func TestQueryAttributes(t *testing.T) {
+	store := memoryStore{blobs: map[digest.Digest][]byte{}, images: map[string]images.Image{}}
+	tool := blob(t, "bin/tool", "tool", `{"name":"tool","type":"binary"}`)
+	// The same content under other titles and attributes.
+	link := blob(t, "usr/bin/tool", "tool", `{"name":"tool-link","type":"link"}`)
+	// Directories have no content, so they share a digest.
+	etc := blob(t, "etc/", "", "")
+	usr := blob(t, "usr/", "", "")
+	config := store.add(t, "application/vnd.uor.config.v1+json", map[string]string{})
+	manifest := store.add(t, ocispec.MediaTypeImageManifest, ocispec.Manifest{
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config:    config,
+		Layers:    []ocispec.Descriptor{tool, link, etc, usr},
+	})
+	store.images["localhost:5001/app:v1"] = images.Image{Name: "localhost:5001/app:v1", Target: manifest}
+
+	tests := []struct {
+		name    string
+		queries []string
+		want    []string
+	}{
+		{name: "every node", want: []string{"", "", "bin/tool", "usr/bin/tool", "etc/", "usr/"}},
+		{name: "core attribute", queries: []string{"core-descriptor:type=binary"}, want: []string{"bin/tool"}},
+		{name: "attribute of the second title", queries: []string{"name=tool-link"}, want: []string{"usr/bin/tool"}},
+		{name: "no match", queries: []string{"type=library"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selector, err := aritfact.ParseSelector(tt.queries...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			results, err := queryAttributes(context.Background(), store, store, "localhost:5001/app:v1", selector)
+			if err != nil {
+				t.Fatal(err)
+			}
+			paths := map[string]int{}
+			for _, r := range results {
+				paths[r.Path]++
+			}
+			want := map[string]int{}
+			for _, p := range tt.want {
+				want[p]++
+			}
+			if !reflect.DeepEqual(paths, want) {
+				t.Errorf("paths = %v, want %v", paths, want)
+			}
+			for _, r := range results {
+				if r.Path == "usr/bin/tool" && !strings.Contains(string(r.Attributes[descriptor.TypeDescriptor]), `"name":"tool-link"`) {
+					t.Errorf("usr/bin/tool attributes = %s", r.Attributes[descriptor.TypeDescriptor])
+				}
+			}
+		})
+	}
+
+	if _, err := queryAttributes(context.Background(), store, store, "localhost:5001/missing:v1", aritfact.Selector{}); err == nil {
+		t.Error("queryAttributes() of a missing image succeeded, want an error")
+	}
+}
+
+func TestPrintNodeAttributes(t *testing.T) {
+	results := []nodeAttributes{
+		{
+			Digest:    digest.FromString("tool"),
+			MediaType: "application/octet-stream",
+			Size:      4,
+			Path:      "bin/tool",
+			Attributes: map[string]json.RawMessage{
+				"rcl-platform":            json.RawMessage(`{"os":"linux"}`),
+				descriptor.TypeDescriptor: json.RawMessage(`{"type":"binary"}`),
+			},
+		},
+		{Digest: digest.FromString(""), MediaType: "application/octet-stream", Path: "etc/"},
+	}
+	tool, empty := digest.FromString("tool"), digest.FromString("")
+	tests := []struct {
+		output string
+		want   string
+	}{
+		{
+			output: outputTable,
+			want: "DIGEST" + pad(len(tool)-6) + "MEDIA TYPE                PATH      SCHEMA           ATTRIBUTES\n" +
+				tool.String() + "  application/octet-stream  bin/tool  core-descriptor  {\"type\":\"binary\"}\n" +
+				tool.String() + "  application/octet-stream  bin/tool  rcl-platform     {\"os\":\"linux\"}\n" +
+				empty.String() + "  application/octet-stream  etc/                       \n",
+		},
+		{
+			output: outputJSON,
+			want: `[
+  {
+    "digest": "` + tool.String() + `",
+    "mediaType": "application/octet-stream",
+    "size": 4,
+    "path": "bin/tool",
+    "attributes": {
+      "core-descriptor": {
+        "type": "binary"
+      },
+      "rcl-platform": {
+        "os": "linux"
+      }
+    }
+  },
+  {
+    "digest": "` + empty.String() + `",
+    "mediaType": "application/octet-stream",
+    "size": 0,
+    "path": "etc/"
+  }
+]
+`,
+		},
+		{
+			output: outputYAML,
+			want: `- attributes:
+    core-descriptor:
+      type: binary
+    rcl-platform:
+      os: linux
+  digest: ` + tool.String() + `
+  mediaType: application/octet-stream
+  path: bin/tool
+  size: 4
+- digest: ` + empty.String() + `
+  mediaType: application/octet-stream
+  path: etc/
+  size: 0
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.output, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := printNodeAttributes(&out, tt.output, results); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("printNodeAttributes() =\n%s\nwant\n%s", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+// pad returns n+2 spaces, padding a table header to the column width.
+func pad(n int) string {
+	return fmt.Sprintf("%*s", n+2, "")
+}
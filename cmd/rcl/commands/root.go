@@ -1,16 +1,42 @@
 package commands
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"time"
 
+	"github.com/containerd/containerd/namespaces"
 	"github.com/spf13/cobra"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 )
 
+// SourceDateEpochEnv is the environment variable setting the default times
+// of unpacked files and the creation time of generated documents and
+// images, in seconds since the Unix epoch.
+const SourceDateEpochEnv = "SOURCE_DATE_EPOCH"
+
+// sourceDateEpoch reads the source date epoch from the environment.
+// The zero time is returned if it is not set.
+func sourceDateEpoch() (time.Time, error) {
+	value := os.Getenv(SourceDateEpochEnv)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s %q: %w", SourceDateEpochEnv, value, err)
+	}
+	return time.Unix(seconds, 0), nil
+}
+
 type RootOptions struct {
 	genericclioptions.IOStreams
 	Address string
+	// Namespace is the containerd namespace all
+	// subcommands operate in.
+	Namespace string
 }
 
 // NewRootCmd creates a new cobra.Command for the command root.
@@ -33,14 +59,28 @@ func NewRootCmd() *cobra.Command {
 				socket = "/run/containerd/containerd.sock"
 			}
 			o.Address = socket
+
+			// The flag takes precedence over the environment.
+			if !cmd.Flags().Changed("namespace") {
+				if ns := os.Getenv(namespaces.NamespaceEnvVar); ns != "" {
+					o.Namespace = ns
+				}
+			}
 		},
 		RunE: func(cmd *cobra.Command, _ []string) error {
 			return cmd.Help()
 		},
 	}
 
+	cmd.PersistentFlags().StringVarP(&o.Namespace, "namespace", "n", namespaces.Default,
+		"containerd namespace to use (also set with "+namespaces.NamespaceEnvVar+")")
+
 	cmd.AddCommand(NewRunCmd(&o))
 	cmd.AddCommand(NewDeleteCmd(&o))
+	cmd.AddCommand(NewQueryCmd(&o))
+	cmd.AddCommand(NewSBOMCmd(&o))
+	cmd.AddCommand(NewImportCmd(&o))
+	cmd.AddCommand(NewExportCmd(&o))
 
 	return cmd
 }
@@ -0,0 +1,31 @@
+package commands
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSourceDateEpoch(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{name: "unset"},
+		{name: "seconds", value: "1700000000", want: time.Unix(1700000000, 0)},
+		{name: "invalid", value: "yesterday", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(SourceDateEpochEnv, tt.value)
+			got, err := sourceDateEpoch()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("sourceDateEpoch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("sourceDateEpoch() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,8 +3,11 @@ package commands
 import (
 	"context"
 	"encoding/csv"
+	"errors"
 	"fmt"
+	"os"
 	"strings"
+	"time"
 
 	"github.com/containerd/console"
 	"github.com/containerd/containerd"
@@ -12,15 +15,30 @@ import (
 	"github.com/containerd/containerd/cmd/ctr/commands"
 	"github.com/containerd/containerd/cmd/ctr/commands/tasks"
 	"github.com/containerd/containerd/containers"
+	"github.com/containerd/containerd/defaults"
+	"github.com/containerd/containerd/images"
 	clabels "github.com/containerd/containerd/labels"
 	"github.com/containerd/containerd/namespaces"
 	"github.com/containerd/containerd/oci"
+	"github.com/containerd/containerd/platforms"
+	"github.com/containerd/containerd/plugin"
+	"github.com/containerd/containerd/services/introspection"
+	"github.com/docker/go-units"
 	"github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/urfave/cli"
+
+	"github.com/jpower432/runc-attribute-wrapper/aritfact"
+	"github.com/jpower432/runc-attribute-wrapper/aritfact/content/file"
+	"github.com/jpower432/runc-attribute-wrapper/aritfact/options"
+	"github.com/jpower432/runc-attribute-wrapper/aritfact/spec"
 )
 
+// defaultSeccompProfile selects the containerd
+// default seccomp profile.
+const defaultSeccompProfile = "default"
+
 // RunOptions configure options when pulling image references and running
 // containers
 type RunOptions struct {
@@ -34,6 +52,9 @@ type RunOptions struct {
 	CGroup        string
 	Platform      string
 	CNI           bool
+	Network       string
+	CNIConfDir    string
+	CNIBinDir     string
 	FIFODir       string
 	Mounts        []string
 	ContainerArgs []string
@@ -43,6 +64,67 @@ type RunOptions struct {
 	SkipTLSVerify bool
 	// Fetch the image from remote
 	Fetch bool
+	// From imports the image from an OCI image layout
+	// directory or tarball instead of fetching it.
+	From string
+	// Select are the attribute queries
+	// selecting the unpacked blobs.
+	Select []string
+	// SchemaPolicy handles attributes failing schema validation
+	// using the schemas of the SchemaCollections references.
+	SchemaPolicy      string
+	SchemaCollections []string
+	// Dedupe shares the storage of unpacked files with the
+	// content store blobs in the ContentRoot directory.
+	Dedupe      string
+	ContentRoot string
+	// LicensePolicy is the license policy configuration file.
+	// With LicenseOverride, violations are only logged.
+	LicensePolicy   string
+	LicenseOverride bool
+	// TrustPolicy is the trust policy file the collection
+	// signatures are verified against before unpacking.
+	TrustPolicy string
+	// ExtractMaxSize, ExtractMaxEntries and ExtractMaxDepth
+	// bound the unpacked directory blobs. Zero disables a limit.
+	ExtractMaxSize    string
+	ExtractMaxEntries int
+	ExtractMaxDepth   int
+	// TempDir is the directory of the temporary files created while
+	// unpacking. Defaults to the system temporary directory.
+	TempDir string
+
+	Memory          string
+	CPUs            float64
+	PidsLimit       int64
+	CapAdd          []string
+	CapDrop         []string
+	Privileged      bool
+	SeccompProfile  string
+	AppArmorProfile string
+	NoNewPrivileges bool
+	ReadOnly        bool
+
+	Runtime           string
+	RuncBinary        string
+	RuntimeConfigPath string
+	SystemdCgroup     bool
+	Checkpoint        string
+	RestoreImagePath  string
+	// resources are the resource overrides
+	// set from the command line.
+	resources spec.Resources
+	// selector is parsed from the
+	// attribute queries.
+	selector aritfact.Selector
+	// licensePolicy is the license policy of the namespace.
+	licensePolicy aritfact.LicensePolicy
+	// trustPolicy is loaded from the trust policy file.
+	trustPolicy *aritfact.TrustPolicy
+	// sourceDateEpoch is read from SOURCE_DATE_EPOCH.
+	sourceDateEpoch time.Time
+	// extractLimits are parsed from the extraction limit flags.
+	extractLimits file.ExtractLimits
 }
 
 // NewRunCmd creates a new cobra.Command for the run subcommand.
@@ -57,7 +139,7 @@ func NewRunCmd(options *RootOptions) *cobra.Command {
 		SilenceUsage:  false,
 		Args:          cobra.MinimumNArgs(2),
 		Run: func(cmd *cobra.Command, args []string) {
-			cobra.CheckErr(o.Complete(args))
+			cobra.CheckErr(o.Complete(cmd, args))
 			cobra.CheckErr(o.Validate())
 			cobra.CheckErr(o.Run(cmd.Context()))
 		},
@@ -66,9 +148,12 @@ func NewRunCmd(options *RootOptions) *cobra.Command {
 	cmd.Flags().BoolVar(&o.Remove, "rm", o.Remove, "remove container after running")
 	cmd.Flags().BoolVar(&o.NullIO, "null-io", o.NullIO, "send all IO to /dev/null")
 	cmd.Flags().StringVar(&o.LogURI, "log-uri", o.LogURI, "log uri")
-	cmd.Flags().BoolVar(&o.CNI, "cni", o.CNI, "enable cni networking for the container")
+	cmd.Flags().BoolVar(&o.CNI, "cni", o.CNI, "enable cni networking for the container (same as --network cni)")
+	cmd.Flags().StringVar(&o.Network, "network", o.Network, "container network mode (none, host or cni)")
+	cmd.Flags().StringVar(&o.CNIConfDir, "cni-conf-dir", defaultCNIConfDir, "directory containing CNI network configuration")
+	cmd.Flags().StringVar(&o.CNIBinDir, "cni-bin-dir", defaultCNIBinDir, "directory containing CNI plugin binaries")
 	cmd.Flags().BoolVarP(&o.Detach, "detach", "d", o.Detach, "detach from the task after it has started execution")
-	cmd.Flags().StringVar(&o.Platform, "platform", o.Platform, "run image for specific platform")
+	cmd.Flags().StringVar(&o.Platform, "platform", o.Platform, "fetch and run image for specific platform (e.g. linux/arm64)")
 	cmd.Flags().StringVar(&o.CGroup, "cgroup", o.CGroup, "cgroup path (To disable use of cgroup, set to \"\" explicitly)")
 	cmd.Flags().StringVar(&o.FIFODir, "fifo-dir", o.FIFODir, "directory used for storing IO FIFOs")
 	cmd.Flags().BoolVarP(&o.TTY, "tty", "t", o.TTY, "allocate a TTY for the container")
@@ -76,25 +161,169 @@ func NewRunCmd(options *RootOptions) *cobra.Command {
 	cmd.Flags().BoolVar(&o.PlainHTTP, "plain-http", o.PlainHTTP, "use HTTP to connect to registries")
 	cmd.Flags().BoolVar(&o.SkipTLSVerify, "skip-tls-verify", o.SkipTLSVerify, "skip TLS validation when connecting to registries")
 	cmd.Flags().BoolVar(&o.Fetch, "fetch", o.Fetch, "fetch the image reference from remote registry")
+	cmd.Flags().StringVar(&o.From, "from", o.From, "import the image from an OCI image layout (oci-layout:PATH) or tarball (oci-archive:PATH)")
+	cmd.Flags().StringArrayVar(&o.Select, "select", o.Select, "only unpack blobs setting the attributes, as JSON (e.g. '{\"core-descriptor\":{\"type\":\"binary\"}}') or [schema:]key=value pairs")
+	cmd.Flags().StringVar(&o.SchemaPolicy, "schema-policy", string(aritfact.SchemaPolicyWarn), "handling of attributes failing schema validation before unpacking (ignore, warn or fail)")
+	cmd.Flags().StringArrayVar(&o.SchemaCollections, "schema-collection", o.SchemaCollections, "image reference of a collection providing attribute schemas")
+	cmd.Flags().StringVar(&o.Dedupe, "dedupe", o.Dedupe, "share unpacked files with the content store blobs (reflink)")
+	cmd.Flags().StringVar(&o.ContentRoot, "content-root", o.ContentRoot, "content store directory of the containerd daemon, used by --dedupe (defaults to the root of the daemon content plugin)")
+	cmd.Flags().StringVar(&o.LicensePolicy, "license-policy", o.LicensePolicy, "license policy configuration file with allowed and denied licenses per namespace")
+	cmd.Flags().BoolVar(&o.LicenseOverride, "license-override", o.LicenseOverride, "run the collection despite license policy violations, logging them")
+	cmd.Flags().StringVar(&o.TrustPolicy, "trust-policy", o.TrustPolicy, "trust policy file requiring collection signatures by registry or repository")
+	cmd.Flags().StringVar(&o.ExtractMaxSize, "extract-max-size", units.BytesSize(float64(file.DefaultExtractLimits.Size)), "maximum total size of the files extracted from a directory blob (0 for no limit)")
+	cmd.Flags().IntVar(&o.ExtractMaxEntries, "extract-max-entries", file.DefaultExtractLimits.Entries, "maximum number of entries of a directory blob (0 for no limit)")
+	cmd.Flags().IntVar(&o.ExtractMaxDepth, "extract-max-depth", file.DefaultExtractLimits.Depth, "maximum path depth of the entries of a directory blob (0 for no limit)")
+	cmd.Flags().StringVar(&o.TempDir, "temp-dir", o.TempDir, "directory of the temporary files created while unpacking (defaults to $TMPDIR or /tmp)")
+	cmd.Flags().StringVar(&o.Memory, "memory", o.Memory, "memory limit (e.g. 512m, 2g)")
+	cmd.Flags().Float64Var(&o.CPUs, "cpus", o.CPUs, "number of CPUs available to the container")
+	cmd.Flags().Int64Var(&o.PidsLimit, "pids-limit", o.PidsLimit, "maximum number of processes in the container")
+	cmd.Flags().StringSliceVar(&o.CapAdd, "cap-add", o.CapAdd, "add Linux capabilities to the capabilities added by the collection (e.g. CAP_NET_BIND_SERVICE)")
+	cmd.Flags().StringSliceVar(&o.CapDrop, "cap-drop", o.CapDrop, "drop Linux capabilities in addition to the capabilities dropped by the collection (e.g. CAP_CHOWN)")
+	cmd.Flags().BoolVar(&o.Privileged, "privileged", o.Privileged, "run a privileged container")
+	cmd.Flags().StringVar(&o.SeccompProfile, "seccomp-profile", o.SeccompProfile, "path to a seccomp profile, or \"default\" for the containerd default profile")
+	cmd.Flags().StringVar(&o.AppArmorProfile, "apparmor-profile", o.AppArmorProfile, "name of a loaded AppArmor profile to apply")
+	cmd.Flags().BoolVar(&o.NoNewPrivileges, "no-new-privileges", o.NoNewPrivileges, "prevent the container process from gaining new privileges")
+	cmd.Flags().BoolVar(&o.ReadOnly, "read-only", o.ReadOnly, "mount the container's root filesystem as read only")
+	cmd.Flags().StringVar(&o.Runtime, "runtime", o.Runtime, fmt.Sprintf("runtime name (defaults to the collection runtime class or %s)", defaults.DefaultRuntime))
+	cmd.Flags().StringVar(&o.RuncBinary, "runc-binary", o.RuncBinary, "specify runc-compatible binary")
+	cmd.Flags().StringVar(&o.RuntimeConfigPath, "runtime-config-path", o.RuntimeConfigPath, "optional runtime config path for runtimes other than runc")
+	cmd.Flags().BoolVar(&o.SystemdCgroup, "systemd-cgroup", o.SystemdCgroup, "start runc with systemd cgroup manager")
+	cmd.Flags().StringVar(&o.Checkpoint, "checkpoint", o.Checkpoint, "checkpoint image reference to restore the task from")
+	cmd.Flags().StringVar(&o.RestoreImagePath, "restore-image-path", o.RestoreImagePath, "path to a local checkpoint image directory to restore the task from")
 
 	return cmd
 }
 
-func (o *RunOptions) Complete(args []string) error {
+func (o *RunOptions) Complete(cmd *cobra.Command, args []string) error {
 	o.Reference = args[0]
 	o.ID = args[1]
 	if len(args) > 2 {
 		o.ContainerArgs = args[2:]
 	}
+
+	// Flags that are not set do not override
+	// the collection defaults.
+	o.resources = spec.Resources{
+		Memory:    o.Memory,
+		CPUs:      o.CPUs,
+		PidsLimit: o.PidsLimit,
+		CapAdd:    strings.Join(o.CapAdd, ","),
+		CapDrop:   strings.Join(o.CapDrop, ","),
+	}
+	if cmd.Flags().Changed("no-new-privileges") {
+		o.resources.NoNewPrivileges = &o.NoNewPrivileges
+	}
+	if cmd.Flags().Changed("read-only") {
+		o.resources.ReadOnly = &o.ReadOnly
+	}
+
+	selector, err := aritfact.ParseSelector(o.Select...)
+	if err != nil {
+		return err
+	}
+	o.selector = selector
+
+	if o.LicensePolicy != "" {
+		config, err := aritfact.LoadLicenseConfig(o.LicensePolicy)
+		if err != nil {
+			return err
+		}
+		o.licensePolicy = config.Policy(o.Namespace)
+	}
+
+	if o.TrustPolicy != "" {
+		policy, err := aritfact.LoadTrustPolicy(o.TrustPolicy)
+		if err != nil {
+			return err
+		}
+		o.trustPolicy = &policy
+	}
+
+	epoch, err := sourceDateEpoch()
+	if err != nil {
+		return err
+	}
+	o.sourceDateEpoch = epoch
+
+	limits, err := parseExtractLimits(o.ExtractMaxSize, o.ExtractMaxEntries, o.ExtractMaxDepth)
+	if err != nil {
+		return err
+	}
+	o.extractLimits = limits
 	return nil
 }
 
+// contentRoot returns the content store directory of the
+// containerd daemon, exported by its content plugin.
+func contentRoot(ctx context.Context, introspection introspection.Service) (string, error) {
+	resp, err := introspection.Plugins(ctx, []string{fmt.Sprintf("type==%q", plugin.ContentPlugin)})
+	if err != nil {
+		return "", fmt.Errorf("failed to introspect the content plugin: %w", err)
+	}
+	for _, p := range resp.Plugins {
+		if root := p.Exports["root"]; p.InitErr == nil && root != "" {
+			return root, nil
+		}
+	}
+	return "", errors.New("the content plugin of the daemon does not export its root directory, set --content-root")
+}
+
+// parseExtractLimits returns the extraction limits of the flags.
+// The size is a human-readable size, such as 512m or 16GiB.
+func parseExtractLimits(size string, entries, depth int) (file.ExtractLimits, error) {
+	bytes, err := units.RAMInBytes(size)
+	if err != nil {
+		return file.ExtractLimits{}, fmt.Errorf("invalid extraction size limit %q: %w", size, err)
+	}
+	if bytes < 0 || entries < 0 || depth < 0 {
+		return file.ExtractLimits{}, errors.New("extraction limits must not be negative")
+	}
+	return file.ExtractLimits{Size: bytes, Entries: entries, Depth: depth}, nil
+}
+
 func (o *RunOptions) Validate() error {
+	if o.Platform != "" {
+		if _, err := platforms.Parse(o.Platform); err != nil {
+			return err
+		}
+	}
+	if _, err := o.networkMode(); err != nil {
+		return err
+	}
+	if _, err := aritfact.ParseSchemaPolicy(o.SchemaPolicy); err != nil {
+		return err
+	}
+	if _, err := file.ParseDedupeMode(o.Dedupe); err != nil {
+		return err
+	}
+	if _, err := options.ResourceOpts(o.resources); err != nil {
+		return err
+	}
+	if o.SystemdCgroup && o.CGroup == "" {
+		// runc maps "machine.slice:foo:deadbeef" to "/machine.slice/foo-deadbeef.scope"
+		return errors.New("option --systemd-cgroup requires --cgroup to be set, e.g. \"machine.slice:foo:deadbeef\"")
+	}
+	if o.From != "" {
+		if o.Fetch {
+			return errors.New("--from conflicts with --fetch")
+		}
+		if _, _, err := parseImportSource(o.From); err != nil {
+			return err
+		}
+	}
+	if o.Checkpoint != "" && o.RestoreImagePath != "" {
+		return errors.New("--checkpoint conflicts with --restore-image-path")
+	}
+	if o.SeccompProfile != "" && o.SeccompProfile != defaultSeccompProfile {
+		if _, err := os.Stat(o.SeccompProfile); err != nil {
+			return fmt.Errorf("seccomp profile: %w", err)
+		}
+	}
 	return nil
 }
 
 func (o *RunOptions) Run(ctx context.Context) error {
-	ctx = namespaces.WithNamespace(ctx, "default")
+	ctx = namespaces.WithNamespace(ctx, o.Namespace)
 	client, ctx, cancel, err := NewClient(ctx, o.Address)
 	if err != nil {
 		return err
@@ -113,10 +342,44 @@ func (o *RunOptions) Run(ctx context.Context) error {
 			return err
 		}
 
-		_, err = Fetch(ctx, client, o.Reference, config)
+		img, err := Fetch(ctx, client, o.Reference, config)
 		if err != nil {
 			return err
 		}
+		if o.trustPolicy != nil {
+			fetch := func(ctx context.Context, ref string) error {
+				_, err := Fetch(ctx, client, ref, config)
+				return err
+			}
+			if err := fetchSignature(ctx, fetch, img, *o.trustPolicy); err != nil {
+				return err
+			}
+		}
+	}
+
+	if o.From != "" {
+		imp := func(ctx context.Context, source, name, baseName string) ([]images.Image, error) {
+			return Import(ctx, client, source, name, baseName, o.Platform)
+		}
+		if _, err := importReference(ctx, imp, o.From, o.Reference); err != nil {
+			return err
+		}
+	}
+
+	if o.trustPolicy != nil {
+		img, err := client.ImageService().Get(ctx, o.Reference)
+		if err != nil {
+			return err
+		}
+		if err := aritfact.VerifyImage(ctx, client.ImageService(), client.ContentStore(), img, *o.trustPolicy); err != nil {
+			return err
+		}
+	}
+
+	if o.Dedupe != "" && o.ContentRoot == "" {
+		if o.ContentRoot, err = contentRoot(ctx, client.IntrospectionService()); err != nil {
+			return err
+		}
 	}
 
 	container, err := NewContainer(ctx, client, *o)
@@ -124,7 +387,7 @@ func (o *RunOptions) Run(ctx context.Context) error {
 		return err
 	}
 	if o.Remove && !o.Detach {
-		defer container.Delete(ctx, containerd.WithSnapshotCleanup)
+		defer removeContainer(ctx, container, containerd.WithSnapshotCleanup)
 	}
 	var con console.Console
 	if o.TTY {
@@ -137,7 +400,7 @@ func (o *RunOptions) Run(ctx context.Context) error {
 
 	opts := o.getNewTaskOpts()
 	ioOpts := []cio.Opt{cio.WithFIFODir(o.FIFODir)}
-	task, err := tasks.NewTask(ctx, client, container, "", con, o.NullIO, o.LogURI, ioOpts, opts...)
+	task, err := tasks.NewTask(ctx, client, container, o.Checkpoint, con, o.NullIO, o.LogURI, ioOpts, opts...)
 	if err != nil {
 		return err
 	}
@@ -251,6 +514,9 @@ func (o *RunOptions) getNewTaskOpts() []containerd.NewTaskOpts {
 	var (
 		tOpts []containerd.NewTaskOpts
 	)
+	if o.RestoreImagePath != "" {
+		tOpts = append(tOpts, containerd.WithRestoreImagePath(o.RestoreImagePath))
+	}
 
 	return tOpts
 }
@@ -0,0 +1,144 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	api "github.com/containerd/containerd/api/services/introspection/v1"
+	"github.com/containerd/containerd/services/introspection"
+	"github.com/docker/go-units"
+	"github.com/gogo/googleapis/google/rpc"
+
+	"github.com/jpower432/runc-attribute-wrapper/aritfact"
+	"github.com/jpower432/runc-attribute-wrapper/aritfact/content/file"
+)
+
+func TestParseExtractLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    string
+		entries int
+		depth   int
+		want    file.ExtractLimits
+		wantErr bool
+	}{
+		{
+			name:    "default",
+			size:    units.BytesSize(float64(file.DefaultExtractLimits.Size)),
+			entries: file.DefaultExtractLimits.Entries,
+			depth:   file.DefaultExtractLimits.Depth,
+			want:    file.DefaultExtractLimits,
+		},
+		{name: "short size", size: "512m", entries: 10, depth: 2, want: file.ExtractLimits{Size: 512 << 20, Entries: 10, Depth: 2}},
+		{name: "no limits", size: "0", want: file.ExtractLimits{}},
+		{name: "invalid size", size: "lots", wantErr: true},
+		{name: "negative entries", size: "1g", entries: -1, wantErr: true},
+		{name: "negative depth", size: "1g", depth: -1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseExtractLimits(tt.size, tt.entries, tt.depth)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseExtractLimits() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseExtractLimits() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeIntrospection is an introspection service listing the plugins.
+type fakeIntrospection struct {
+	introspection.Service
+	plugins []api.Plugin
+	err     error
+	filters []string
+}
+
+func (i *fakeIntrospection) Plugins(_ context.Context, filters []string) (*api.PluginsResponse, error) {
+	i.filters = filters
+	return &api.PluginsResponse{Plugins: i.plugins}, i.err
+}
+
+func TestContentRoot(t *testing.T) {
+	tests := []struct {
+		name    string
+		plugins []api.Plugin
+		err     error
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "exported root",
+			plugins: []api.Plugin{{Type: "io.containerd.content.v1", ID: "content", Exports: map[string]string{"root": "/data/containerd/io.containerd.content.v1.content"}}},
+			want:    "/data/containerd/io.containerd.content.v1.content",
+		},
+		{
+			name: "failed plugin",
+			plugins: []api.Plugin{
+				{ID: "failed", Exports: map[string]string{"root": "/failed"}, InitErr: &rpc.Status{Message: "failed"}},
+				{ID: "content", Exports: map[string]string{"root": "/content"}},
+			},
+			want: "/content",
+		},
+		{name: "no root", plugins: []api.Plugin{{ID: "content"}}, wantErr: true},
+		{name: "no plugin", wantErr: true},
+		{name: "introspection error", err: errors.New("unavailable"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := &fakeIntrospection{plugins: tt.plugins, err: tt.err}
+			got, err := contentRoot(context.Background(), i)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("contentRoot() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("contentRoot() = %q, want %q", got, tt.want)
+			}
+			if len(i.filters) != 1 || i.filters[0] != `type=="io.containerd.content.v1"` {
+				t.Errorf("filters = %q", i.filters)
+			}
+		})
+	}
+}
+
+func TestRunOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		set     func(o *RunOptions)
+		wantErr bool
+	}{
+		{name: "defaults", set: func(o *RunOptions) {}},
+		{name: "platform", set: func(o *RunOptions) { o.Platform = "linux/arm64" }},
+		{name: "invalid platform", set: func(o *RunOptions) { o.Platform = "linux/arm64/v8/extra" }, wantErr: true},
+		{name: "checkpoint", set: func(o *RunOptions) { o.Checkpoint = "localhost:5001/checkpoint:latest" }},
+		{name: "restore image path", set: func(o *RunOptions) { o.RestoreImagePath = "/var/lib/checkpoint" }},
+		{
+			name: "checkpoint and restore image path",
+			set: func(o *RunOptions) {
+				o.Checkpoint = "localhost:5001/checkpoint:latest"
+				o.RestoreImagePath = "/var/lib/checkpoint"
+			},
+			wantErr: true,
+		},
+		{
+			name: "from and fetch",
+			set: func(o *RunOptions) {
+				o.From = "oci-layout:/layout"
+				o.Fetch = true
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := RunOptions{SchemaPolicy: string(aritfact.SchemaPolicyWarn), Dedupe: string(file.DedupeNone)}
+			tt.set(&o)
+			if err := o.Validate(); (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
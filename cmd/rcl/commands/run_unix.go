@@ -5,17 +5,27 @@ package commands
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/contrib/seccomp"
+	"github.com/containerd/containerd/defaults"
+	"github.com/containerd/containerd/log"
 	"github.com/containerd/containerd/oci"
+	runtimeoptions "github.com/containerd/containerd/pkg/runtimeoptions/v1"
+	"github.com/containerd/containerd/platforms"
+	"github.com/containerd/containerd/plugin"
+	runcoptions "github.com/containerd/containerd/runtime/v2/runc/options"
 	"github.com/opencontainers/runtime-spec/specs-go"
 
 	"github.com/jpower432/runc-attribute-wrapper/aritfact"
+	"github.com/jpower432/runc-attribute-wrapper/aritfact/content/file"
 	"github.com/jpower432/runc-attribute-wrapper/aritfact/options"
+	"github.com/jpower432/runc-attribute-wrapper/aritfact/spec"
 )
 
 // NewContainer creates a new container
-func NewContainer(ctx context.Context, client *containerd.Client, runOpts RunOptions) (containerd.Container, error) {
+func NewContainer(ctx context.Context, client *containerd.Client, runOpts RunOptions) (_ containerd.Container, err error) {
 	var (
 		opts    []oci.SpecOpts
 		cOpts   []containerd.NewContainerOpts
@@ -25,7 +35,11 @@ func NewContainer(ctx context.Context, client *containerd.Client, runOpts RunOpt
 		env     []string
 	)
 
-	opts = append(opts, oci.WithDefaultSpec(), oci.WithDefaultUnixDevices)
+	if runOpts.Platform != "" {
+		opts = append(opts, oci.WithDefaultSpecForPlatform(runOpts.Platform), oci.WithDefaultUnixDevices)
+	} else {
+		opts = append(opts, oci.WithDefaultSpec(), oci.WithDefaultUnixDevices)
+	}
 
 	if ef := envFile; ef != "" {
 		opts = append(opts, oci.WithEnvFile(ef))
@@ -41,8 +55,27 @@ func NewContainer(ctx context.Context, client *containerd.Client, runOpts RunOpt
 		return nil, err
 	}
 
-	underlyingImage := containerd.NewImage(client, i)
-	image = aritfact.NewImage(client, i, underlyingImage)
+	var unpackOpts []containerd.UnpackOpt
+	imageOpts := []aritfact.ImageOpt{
+		aritfact.WithSelector(runOpts.selector),
+		aritfact.WithSchemaPolicy(aritfact.SchemaPolicy(runOpts.SchemaPolicy), runOpts.SchemaCollections...),
+		aritfact.WithDedupe(file.DedupeMode(runOpts.Dedupe), runOpts.ContentRoot),
+		aritfact.WithLicensePolicy(runOpts.licensePolicy, runOpts.LicenseOverride),
+		aritfact.WithSourceDateEpoch(runOpts.sourceDateEpoch),
+		aritfact.WithExtractLimits(runOpts.extractLimits),
+		aritfact.WithTempDir(runOpts.TempDir),
+	}
+	if runOpts.Platform != "" {
+		platform, err := platforms.Parse(runOpts.Platform)
+		if err != nil {
+			return nil, err
+		}
+		image = aritfact.NewImageWithPlatform(client, i, platforms.Only(platform), imageOpts...)
+		unpackOpts = append(unpackOpts, containerd.WithSnapshotterPlatformCheck())
+	} else {
+		underlyingImage := containerd.NewImage(client, i)
+		image = aritfact.NewImage(client, i, underlyingImage, imageOpts...)
+	}
 
 	unpacked, err := image.IsUnpacked(ctx, snapshotter)
 	if err != nil {
@@ -50,9 +83,11 @@ func NewContainer(ctx context.Context, client *containerd.Client, runOpts RunOpt
 	}
 
 	if !unpacked {
-		if err := image.Unpack(ctx, snapshotter); err != nil {
+		if err := image.Unpack(ctx, snapshotter, unpackOpts...); err != nil {
 			return nil, err
 		}
+	} else if err := image.CheckLicenses(ctx); err != nil {
+		return nil, err
 	}
 
 	opts = append(opts, options.WithImageConfig(image))
@@ -79,6 +114,54 @@ func NewContainer(ctx context.Context, client *containerd.Client, runOpts RunOpt
 		opts = append(opts, oci.WithCgroup(runOpts.CGroup))
 	}
 
+	network, err := setupNetwork(ctx, runOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			if terr := teardownNetwork(ctx, runOpts.ID, network.labels); terr != nil {
+				log.G(ctx).WithError(terr).Warnf("failed to tear down network for %q", runOpts.ID)
+			}
+		}
+	}()
+	opts = append(opts, network.specOpts...)
+	if len(network.labels) > 0 {
+		cOpts = append(cOpts, containerd.WithAdditionalContainerLabels(network.labels))
+	}
+
+	if runOpts.Privileged {
+		opts = append(opts, oci.WithPrivileged, oci.WithAllDevicesAllowed, oci.WithHostDevices)
+	}
+
+	// Capabilities are applied after privileged mode
+	// so they can be dropped again.
+	opts = append(opts, options.WithResources(image, runOpts.resources))
+
+	// The default seccomp profile is generated from the process
+	// capabilities, so it must follow the resource options.
+	switch runOpts.SeccompProfile {
+	case "":
+	case defaultSeccompProfile:
+		opts = append(opts, seccomp.WithDefaultProfile())
+	default:
+		opts = append(opts, seccomp.WithProfile(runOpts.SeccompProfile))
+	}
+
+	if runOpts.AppArmorProfile != "" {
+		opts = append(opts, oci.WithApparmorProfile(runOpts.AppArmorProfile))
+	}
+
+	runtime, err := resolveRuntime(ctx, image, runOpts)
+	if err != nil {
+		return nil, err
+	}
+	runtimeOpts, err := getRuntimeOptions(runtime, runOpts)
+	if err != nil {
+		return nil, err
+	}
+	cOpts = append(cOpts, containerd.WithRuntime(runtime, runtimeOpts))
+
 	var s specs.Spec
 	spec = containerd.WithSpec(&s, opts...)
 
@@ -88,3 +171,49 @@ func NewContainer(ctx context.Context, client *containerd.Client, runOpts RunOpt
 	// the /etc/{passwd,group} files. So cOpts needs to have precedence over opts.
 	return client.NewContainer(ctx, runOpts.ID, cOpts...)
 }
+
+// resolveRuntime returns the runtime name from the command line, falling back
+// to the runtime class requested by the collection and the default runtime.
+func resolveRuntime(ctx context.Context, image aritfact.Image, runOpts RunOptions) (string, error) {
+	if runOpts.Runtime != "" {
+		return runOpts.Runtime, nil
+	}
+	var runtime spec.Runtime
+	if _, err := image.Attributes(ctx, spec.SchemaRuntime, &runtime); err != nil {
+		return "", err
+	}
+	if runtime.RuntimeClass != "" {
+		return runtime.RuntimeClass, nil
+	}
+	return defaults.DefaultRuntime, nil
+}
+
+func getRuncOptions(runOpts RunOptions) *runcoptions.Options {
+	runtimeOpts := &runcoptions.Options{}
+	if runOpts.RuncBinary != "" {
+		runtimeOpts.BinaryName = runOpts.RuncBinary
+	}
+	if runOpts.SystemdCgroup {
+		runtimeOpts.SystemdCgroup = true
+	}
+	return runtimeOpts
+}
+
+func getRuntimeOptions(runtime string, runOpts RunOptions) (interface{}, error) {
+	// validate first
+	if (runOpts.RuncBinary != "" || runOpts.SystemdCgroup) && runtime != plugin.RuntimeRuncV2 {
+		return nil, fmt.Errorf("specifying runc-binary and systemd-cgroup is only supported for %q runtime", plugin.RuntimeRuncV2)
+	}
+
+	if runtime == plugin.RuntimeRuncV2 {
+		return getRuncOptions(runOpts), nil
+	}
+
+	if runOpts.RuntimeConfigPath != "" {
+		return &runtimeoptions.Options{
+			ConfigPath: runOpts.RuntimeConfigPath,
+		}, nil
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,119 @@
+//go:build !windows
+// +build !windows
+
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/defaults"
+	runtimeoptions "github.com/containerd/containerd/pkg/runtimeoptions/v1"
+	"github.com/containerd/containerd/plugin"
+	"github.com/containerd/containerd/runtime/linux/runctypes"
+	runcoptions "github.com/containerd/containerd/runtime/v2/runc/options"
+
+	"github.com/jpower432/runc-attribute-wrapper/aritfact"
+	"github.com/jpower432/runc-attribute-wrapper/aritfact/spec"
+)
+
+// runtimeImage is an image with the runtime attributes, if set.
+// Only Attributes is implemented.
+type runtimeImage struct {
+	aritfact.Image
+	runtime *spec.Runtime
+}
+
+func (i runtimeImage) Attributes(_ context.Context, schemaID string, v interface{}) (bool, error) {
+	if schemaID != spec.SchemaRuntime || i.runtime == nil {
+		return false, nil
+	}
+	b, err := json.Marshal(i.runtime)
+	if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(b, v)
+}
+
+func TestResolveRuntime(t *testing.T) {
+	tests := []struct {
+		name    string
+		flag    string
+		runtime *spec.Runtime
+		want    string
+	}{
+		{name: "default", want: defaults.DefaultRuntime},
+		{name: "no runtime class", runtime: &spec.Runtime{}, want: defaults.DefaultRuntime},
+		{name: "collection", runtime: &spec.Runtime{RuntimeClass: "io.containerd.kata.v2"}, want: "io.containerd.kata.v2"},
+		{name: "flag", flag: "io.containerd.runsc.v1", runtime: &spec.Runtime{RuntimeClass: "io.containerd.kata.v2"}, want: "io.containerd.runsc.v1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveRuntime(context.Background(), runtimeImage{runtime: tt.runtime}, RunOptions{Runtime: tt.flag})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("resolveRuntime() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetRuntimeOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		runtime string
+		runOpts RunOptions
+		want    interface{}
+		wantErr bool
+	}{
+		{name: "runc", runtime: plugin.RuntimeRuncV2, want: &runcoptions.Options{}},
+		{
+			name:    "runc options",
+			runtime: plugin.RuntimeRuncV2,
+			runOpts: RunOptions{RuncBinary: "/usr/local/bin/crun", SystemdCgroup: true},
+			want:    &runcoptions.Options{BinaryName: "/usr/local/bin/crun", SystemdCgroup: true},
+		},
+		{name: "runc options of another runtime", runtime: "io.containerd.kata.v2", runOpts: RunOptions{SystemdCgroup: true}, wantErr: true},
+		{
+			name:    "runtime config",
+			runtime: "io.containerd.kata.v2",
+			runOpts: RunOptions{RuntimeConfigPath: "/etc/kata/configuration.toml"},
+			want:    &runtimeoptions.Options{ConfigPath: "/etc/kata/configuration.toml"},
+		},
+		{name: "no options", runtime: "io.containerd.kata.v2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := getRuntimeOptions(tt.runtime, tt.runOpts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getRuntimeOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getRuntimeOptions() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetNewTaskOpts(t *testing.T) {
+	if opts := (&RunOptions{Checkpoint: "localhost:5001/checkpoint:latest"}).getNewTaskOpts(); len(opts) != 0 {
+		t.Errorf("checkpoint image restore has %d task options, want none", len(opts))
+	}
+
+	opts := (&RunOptions{RestoreImagePath: "/var/lib/checkpoint"}).getNewTaskOpts()
+	var info containerd.TaskInfo
+	for _, o := range opts {
+		if err := o(context.Background(), nil, &info); err != nil {
+			t.Fatal(err)
+		}
+	}
+	createOpts, ok := info.Options.(*runctypes.CreateOptions)
+	if !ok || createOpts.CriuImagePath != "/var/lib/checkpoint" {
+		t.Errorf("task options = %#v, want the restore image path", info.Options)
+	}
+}
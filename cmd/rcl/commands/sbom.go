@@ -0,0 +1,110 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/containerd/containerd/platforms"
+	"github.com/spf13/cobra"
+
+	"github.com/jpower432/runc-attribute-wrapper/aritfact"
+)
+
+// SBOMOptions configures options for generating the
+// software bill of materials of a local collection.
+type SBOMOptions struct {
+	*RootOptions
+	Reference string
+	Format    string
+	Platform  string
+	// Select are the attribute queries
+	// the listed blobs must match.
+	Select   []string
+	format   aritfact.SBOMFormat
+	selector aritfact.Selector
+}
+
+// NewSBOMCmd creates a new cobra.Command for the sbom subcommand.
+func NewSBOMCmd(options *RootOptions) *cobra.Command {
+	o := SBOMOptions{
+		RootOptions: options,
+	}
+
+	cmd := &cobra.Command{
+		Use:           "sbom IMG",
+		Short:         "Print the software bill of materials of a collection in the content store",
+		SilenceErrors: false,
+		SilenceUsage:  false,
+		Args:          cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			cobra.CheckErr(o.Complete(args))
+			cobra.CheckErr(o.Validate())
+			cobra.CheckErr(o.Run(cmd.Context()))
+		},
+	}
+
+	cmd.Flags().StringVar(&o.Format, "format", string(aritfact.SBOMFormatSPDX), "sbom format (spdx or cyclonedx)")
+	cmd.Flags().StringVar(&o.Platform, "platform", o.Platform, "record the paths of the blobs unpacked for a specific platform (e.g. linux/arm64)")
+	cmd.Flags().StringArrayVar(&o.Select, "select", o.Select, "record the paths of the blobs unpacked when setting the attributes, as JSON (e.g. '{\"core-descriptor\":{\"type\":\"binary\"}}') or [schema:]key=value pairs")
+
+	return cmd
+}
+
+func (o *SBOMOptions) Complete(args []string) error {
+	o.Reference = args[0]
+	selector, err := aritfact.ParseSelector(o.Select...)
+	if err != nil {
+		return err
+	}
+	o.selector = selector
+	return nil
+}
+
+func (o *SBOMOptions) Validate() error {
+	format, err := aritfact.ParseSBOMFormat(o.Format)
+	if err != nil {
+		return err
+	}
+	o.format = format
+	if o.Platform != "" {
+		if _, err := platforms.Parse(o.Platform); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *SBOMOptions) Run(ctx context.Context) error {
+	ctx = namespaces.WithNamespace(ctx, o.Namespace)
+	client, ctx, cancel, err := NewClient(ctx, o.Address)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	img, err := client.ImageService().Get(ctx, o.Reference)
+	if err != nil {
+		return fmt.Errorf("failed to get image %s: %w", o.Reference, err)
+	}
+	var image aritfact.Image
+	if o.Platform != "" {
+		platform, err := platforms.Parse(o.Platform)
+		if err != nil {
+			return err
+		}
+		image = aritfact.NewImageWithPlatform(client, img, platforms.Only(platform), aritfact.WithSelector(o.selector))
+	} else {
+		image = aritfact.NewImage(client, img, containerd.NewImage(client, img), aritfact.WithSelector(o.selector))
+	}
+	components, err := image.Components(ctx)
+	if err != nil {
+		return err
+	}
+	created, err := sourceDateEpoch()
+	if err != nil {
+		return err
+	}
+	return aritfact.WriteSBOM(o.Out, o.format, img.Name, img.Target, components, created)
+}